@@ -9,14 +9,20 @@ import (
 func AddRoutes(app *iris.Application) {
 	app.Get("/palette", controllers.GetPalette)
 
+	app.Get("/attractor", controllers.GetAttractor)
+	app.Get("/buddhabrot", controllers.GetBuddhabrot)
 	app.Get("/cantor-dust", controllers.GetCantorDust)
 	app.Get("/cantor-set", controllers.GetCantorSet)
+	app.Get("/fractint", controllers.GetFractint)
 	app.Get("/hopalong", controllers.GetHopalong)
 	app.Get("/ifs", controllers.GetIFS)
+	app.Get("/julia-atlas", controllers.GetJuliaAtlas)
 	app.Get("/julia-set", controllers.GetJuliaSet)
 	app.Get("/l-system", controllers.GetLindenmayerSystem)
+	app.Get("/lyapunov", controllers.GetLyapunov)
 	app.Get("/mandelbrot-set", controllers.GetMandelbrotSet)
 	app.Get("/newton-basin", controllers.GetNewtonBasin)
+	app.Get("/nova", controllers.GetNova)
 	app.Get("/sierpinski-carpet", controllers.GetSierpinskiCarpet)
 	app.Get("/sierpinski-triangle", controllers.GetSierpinskiTriangle)
 }
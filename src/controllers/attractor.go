@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/yishakk/fractage/src/fractals"
+	"github.com/yishakk/fractage/src/helpers"
+	"github.com/kataras/iris/v12"
+)
+
+const (
+	ATTRACTOR_MAX_POINTS                      = 200_000_000
+	ATTRACTOR_MAX_SIZE                        = 8192
+	ATTRACTOR_MAX_FIT_POINTS                  = 10_000_000
+	ATTRACTOR_DEFAULT_TYPE                    = fractals.ATTRACTOR_TYPE_CLIFFORD
+	ATTRACTOR_DEFAULT_POINTS                  = 10_000_000
+	ATTRACTOR_DEFAULT_FIT_POINTS              = 100_000
+	ATTRACTOR_DEFAULT_TONE_MAPPING            = fractals.TONE_MAPPING_LOG
+	ATTRACTOR_DEFAULT_GAMMA                   = 2.2
+	ATTRACTOR_DEFAULT_COLORING                = fractals.ATTRACTOR_COLORING_DENSITY
+	ATTRACTOR_DEFAULT_COLOR_PALETTE           = "gold"
+	ATTRACTOR_DEFAULT_DIRECTION_COLOR_PALETTE = "hue"
+)
+
+func GetAttractor(ctx iris.Context) {
+	query := ctx.Request().URL.Query()
+	fractal := fractals.Attractor{
+		Width:         DEFAULT_WIDTH,
+		Height:        DEFAULT_HEIGHT,
+		Type:          ATTRACTOR_DEFAULT_TYPE,
+		Points:        ATTRACTOR_DEFAULT_POINTS,
+		FitPoints:     ATTRACTOR_DEFAULT_FIT_POINTS,
+		FitPercentile: fractals.ATTRACTOR_FIT_PERCENTILE,
+		FitMargin:     fractals.ATTRACTOR_FIT_MARGIN,
+		ToneMapping:   ATTRACTOR_DEFAULT_TONE_MAPPING,
+		Gamma:         ATTRACTOR_DEFAULT_GAMMA,
+		Coloring:      ATTRACTOR_DEFAULT_COLORING,
+		Background:    color.RGBA{0, 0, 0, 255},
+	}
+	colorPaletteValue := ""
+	regionValue := ""
+	if query.Has("width") {
+		width, err := strconv.Atoi(query.Get("width"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if width < 1 || width > ATTRACTOR_MAX_SIZE {
+			ctx.Text(fmt.Sprintf("width must be between 1 and %d", ATTRACTOR_MAX_SIZE))
+			return
+		}
+		fractal.Width = width
+	}
+	if query.Has("height") {
+		height, err := strconv.Atoi(query.Get("height"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if height < 1 || height > ATTRACTOR_MAX_SIZE {
+			ctx.Text(fmt.Sprintf("height must be between 1 and %d", ATTRACTOR_MAX_SIZE))
+			return
+		}
+		fractal.Height = height
+	}
+	if query.Has("type") {
+		attractorType := query.Get("type")
+		if !fractals.IsValidAttractorType(attractorType) {
+			ctx.Text("Invalid type")
+			return
+		}
+		fractal.Type = strings.Trim(attractorType, helpers.WHITESPACE_CUTSET)
+	}
+	// the coefficients and the starting point default to those of the type
+	defaults := fractals.ATTRACTOR_DEFAULTS[fractal.Type]
+	coefficients := []*float64{&fractal.A, &fractal.B, &fractal.C, &fractal.D}
+	for i, name := range []string{"a", "b", "c", "d"} {
+		*coefficients[i] = defaults.Coefficients[i]
+		if query.Has(name) {
+			value, err := strconv.ParseFloat(query.Get(name), 64)
+			if err != nil {
+				ctx.Text(err.Error())
+				return
+			}
+			*coefficients[i] = value
+		}
+	}
+	fractal.X, fractal.Y = defaults.X, defaults.Y
+	if query.Has("x") {
+		x, err := strconv.ParseFloat(query.Get("x"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.X = x
+	}
+	if query.Has("y") {
+		y, err := strconv.ParseFloat(query.Get("y"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Y = y
+	}
+	if query.Has("points") {
+		points, err := strconv.Atoi(query.Get("points"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if points < 0 || points > ATTRACTOR_MAX_POINTS {
+			ctx.Text(fmt.Sprintf("Too many points. Max: %d\n", ATTRACTOR_MAX_POINTS))
+			return
+		}
+		fractal.Points = points
+	}
+	if query.Has("fit_points") {
+		fitPoints, err := strconv.Atoi(query.Get("fit_points"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if fitPoints < 1 || fitPoints > ATTRACTOR_MAX_FIT_POINTS {
+			ctx.Text(fmt.Sprintf("fit_points must be between 1 and %d", ATTRACTOR_MAX_FIT_POINTS))
+			return
+		}
+		fractal.FitPoints = fitPoints
+	}
+	if query.Has("fit_percentile") {
+		fitPercentile, err := strconv.ParseFloat(query.Get("fit_percentile"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if fitPercentile <= 0 || fitPercentile > 100 {
+			ctx.Text("fit_percentile must be greater than 0 and at most 100")
+			return
+		}
+		fractal.FitPercentile = fitPercentile
+	}
+	if query.Has("fit_margin") {
+		fitMargin, err := strconv.ParseFloat(query.Get("fit_margin"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if fitMargin < 0 {
+			ctx.Text("fit_margin must be at least 0")
+			return
+		}
+		fractal.FitMargin = fitMargin
+	}
+	if query.Has("region") {
+		regionValue = query.Get("region")
+	}
+	if query.Has("tone_mapping") {
+		toneMapping := query.Get("tone_mapping")
+		if !fractals.IsValidToneMapping(toneMapping) {
+			ctx.Text("Invalid tone_mapping")
+			return
+		}
+		fractal.ToneMapping = strings.Trim(toneMapping, helpers.WHITESPACE_CUTSET)
+	}
+	if query.Has("gamma") {
+		gamma, err := strconv.ParseFloat(query.Get("gamma"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if gamma <= 0 {
+			ctx.Text("gamma must be greater than 0")
+			return
+		}
+		fractal.Gamma = gamma
+	}
+	if query.Has("coloring") {
+		coloring := query.Get("coloring")
+		if !fractals.IsValidAttractorColoring(coloring) {
+			ctx.Text("Invalid coloring")
+			return
+		}
+		fractal.Coloring = strings.Trim(coloring, helpers.WHITESPACE_CUTSET)
+	}
+	if query.Has("color_palette") {
+		colorPaletteValue = query.Get("color_palette")
+	}
+	if query.Has("background") {
+		background, err := helpers.ParseColor(query.Get("background"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Background = background
+	}
+	if colorPaletteValue == "" {
+		colorPaletteValue = ATTRACTOR_DEFAULT_COLOR_PALETTE
+		if fractal.Coloring == fractals.ATTRACTOR_COLORING_DIRECTION {
+			colorPaletteValue = ATTRACTOR_DEFAULT_DIRECTION_COLOR_PALETTE
+		}
+	}
+	colorPalette, err := helpers.ParseColorPalette(colorPaletteValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	fractal.ColorPalette = colorPalette
+	if regionValue != "" {
+		region, err := helpers.ParseRect(regionValue)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Region = region
+	} else {
+		region, err := fractal.FitRegion()
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Region = region
+	}
+	regionValues := []string{
+		strconv.FormatFloat(fractal.Region.X, 'g', -1, 64),
+		strconv.FormatFloat(fractal.Region.Y, 'g', -1, 64),
+		strconv.FormatFloat(fractal.Region.Width, 'g', -1, 64),
+		strconv.FormatFloat(fractal.Region.Height, 'g', -1, 64),
+	}
+	ctx.Header("X-Region", strings.Join(regionValues, ", "))
+	ctx.ContentType("image/png")
+	err = fractal.WriteImage(ctx.ResponseWriter())
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+	}
+}
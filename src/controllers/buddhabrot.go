@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/yishakk/fractage/src/fractals"
+	"github.com/yishakk/fractage/src/helpers"
+	"github.com/kataras/iris/v12"
+)
+
+const (
+	BUDDHABROT_MAX_ITERATIONS         = 100_000
+	BUDDHABROT_MAX_SAMPLES            = 100_000_000
+	BUDDHABROT_MAX_WORKERS            = 64
+	BUDDHABROT_MAX_SIZE               = 8192
+	BUDDHABROT_DEFAULT_MODE           = fractals.BUDDHABROT_MODE_BUDDHABROT
+	BUDDHABROT_DEFAULT_ITERATIONS     = 1000
+	BUDDHABROT_DEFAULT_MIN_ITERATIONS = 0
+	BUDDHABROT_DEFAULT_SAMPLES        = 10_000_000
+	BUDDHABROT_DEFAULT_SEED           = 0
+	BUDDHABROT_DEFAULT_REGION         = "-2, -1.5, 3, 3"
+	BUDDHABROT_DEFAULT_TONE_MAPPING   = fractals.TONE_MAPPING_SQRT
+	BUDDHABROT_DEFAULT_GAMMA          = 2.2
+	BUDDHABROT_DEFAULT_COLOR_PALETTE  = "grayscale"
+)
+
+var (
+	// The maximum numbers of iterations of the red, green and blue channels
+	// of nebulabrots.
+	BUDDHABROT_DEFAULT_CHANNEL_ITERATIONS = [3]int{5000, 500, 50}
+)
+
+func GetBuddhabrot(ctx iris.Context) {
+	query := ctx.Request().URL.Query()
+	fractal := fractals.Buddhabrot{
+		Width:             DEFAULT_WIDTH,
+		Height:            DEFAULT_HEIGHT,
+		Mode:              BUDDHABROT_DEFAULT_MODE,
+		MaxIterations:     BUDDHABROT_DEFAULT_ITERATIONS,
+		MinIterations:     BUDDHABROT_DEFAULT_MIN_ITERATIONS,
+		ChannelIterations: BUDDHABROT_DEFAULT_CHANNEL_ITERATIONS,
+		Samples:           BUDDHABROT_DEFAULT_SAMPLES,
+		Seed:              BUDDHABROT_DEFAULT_SEED,
+		Workers:           runtime.NumCPU(),
+		ToneMapping:       BUDDHABROT_DEFAULT_TONE_MAPPING,
+		Gamma:             BUDDHABROT_DEFAULT_GAMMA,
+	}
+	colorPaletteValue := BUDDHABROT_DEFAULT_COLOR_PALETTE
+	regionValue := BUDDHABROT_DEFAULT_REGION
+	if query.Has("width") {
+		width, err := strconv.Atoi(query.Get("width"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if width < 1 || width > BUDDHABROT_MAX_SIZE {
+			ctx.Text(fmt.Sprintf("width must be between 1 and %d", BUDDHABROT_MAX_SIZE))
+			return
+		}
+		fractal.Width = width
+	}
+	if query.Has("height") {
+		height, err := strconv.Atoi(query.Get("height"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if height < 1 || height > BUDDHABROT_MAX_SIZE {
+			ctx.Text(fmt.Sprintf("height must be between 1 and %d", BUDDHABROT_MAX_SIZE))
+			return
+		}
+		fractal.Height = height
+	}
+	if query.Has("color_palette") {
+		colorPaletteValue = query.Get("color_palette")
+	}
+	if query.Has("mode") {
+		mode := query.Get("mode")
+		if !fractals.IsValidBuddhabrotMode(mode) {
+			ctx.Text("Invalid mode")
+			return
+		}
+		fractal.Mode = strings.Trim(mode, helpers.WHITESPACE_CUTSET)
+	}
+	if query.Has("iterations") {
+		iterations, err := strconv.Atoi(query.Get("iterations"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if iterations < 0 || iterations > BUDDHABROT_MAX_ITERATIONS {
+			ctx.Text(fmt.Sprintf("Too many iterations. Max: %d\n", BUDDHABROT_MAX_ITERATIONS))
+			return
+		}
+		fractal.MaxIterations = iterations
+	}
+	if query.Has("min_iterations") {
+		minIterations, err := strconv.Atoi(query.Get("min_iterations"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.MinIterations = minIterations
+	}
+	if query.Has("channel_iterations") {
+		values, err := helpers.GetParameterValues(query.Get("channel_iterations"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if len(values) != len(fractal.ChannelIterations) {
+			ctx.Text(fmt.Sprintf("channel_iterations: expected %d values, got %d", len(fractal.ChannelIterations), len(values)))
+			return
+		}
+		for i, value := range values {
+			iterations, err := strconv.Atoi(value)
+			if err != nil {
+				ctx.Text(err.Error())
+				return
+			}
+			if iterations < 0 || iterations > BUDDHABROT_MAX_ITERATIONS {
+				ctx.Text(fmt.Sprintf("Too many iterations. Max: %d\n", BUDDHABROT_MAX_ITERATIONS))
+				return
+			}
+			fractal.ChannelIterations[i] = iterations
+		}
+	}
+	if query.Has("samples") {
+		samples, err := strconv.Atoi(query.Get("samples"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if samples < 0 || samples > BUDDHABROT_MAX_SAMPLES {
+			ctx.Text(fmt.Sprintf("Too many samples. Max: %d\n", BUDDHABROT_MAX_SAMPLES))
+			return
+		}
+		fractal.Samples = samples
+	}
+	if query.Has("seed") {
+		seed, err := strconv.ParseInt(query.Get("seed"), 10, 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Seed = seed
+	}
+	if query.Has("workers") {
+		workers, err := strconv.Atoi(query.Get("workers"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if workers < 1 || workers > BUDDHABROT_MAX_WORKERS {
+			ctx.Text(fmt.Sprintf("workers must be between 1 and %d", BUDDHABROT_MAX_WORKERS))
+			return
+		}
+		fractal.Workers = workers
+	}
+	if query.Has("region") {
+		regionValue = query.Get("region")
+	}
+	if query.Has("tone_mapping") {
+		toneMapping := query.Get("tone_mapping")
+		if !fractals.IsValidToneMapping(toneMapping) {
+			ctx.Text("Invalid tone_mapping")
+			return
+		}
+		fractal.ToneMapping = strings.Trim(toneMapping, helpers.WHITESPACE_CUTSET)
+	}
+	if query.Has("gamma") {
+		gamma, err := strconv.ParseFloat(query.Get("gamma"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if gamma <= 0 {
+			ctx.Text("gamma must be greater than 0")
+			return
+		}
+		fractal.Gamma = gamma
+	}
+	region, err := helpers.ParseRect(regionValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	colorPalette, err := helpers.ParseColorPalette(colorPaletteValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	fractal.Region = region
+	fractal.ColorPalette = colorPalette
+	ctx.ContentType("image/png")
+	err = fractal.WriteImage(ctx.ResponseWriter())
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/yishakk/fractage/src/fractals"
+)
+
+// Retrieves the formula of an escape-time fractal and its parameters from the
+// query parameters. The formula is empty when it isn't given.
+func parseFormula(query url.Values, coloring, precision string) (string, map[string]complex128, error) {
+	if !query.Has("formula") {
+		return "", nil, nil
+	}
+	formula := query.Get("formula")
+	parameters := map[string]complex128{}
+	if query.Has("parameters") {
+		var err error
+		parameters, err = fractals.ParseFormulaParameters(query.Get("parameters"))
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	err := fractals.ValidateFormula(formula, parameters)
+	if err != nil {
+		return "", nil, err
+	}
+	if fractals.IsDerivativeEscapeTimeColoring(coloring) {
+		return "", nil, errors.New("The coloring isn't supported by formulas")
+	}
+	if precision != fractals.PRECISION_AUTO && precision != fractals.PRECISION_FLOAT64 {
+		return "", nil, errors.New("Formulas only support the float64 precision")
+	}
+	return formula, parameters, nil
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+
+	"github.com/yishakk/fractage/src/fractals"
+	"github.com/yishakk/fractage/src/helpers"
+	"github.com/kataras/iris/v12"
+)
+
+const (
+	FRACTINT_DEFAULT_REGION = "-2.5, -1.5, 4, 3"
+)
+
+func GetFractint(ctx iris.Context) {
+	query := ctx.Request().URL.Query()
+	fractal := fractals.JuliaSet{
+		Width:         DEFAULT_WIDTH,
+		Height:        DEFAULT_HEIGHT,
+		MaxIterations: fractals.FRACTINT_DEFAULT_ITERATIONS,
+		Coloring:      fractals.JULIA_SET_DEFAULT_COLORING,
+		Precision:     fractals.PRECISION_FLOAT64,
+		Background:    color.RGBA{255, 255, 255, 255},
+	}
+	colorPaletteValue := fractals.JULIA_SET_DEFAULT_COLOR_PALETTE
+	regionValue := FRACTINT_DEFAULT_REGION
+	if !query.Has("frm") && !query.Has("par") {
+		ctx.Text("frm or par is required")
+		return
+	}
+	var formulas []fractals.FractintFormula
+	var err error
+	if query.Has("frm") {
+		formulas, err = fractals.ParseFractintFormulas(query.Get("frm"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+	}
+	var par *fractals.FractintPar
+	if query.Has("par") {
+		pars, err := fractals.ParseFractintPars(query.Get("par"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		par, err = fractals.FindFractintPar(pars, query.Get("entry"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.MaxIterations = par.MaxIterations
+		fractal.FractintParameters = par.Parameters
+		if par.Colors != nil {
+			fractal.Coloring = fractals.ESCAPE_TIME_COLORING_ESCAPE_COUNT
+		}
+	}
+	switch {
+	case query.Has("formula"):
+		fractal.Fractint, err = fractals.FindFractintFormula(formulas, query.Get("formula"))
+	case par != nil:
+		fractal.Fractint, err = par.Formula(formulas)
+	default:
+		fractal.Fractint, err = fractals.FindFractintFormula(formulas, "")
+	}
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	if query.Has("width") {
+		width, err := strconv.Atoi(query.Get("width"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Width = width
+	}
+	if query.Has("height") {
+		height, err := strconv.Atoi(query.Get("height"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Height = height
+	}
+	if query.Has("iterations") {
+		iterations, err := strconv.Atoi(query.Get("iterations"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if iterations < 0 || iterations > fractals.JULIA_SET_MAX_ITERATIONS {
+			ctx.Text(fmt.Sprintf("Too many iterations. Max: %d\n", fractals.JULIA_SET_MAX_ITERATIONS))
+			return
+		}
+		fractal.MaxIterations = iterations
+	}
+	if query.Has("parameters") {
+		err := fractal.FractintParameters.SetParameters(query.Get("parameters"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+	}
+	if query.Has("functions") {
+		names, err := helpers.GetParameterValues(query.Get("functions"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		err = fractal.FractintParameters.SetFunctions(names)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+	}
+	if query.Has("julia") {
+		julia, err := strconv.ParseBool(query.Get("julia"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.FractintParameters.Julia = julia
+	}
+	if query.Has("coloring") {
+		coloring := query.Get("coloring")
+		if !fractals.IsValidEscapeTimeColoring(coloring) {
+			ctx.Text("Invalid coloring")
+			return
+		}
+		if fractals.IsDerivativeEscapeTimeColoring(coloring) {
+			ctx.Text("The coloring isn't supported by Fractint formulas")
+			return
+		}
+		fractal.Coloring = coloring
+	}
+	if fractal.Coloring == fractals.ESCAPE_TIME_COLORING_ORBIT_TRAP {
+		orbitTrap, err := parseOrbitTrap(query)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.OrbitTrap = orbitTrap
+	}
+	if query.Has("background") {
+		background, err := helpers.ParseColor(query.Get("background"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Background = background
+	}
+	if query.Has("region") {
+		regionValue = query.Get("region")
+	}
+	region, err := helpers.ParseRect(regionValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	if par != nil && par.Region != nil && !query.Has("region") {
+		region = *par.Region
+	}
+	if query.Has("color_palette") {
+		colorPaletteValue = query.Get("color_palette")
+	}
+	colorPalette, err := helpers.ParseColorPalette(colorPaletteValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	if par != nil && par.Colors != nil && !query.Has("color_palette") {
+		colorPalette = par.ColorPalette(fractal.MaxIterations)
+	}
+	err = fractal.Fractint.Validate(fractal.FractintParameters)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	fractal.Region = region
+	fractal.ColorPalette = colorPalette
+	ctx.ContentType("image/png")
+	err = fractal.WriteImage(ctx.ResponseWriter())
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+	}
+}
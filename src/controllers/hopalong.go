@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"image/color"
 	"strconv"
+	"strings"
 
 	"github.com/yishakk/fractage/src/fractals"
 	"github.com/yishakk/fractage/src/helpers"
@@ -11,41 +12,63 @@ import (
 )
 
 const (
-	HOPALONG_MAX_RESOLUTION     = 5_000
-	HOPALONG_DEFAULT_RESOLUTION = 5
-	HOPALONG_DEFAULT_A          = 5
-	HOPALONG_DEFAULT_B          = 1
-	HOPALONG_DEFAULT_C          = 5
-	HOPALONG_DEFAULT_D          = 0
-	HOPALONG_DEFAULT_X          = -1
-	HOPALONG_DEFAULT_Y          = 0
-	HOPALONG_DEFAULT_Scale      = 5
-	HOPALONG_DEFAULT_FXN_TYPE   = "classic_bm"
+	HOPALONG_MAX_POINTS             = 200_000_000
+	HOPALONG_MAX_SIZE               = 8192
+	HOPALONG_DEFAULT_POINTS         = 5_000_000
+	HOPALONG_DEFAULT_A              = 5
+	HOPALONG_DEFAULT_B              = 1
+	HOPALONG_DEFAULT_C              = 5
+	HOPALONG_DEFAULT_D              = 0
+	HOPALONG_DEFAULT_X              = -1
+	HOPALONG_DEFAULT_Y              = 0
+	HOPALONG_DEFAULT_Scale          = 5
+	HOPALONG_DEFAULT_ASPECT         = 1
+	HOPALONG_MAX_FIT_POINTS         = 10_000_000
+	HOPALONG_DEFAULT_FIT_POINTS     = 100_000
+	HOPALONG_DEFAULT_FIT_PERCENTILE = 99
+	HOPALONG_DEFAULT_FIT_MARGIN     = 0.05
+	HOPALONG_DEFAULT_FXN_TYPE       = "classic_bm"
+	HOPALONG_DEFAULT_TONE_MAPPING   = fractals.TONE_MAPPING_LOG
+	HOPALONG_DEFAULT_GAMMA          = 2.2
+	HOPALONG_DEFAULT_COLORING       = fractals.HOPALONG_COLORING_DENSITY
+	HOPALONG_DEFAULT_COLOR_PALETTE  = "gold"
 )
 
 func GetHopalong(ctx iris.Context) {
 	query := ctx.Request().URL.Query()
 	fractal := fractals.Hopalong{
-		Width:           DEFAULT_WIDTH,
-		Height:          DEFAULT_HEIGHT,
-		A:               HOPALONG_DEFAULT_A,
-		B:               HOPALONG_DEFAULT_B,
-		C:               HOPALONG_DEFAULT_C,
-		D:               HOPALONG_DEFAULT_D,
-		X:               HOPALONG_DEFAULT_X,
-		Y:               HOPALONG_DEFAULT_Y,
-		Type:            HOPALONG_DEFAULT_FXN_TYPE,
-		Scale:           HOPALONG_DEFAULT_Scale,
-		UseRandomColors: true,
-		Resolution:      HOPALONG_DEFAULT_RESOLUTION,
-		Background:      color.RGBA{255, 255, 255, 255},
+		Width:         DEFAULT_WIDTH,
+		Height:        DEFAULT_HEIGHT,
+		A:             HOPALONG_DEFAULT_A,
+		B:             HOPALONG_DEFAULT_B,
+		C:             HOPALONG_DEFAULT_C,
+		D:             HOPALONG_DEFAULT_D,
+		X:             HOPALONG_DEFAULT_X,
+		Y:             HOPALONG_DEFAULT_Y,
+		Type:          HOPALONG_DEFAULT_FXN_TYPE,
+		Scale:         HOPALONG_DEFAULT_Scale,
+		Aspect:        HOPALONG_DEFAULT_ASPECT,
+		Points:        HOPALONG_DEFAULT_POINTS,
+		ToneMapping:   HOPALONG_DEFAULT_TONE_MAPPING,
+		Gamma:         HOPALONG_DEFAULT_GAMMA,
+		Coloring:      HOPALONG_DEFAULT_COLORING,
+		Background:    color.RGBA{0, 0, 0, 255},
+		FitPoints:     HOPALONG_DEFAULT_FIT_POINTS,
+		FitPercentile: HOPALONG_DEFAULT_FIT_PERCENTILE,
+		FitMargin:     HOPALONG_DEFAULT_FIT_MARGIN,
 	}
+	colorPaletteValue := HOPALONG_DEFAULT_COLOR_PALETTE
+	focus := false
 	if query.Has("width") {
 		width, err := strconv.Atoi(query.Get("width"))
 		if err != nil {
 			ctx.Text(err.Error())
 			return
 		}
+		if width < 1 || width > HOPALONG_MAX_SIZE {
+			ctx.Text(fmt.Sprintf("width must be between 1 and %d", HOPALONG_MAX_SIZE))
+			return
+		}
 		fractal.Width = width
 	}
 	if query.Has("height") {
@@ -54,28 +77,23 @@ func GetHopalong(ctx iris.Context) {
 			ctx.Text(err.Error())
 			return
 		}
-		fractal.Height = height
-	}
-	if query.Has("color") {
-		color, err := helpers.ParseColor(query.Get("color"))
-		if err != nil {
-			ctx.Text(err.Error())
+		if height < 1 || height > HOPALONG_MAX_SIZE {
+			ctx.Text(fmt.Sprintf("height must be between 1 and %d", HOPALONG_MAX_SIZE))
 			return
 		}
-		fractal.Color = color
-		fractal.UseRandomColors = false
+		fractal.Height = height
 	}
-	if query.Has("resolution") {
-		resolution, err := strconv.Atoi(query.Get("resolution"))
+	if query.Has("points") {
+		points, err := strconv.Atoi(query.Get("points"))
 		if err != nil {
 			ctx.Text(err.Error())
 			return
 		}
-		if resolution < 0 || resolution > HOPALONG_MAX_RESOLUTION {
-			ctx.Text(fmt.Sprintf("Resolution is too high. Max: %d\n", HOPALONG_MAX_RESOLUTION))
+		if points < 0 || points > HOPALONG_MAX_POINTS {
+			ctx.Text(fmt.Sprintf("Too many points. Max: %d\n", HOPALONG_MAX_POINTS))
 			return
 		}
-		fractal.Resolution = resolution
+		fractal.Points = points
 	}
 	if query.Has("a") {
 		a, err := strconv.ParseFloat(query.Get("a"), 32)
@@ -126,13 +144,93 @@ func GetHopalong(ctx iris.Context) {
 		fractal.Y = y
 	}
 	if query.Has("scale") {
-		scale, err := strconv.ParseFloat(query.Get("scale"), 32)
+		scale, err := strconv.ParseFloat(query.Get("scale"), 64)
 		if err != nil {
 			ctx.Text(err.Error())
 			return
 		}
 		fractal.Scale = scale
 	}
+	if query.Has("center_x") {
+		centerX, err := strconv.ParseFloat(query.Get("center_x"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.CenterX = centerX
+	}
+	if query.Has("center_y") {
+		centerY, err := strconv.ParseFloat(query.Get("center_y"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.CenterY = centerY
+	}
+	if query.Has("aspect") {
+		aspect, err := strconv.ParseFloat(query.Get("aspect"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if aspect <= 0 {
+			ctx.Text("aspect must be greater than 0")
+			return
+		}
+		fractal.Aspect = aspect
+	}
+	if query.Has("focus") {
+		focusValue, err := strconv.ParseBool(query.Get("focus"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		focus = focusValue
+	}
+	if query.Has("fit_points") {
+		fitPoints, err := strconv.Atoi(query.Get("fit_points"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if fitPoints < 1 || fitPoints > HOPALONG_MAX_FIT_POINTS {
+			ctx.Text(fmt.Sprintf("fit_points must be between 1 and %d", HOPALONG_MAX_FIT_POINTS))
+			return
+		}
+		fractal.FitPoints = fitPoints
+	}
+	if query.Has("fit_percentile") {
+		fitPercentile, err := strconv.ParseFloat(query.Get("fit_percentile"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if fitPercentile <= 0 || fitPercentile > 100 {
+			ctx.Text("fit_percentile must be greater than 0 and at most 100")
+			return
+		}
+		fractal.FitPercentile = fitPercentile
+	}
+	if query.Has("fit_margin") {
+		fitMargin, err := strconv.ParseFloat(query.Get("fit_margin"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if fitMargin < 0 {
+			ctx.Text("fit_margin must be at least 0")
+			return
+		}
+		fractal.FitMargin = fitMargin
+	}
+	if query.Has("stretch") {
+		stretch, err := strconv.ParseBool(query.Get("stretch"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.FitStretch = stretch
+	}
 	if query.Has("type") {
 		fxnType := query.Get("type")
 		validFxn := false
@@ -148,6 +246,37 @@ func GetHopalong(ctx iris.Context) {
 		}
 		fractal.Type = fxnType
 	}
+	if query.Has("tone_mapping") {
+		toneMapping := query.Get("tone_mapping")
+		if !fractals.IsValidHopalongToneMapping(toneMapping) {
+			ctx.Text("Invalid tone_mapping")
+			return
+		}
+		fractal.ToneMapping = strings.Trim(toneMapping, helpers.WHITESPACE_CUTSET)
+	}
+	if query.Has("gamma") {
+		gamma, err := strconv.ParseFloat(query.Get("gamma"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if gamma <= 0 {
+			ctx.Text("gamma must be greater than 0")
+			return
+		}
+		fractal.Gamma = gamma
+	}
+	if query.Has("coloring") {
+		coloring := query.Get("coloring")
+		if !fractals.IsValidHopalongColoring(coloring) {
+			ctx.Text("Invalid coloring")
+			return
+		}
+		fractal.Coloring = strings.Trim(coloring, helpers.WHITESPACE_CUTSET)
+	}
+	if query.Has("color_palette") {
+		colorPaletteValue = query.Get("color_palette")
+	}
 	if query.Has("background") {
 		background, err := helpers.ParseColor(query.Get("background"))
 		if err != nil {
@@ -156,6 +285,34 @@ func GetHopalong(ctx iris.Context) {
 		}
 		fractal.Background = background
 	}
+	colorPalette, err := helpers.ParseColorPalette(colorPaletteValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	fractal.ColorPalette = colorPalette
+	if focus {
+		bounds, err := fractal.FitFraming()
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		boundsValues := []string{
+			strconv.FormatFloat(bounds.X, 'g', -1, 64),
+			strconv.FormatFloat(bounds.Y, 'g', -1, 64),
+			strconv.FormatFloat(bounds.Width, 'g', -1, 64),
+			strconv.FormatFloat(bounds.Height, 'g', -1, 64),
+		}
+		ctx.Header("X-Bounds", strings.Join(boundsValues, ", "))
+	}
+	// the framing is reproduced by passing these as the scale, center_x,
+	// center_y and aspect parameters
+	ctx.Header("X-Scale", strconv.FormatFloat(fractal.Scale, 'g', -1, 64))
+	ctx.Header("X-Center", strconv.FormatFloat(fractal.CenterX, 'g', -1, 64)+", "+strconv.FormatFloat(fractal.CenterY, 'g', -1, 64))
+	ctx.Header("X-Aspect", strconv.FormatFloat(fractal.Aspect, 'g', -1, 64))
 	ctx.ContentType("image/png")
-	fractal.WriteImage(ctx.ResponseWriter())
+	err = fractal.WriteImage(ctx.ResponseWriter())
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+	}
 }
@@ -64,8 +64,11 @@ func GetIFS(ctx iris.Context) {
 	}
 	fractal.Variables = variables
 	if query.Has("color") {
-		colorStr := fmt.Sprintf("\"%s\", ", query.Get("color"))
-		ifsColors = strings.Repeat(colorStr, len(variables))
+		colorValues := make([]string, len(variables))
+		for i := range colorValues {
+			colorValues[i] = query.Get("color")
+		}
+		ifsColors = strings.Join(colorValues, ", ")
 	}
 	if query.Has("colors") {
 		ifsColors = query.Get("colors")
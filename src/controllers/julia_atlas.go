@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"fmt"
+	"image/color"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/yishakk/fractage/src/fractals"
+	"github.com/yishakk/fractage/src/helpers"
+	"github.com/kataras/iris/v12"
+)
+
+const (
+	JULIA_ATLAS_MAX_WORKERS    = 64
+	JULIA_ATLAS_FORMAT_PNG     = "png"
+	JULIA_ATLAS_FORMAT_JSON    = "json"
+	JULIA_ATLAS_DEFAULT_FORMAT = JULIA_ATLAS_FORMAT_PNG
+)
+
+func GetJuliaAtlas(ctx iris.Context) {
+	query := ctx.Request().URL.Query()
+	atlas := fractals.JuliaAtlas{
+		Columns:           fractals.JULIA_ATLAS_DEFAULT_COLUMNS,
+		Rows:              fractals.JULIA_ATLAS_DEFAULT_ROWS,
+		CellWidth:         fractals.JULIA_ATLAS_DEFAULT_CELL_WIDTH,
+		CellHeight:        fractals.JULIA_ATLAS_DEFAULT_CELL_HEIGHT,
+		MandelbrotOpacity: fractals.JULIA_ATLAS_DEFAULT_MANDELBROT_OPACITY,
+		Workers:           runtime.NumCPU(),
+	}
+	julia := fractals.JuliaSet{
+		MaxIterations:     fractals.JULIA_ATLAS_DEFAULT_ITERATIONS,
+		BailOut:           fractals.JULIA_SET_DEFAULT_BAIL_OUT,
+		Coloring:          fractals.JULIA_SET_DEFAULT_COLORING,
+		DistanceThickness: fractals.DISTANCE_ESTIMATE_DEFAULT_THICKNESS,
+		Precision:         fractals.PRECISION_FLOAT64,
+		Background:        color.RGBA{255, 255, 255, 255},
+	}
+	colorPaletteValue := fractals.JULIA_SET_DEFAULT_COLOR_PALETTE
+	regionValue := fractals.JULIA_ATLAS_DEFAULT_REGION
+	juliaRegionValue := fractals.JULIA_SET_DEFAULT_REGION
+	seriesName := fractals.JULIA_SET_DEFAULT_SERIES_TYPE
+	variablesTxt := fractals.JULIA_SET_DEFAULT_VARIABLES_TEXT
+	format := JULIA_ATLAS_DEFAULT_FORMAT
+	mandelbrot := false
+	if query.Has("columns") {
+		columns, err := strconv.Atoi(query.Get("columns"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if columns < 1 || columns > fractals.JULIA_ATLAS_MAX_CELLS {
+			ctx.Text(fmt.Sprintf("columns must be between 1 and %d", fractals.JULIA_ATLAS_MAX_CELLS))
+			return
+		}
+		atlas.Columns = columns
+	}
+	if query.Has("rows") {
+		rows, err := strconv.Atoi(query.Get("rows"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if rows < 1 || rows > fractals.JULIA_ATLAS_MAX_CELLS {
+			ctx.Text(fmt.Sprintf("rows must be between 1 and %d", fractals.JULIA_ATLAS_MAX_CELLS))
+			return
+		}
+		atlas.Rows = rows
+	}
+	if query.Has("cell_width") {
+		cellWidth, err := strconv.Atoi(query.Get("cell_width"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if cellWidth < 1 || cellWidth > fractals.JULIA_ATLAS_MAX_CELL_SIZE {
+			ctx.Text(fmt.Sprintf("cell_width must be between 1 and %d", fractals.JULIA_ATLAS_MAX_CELL_SIZE))
+			return
+		}
+		atlas.CellWidth = cellWidth
+	}
+	if query.Has("cell_height") {
+		cellHeight, err := strconv.Atoi(query.Get("cell_height"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if cellHeight < 1 || cellHeight > fractals.JULIA_ATLAS_MAX_CELL_SIZE {
+			ctx.Text(fmt.Sprintf("cell_height must be between 1 and %d", fractals.JULIA_ATLAS_MAX_CELL_SIZE))
+			return
+		}
+		atlas.CellHeight = cellHeight
+	}
+	if query.Has("region") {
+		regionValue = query.Get("region")
+	}
+	if query.Has("julia_region") {
+		juliaRegionValue = query.Get("julia_region")
+	}
+	if query.Has("color_palette") {
+		colorPaletteValue = query.Get("color_palette")
+	}
+	if query.Has("iterations") {
+		iterations, err := strconv.Atoi(query.Get("iterations"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if iterations < 0 || iterations > fractals.JULIA_SET_MAX_ITERATIONS {
+			ctx.Text(fmt.Sprintf("Too many iterations. Max: %d\n", fractals.JULIA_SET_MAX_ITERATIONS))
+			return
+		}
+		julia.MaxIterations = iterations
+	}
+	if query.Has("bail_out") {
+		bailOut, err := strconv.ParseFloat(query.Get("bail_out"), 32)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		julia.BailOut = bailOut
+	}
+	if query.Has("coloring") {
+		coloring := query.Get("coloring")
+		if !fractals.IsValidEscapeTimeColoring(coloring) {
+			ctx.Text("Invalid coloring")
+			return
+		}
+		julia.Coloring = coloring
+	}
+	if julia.Coloring == fractals.ESCAPE_TIME_COLORING_ORBIT_TRAP {
+		orbitTrap, err := parseOrbitTrap(query)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		julia.OrbitTrap = orbitTrap
+	}
+	if query.Has("type") {
+		seriesName = query.Get("type")
+	}
+	if query.Has("variables") {
+		variablesTxt = query.Get("variables")
+	}
+	if !fractals.IsValidJuliaSetSeriesFunction(seriesName) {
+		ctx.Text("Invalid function type")
+		return
+	}
+	seriesName = strings.Trim(seriesName, helpers.WHITESPACE_CUTSET)
+	julia.SeriesFunctionName = seriesName
+	if fractals.IsDerivativeEscapeTimeColoring(julia.Coloring) {
+		if _, found := fractals.JULIA_SET_SERIES_DERIVATIVES[seriesName]; !found {
+			ctx.Text("The coloring is only supported by the classic series")
+			return
+		}
+	}
+	if query.Has("background") {
+		background, err := helpers.ParseColor(query.Get("background"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		julia.Background = background
+	}
+	if query.Has("mandelbrot") {
+		value, err := strconv.ParseBool(query.Get("mandelbrot"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		mandelbrot = value
+	}
+	if query.Has("mandelbrot_opacity") {
+		opacity, err := strconv.ParseFloat(query.Get("mandelbrot_opacity"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if opacity < 0 || opacity > 1 {
+			ctx.Text("mandelbrot_opacity must be between 0 and 1")
+			return
+		}
+		atlas.MandelbrotOpacity = opacity
+	}
+	if query.Has("workers") {
+		workers, err := strconv.Atoi(query.Get("workers"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if workers < 1 || workers > JULIA_ATLAS_MAX_WORKERS {
+			ctx.Text(fmt.Sprintf("workers must be between 1 and %d", JULIA_ATLAS_MAX_WORKERS))
+			return
+		}
+		atlas.Workers = workers
+	}
+	if query.Has("format") {
+		format = strings.Trim(query.Get("format"), helpers.WHITESPACE_CUTSET)
+		if format != JULIA_ATLAS_FORMAT_PNG && format != JULIA_ATLAS_FORMAT_JSON {
+			ctx.Text("Invalid format")
+			return
+		}
+	}
+	variables, err := fractals.ParseJuliaSetVariables(variablesTxt)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	region, err := helpers.ParseRect(regionValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	juliaRegion, err := helpers.ParseRect(juliaRegionValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	colorPalette, err := helpers.ParseColorPalette(colorPaletteValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	julia.Variables = variables
+	julia.Region = juliaRegion
+	julia.ColorPalette = colorPalette
+	atlas.Region = region
+	atlas.Julia = julia
+	if mandelbrot {
+		// the parameter plane of the variants of the Mandelbrot set is the
+		// set of the same variant
+		variant := fractals.MANDELBROT_VARIANT_CLASSIC
+		if fractals.IsValidMandelbrotVariant(seriesName) {
+			variant = seriesName
+		}
+		mandelbrotPalette, err := helpers.ParseColorPalette(fractals.JULIA_ATLAS_MANDELBROT_COLOR_PALETTE)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		atlas.Mandelbrot = &fractals.MandelbrotSet{
+			ColorPalette:  mandelbrotPalette,
+			MaxIterations: fractals.JULIA_ATLAS_MANDELBROT_ITERATIONS,
+			M:             2,
+			BailOut:       fractals.JULIA_ATLAS_MANDELBROT_BAIL_OUT,
+			Coloring:      fractals.ESCAPE_TIME_COLORING_ESCAPE_COUNT,
+			Precision:     fractals.PRECISION_FLOAT64,
+			Variant:       variant,
+			Background:    julia.Background,
+		}
+	}
+	err = atlas.ValidateSize()
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	if format == JULIA_ATLAS_FORMAT_JSON {
+		ctx.ContentType("application/json")
+		err = atlas.WriteMap(ctx.ResponseWriter())
+	} else {
+		ctx.ContentType("image/png")
+		err = atlas.WriteImage(ctx.ResponseWriter())
+	}
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+	}
+}
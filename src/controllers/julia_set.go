@@ -1,9 +1,11 @@
 package controllers
 
 import (
+	"bytes"
 	"fmt"
 	"image/color"
 	"strconv"
+	"strings"
 
 	"github.com/yishakk/fractage/src/fractals"
 	"github.com/yishakk/fractage/src/helpers"
@@ -13,12 +15,19 @@ import (
 func GetJuliaSet(ctx iris.Context) {
 	query := ctx.Request().URL.Query()
 	fractal := fractals.JuliaSet{
-		Width:         DEFAULT_WIDTH,
-		Height:        DEFAULT_HEIGHT,
-		C:             fractals.JULIA_SET_DEFAULT_C,
-		MaxIterations: fractals.JULIA_SET_DEFAULT_ITERATIONS,
-		BailOut:       fractals.JULIA_SET_DEFAULT_BAIL_OUT,
-		Background:    color.RGBA{255, 255, 255, 255},
+		Width:             DEFAULT_WIDTH,
+		Height:            DEFAULT_HEIGHT,
+		C:                 fractals.JULIA_SET_DEFAULT_C,
+		MaxIterations:     fractals.JULIA_SET_DEFAULT_ITERATIONS,
+		BailOut:           fractals.JULIA_SET_DEFAULT_BAIL_OUT,
+		Coloring:          fractals.JULIA_SET_DEFAULT_COLORING,
+		DistanceThickness: fractals.DISTANCE_ESTIMATE_DEFAULT_THICKNESS,
+		Precision:         fractals.PRECISION_AUTO,
+		Background:        color.RGBA{255, 255, 255, 255},
+		Method:            fractals.JULIA_SET_DEFAULT_METHOD,
+		Points:            fractals.JULIA_SET_DEFAULT_POINTS,
+		Density:           fractals.JULIA_SET_DEFAULT_DENSITY,
+		Seed:              fractals.JULIA_SET_DEFAULT_SEED,
 	}
 	colorPaletteValue := fractals.JULIA_SET_DEFAULT_COLOR_PALETTE
 	regionValue := fractals.JULIA_SET_DEFAULT_REGION
@@ -74,6 +83,42 @@ func GetJuliaSet(ctx iris.Context) {
 		}
 		fractal.BailOut = bailOut
 	}
+	if query.Has("coloring") {
+		coloring := query.Get("coloring")
+		if !fractals.IsValidEscapeTimeColoring(coloring) {
+			ctx.Text("Invalid coloring")
+			return
+		}
+		fractal.Coloring = coloring
+	}
+	if fractal.Coloring == fractals.ESCAPE_TIME_COLORING_ORBIT_TRAP {
+		orbitTrap, err := parseOrbitTrap(query)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.OrbitTrap = orbitTrap
+	}
+	if query.Has("boundary_thickness") {
+		thickness, err := strconv.ParseFloat(query.Get("boundary_thickness"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if thickness <= 0 {
+			ctx.Text("boundary_thickness must be greater than 0")
+			return
+		}
+		fractal.DistanceThickness = thickness
+	}
+	if query.Has("anti_alias") {
+		antiAlias, err := strconv.ParseBool(query.Get("anti_alias"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.AntiAlias = antiAlias
+	}
 	if query.Has("type") {
 		seriesName = query.Get("type")
 	}
@@ -85,6 +130,82 @@ func GetJuliaSet(ctx iris.Context) {
 		return
 	}
 	fractal.SeriesFunctionName = seriesName
+	if fractals.IsDerivativeEscapeTimeColoring(fractal.Coloring) {
+		if _, found := fractals.JULIA_SET_SERIES_DERIVATIVES[seriesName]; !found {
+			ctx.Text("The coloring is only supported by the classic series")
+			return
+		}
+	}
+	if query.Has("precision") {
+		precision := query.Get("precision")
+		if !fractals.IsValidPrecision(precision) {
+			ctx.Text("Invalid precision")
+			return
+		}
+		if precision == fractals.PRECISION_BIG {
+			ctx.Text("The big precision is only supported by the Mandelbrot set")
+			return
+		}
+		if _, found := fractals.JULIA_SET_DOUBLE_DOUBLE_SERIES[seriesName]; precision == fractals.PRECISION_DOUBLE_DOUBLE && !found {
+			ctx.Text("The dd precision is only supported by the classic and phoenix series")
+			return
+		}
+		fractal.Precision = precision
+	}
+	formula, parameters, err := parseFormula(query, fractal.Coloring, fractal.Precision)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	fractal.Formula = formula
+	fractal.Parameters = parameters
+	if query.Has("method") {
+		method := strings.Trim(query.Get("method"), helpers.WHITESPACE_CUTSET)
+		if !fractals.IsValidJuliaSetMethod(method) {
+			ctx.Text("Invalid method")
+			return
+		}
+		if fractals.IsInverseIterationMethod(method) && (seriesName != "classic" || formula != "") {
+			ctx.Text("The iim and miim methods are only supported by the classic series")
+			return
+		}
+		fractal.Method = method
+		if !query.Has("background") && fractal.Method != fractals.JULIA_SET_METHOD_ESCAPE_TIME {
+			fractal.Background = color.RGBA{0, 0, 0, 255}
+		}
+	}
+	if query.Has("points") {
+		points, err := strconv.Atoi(query.Get("points"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if points < 1 || points > fractals.JULIA_SET_MAX_POINTS {
+			ctx.Text(fmt.Sprintf("Too many points. Max: %d\n", fractals.JULIA_SET_MAX_POINTS))
+			return
+		}
+		fractal.Points = points
+	}
+	if query.Has("density") {
+		density, err := strconv.Atoi(query.Get("density"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if density < 1 || density > fractals.JULIA_SET_MAX_DENSITY {
+			ctx.Text(fmt.Sprintf("Too high density. Max: %d\n", fractals.JULIA_SET_MAX_DENSITY))
+			return
+		}
+		fractal.Density = density
+	}
+	if query.Has("seed") {
+		seed, err := strconv.ParseInt(query.Get("seed"), 10, 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Seed = seed
+	}
 	if query.Has("background") {
 		background, err := helpers.ParseColor(query.Get("background"))
 		if err != nil {
@@ -98,21 +219,32 @@ func GetJuliaSet(ctx iris.Context) {
 		ctx.Text(err.Error())
 		return
 	}
-	region, err := helpers.ParseRect(regionValue)
+	region, err := helpers.ParseBigRect(regionValue)
 	if err != nil {
 		ctx.Text(err.Error())
 		return
 	}
+	center := region.Center()
 	colorPalette, err := helpers.ParseColorPalette(colorPaletteValue)
 	if err != nil {
 		ctx.Text(err.Error())
 		return
 	}
 	fractal.Variables = variables
-	fractal.Region = region
+	fractal.Region = region.Rect()
+	fractal.Center = &center
 	fractal.ColorPalette = colorPalette
+	// the image is buffered so that the method that drew it can be sent in
+	// the headers
+	var output bytes.Buffer
+	err = fractal.WriteImage(&output)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	ctx.Header("X-Method", fractal.RenderedMethod)
 	ctx.ContentType("image/png")
-	err = fractal.WriteImage(ctx.ResponseWriter())
+	_, err = output.WriteTo(ctx.ResponseWriter())
 	if err != nil {
 		fmt.Printf("Error: %s\n", err.Error())
 	}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"fmt"
+	"image/color"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/yishakk/fractage/src/fractals"
+	"github.com/yishakk/fractage/src/helpers"
+	"github.com/kataras/iris/v12"
+)
+
+const (
+	LYAPUNOV_MAX_ITERATIONS                = 100_000
+	LYAPUNOV_MAX_SIZE                      = 8192
+	LYAPUNOV_MAX_WORKERS                   = 64
+	LYAPUNOV_DEFAULT_SEQUENCE              = "AB"
+	LYAPUNOV_DEFAULT_WARM_UP               = 100
+	LYAPUNOV_DEFAULT_ITERATIONS            = 400
+	LYAPUNOV_DEFAULT_REGION                = "2.4, 2.9, 1.6, 0.9"
+	LYAPUNOV_DEFAULT_STABLE_COLOR_PALETTE  = "gold"
+	LYAPUNOV_DEFAULT_CHAOTIC_COLOR_PALETTE = "deep_blue"
+)
+
+func GetLyapunov(ctx iris.Context) {
+	query := ctx.Request().URL.Query()
+	fractal := fractals.Lyapunov{
+		Width:      DEFAULT_WIDTH,
+		Height:     DEFAULT_HEIGHT,
+		Map:        fractals.LYAPUNOV_DEFAULT_MAP,
+		Sequence:   LYAPUNOV_DEFAULT_SEQUENCE,
+		WarmUp:     LYAPUNOV_DEFAULT_WARM_UP,
+		Iterations: LYAPUNOV_DEFAULT_ITERATIONS,
+		X0:         fractals.LYAPUNOV_DEFAULT_X0,
+		Alpha:      fractals.LYAPUNOV_DEFAULT_ALPHA,
+		Background: color.RGBA{0, 0, 0, 255},
+		Workers:    runtime.NumCPU(),
+	}
+	stableColorPaletteValue := LYAPUNOV_DEFAULT_STABLE_COLOR_PALETTE
+	chaoticColorPaletteValue := LYAPUNOV_DEFAULT_CHAOTIC_COLOR_PALETTE
+	regionValue := LYAPUNOV_DEFAULT_REGION
+	if query.Has("width") {
+		width, err := strconv.Atoi(query.Get("width"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if width < 1 || width > LYAPUNOV_MAX_SIZE {
+			ctx.Text(fmt.Sprintf("width must be between 1 and %d", LYAPUNOV_MAX_SIZE))
+			return
+		}
+		fractal.Width = width
+	}
+	if query.Has("height") {
+		height, err := strconv.Atoi(query.Get("height"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if height < 1 || height > LYAPUNOV_MAX_SIZE {
+			ctx.Text(fmt.Sprintf("height must be between 1 and %d", LYAPUNOV_MAX_SIZE))
+			return
+		}
+		fractal.Height = height
+	}
+	if query.Has("map") {
+		mapName := query.Get("map")
+		if !fractals.IsValidLyapunovMap(mapName) {
+			ctx.Text("Invalid map")
+			return
+		}
+		fractal.Map = strings.Trim(mapName, helpers.WHITESPACE_CUTSET)
+	}
+	if query.Has("sequence") {
+		sequence := strings.ToUpper(query.Get("sequence"))
+		if !fractals.IsValidLyapunovSequence(sequence) {
+			ctx.Text("Invalid sequence")
+			return
+		}
+		fractal.Sequence = strings.Trim(sequence, helpers.WHITESPACE_CUTSET)
+	}
+	if query.Has("warm_up") {
+		warmUp, err := strconv.Atoi(query.Get("warm_up"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if warmUp < 0 || warmUp > LYAPUNOV_MAX_ITERATIONS {
+			ctx.Text(fmt.Sprintf("warm_up must be between 0 and %d", LYAPUNOV_MAX_ITERATIONS))
+			return
+		}
+		fractal.WarmUp = warmUp
+	}
+	if query.Has("iterations") {
+		iterations, err := strconv.Atoi(query.Get("iterations"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if iterations < 1 || iterations > LYAPUNOV_MAX_ITERATIONS {
+			ctx.Text(fmt.Sprintf("iterations must be between 1 and %d", LYAPUNOV_MAX_ITERATIONS))
+			return
+		}
+		fractal.Iterations = iterations
+	}
+	if query.Has("x0") {
+		x0, err := strconv.ParseFloat(query.Get("x0"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.X0 = x0
+	}
+	if query.Has("alpha") {
+		alpha, err := strconv.ParseFloat(query.Get("alpha"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Alpha = alpha
+	}
+	if query.Has("region") {
+		regionValue = query.Get("region")
+	}
+	if query.Has("stable_color_palette") {
+		stableColorPaletteValue = query.Get("stable_color_palette")
+	}
+	if query.Has("chaotic_color_palette") {
+		chaoticColorPaletteValue = query.Get("chaotic_color_palette")
+	}
+	if query.Has("background") {
+		background, err := helpers.ParseColor(query.Get("background"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Background = background
+	}
+	if query.Has("workers") {
+		workers, err := strconv.Atoi(query.Get("workers"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if workers < 1 || workers > LYAPUNOV_MAX_WORKERS {
+			ctx.Text(fmt.Sprintf("workers must be between 1 and %d", LYAPUNOV_MAX_WORKERS))
+			return
+		}
+		fractal.Workers = workers
+	}
+	region, err := helpers.ParseRect(regionValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	stableColorPalette, err := helpers.ParseColorPalette(stableColorPaletteValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	chaoticColorPalette, err := helpers.ParseColorPalette(chaoticColorPaletteValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	fractal.Region = region
+	fractal.StableColorPalette = stableColorPalette
+	fractal.ChaoticColorPalette = chaoticColorPalette
+	ctx.ContentType("image/png")
+	err = fractal.WriteImage(ctx.ResponseWriter())
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+	}
+}
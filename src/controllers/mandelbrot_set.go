@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"bytes"
 	"fmt"
 	"image/color"
 	"strconv"
@@ -17,20 +18,29 @@ const (
 	MANDELBROT_SET_DEFAULT_BAIL_OUT      = 20
 	MANDELBROT_SET_DEFAULT_M             = 2
 	MANDELBROT_SET_DEFAULT_REGION        = "-2, -1.25, 3.25, 2.5"
+	MANDELBROT_SET_DEFAULT_COLORING      = fractals.ESCAPE_TIME_COLORING_ESCAPE_COUNT
+	MANDELBROT_SET_DEFAULT_RADIUS        = 1.25
+	MANDELBROT_SET_DEFAULT_VARIANT       = fractals.MANDELBROT_VARIANT_CLASSIC
 )
 
 func GetMandelbrotSet(ctx iris.Context) {
 	query := ctx.Request().URL.Query()
 	fractal := fractals.MandelbrotSet{
-		Width:         DEFAULT_WIDTH,
-		Height:        DEFAULT_HEIGHT,
-		MaxIterations: MANDELBROT_SET_DEFAULT_ITERATIONS,
-		M:             MANDELBROT_SET_DEFAULT_M,
-		BailOut:       MANDELBROT_SET_DEFAULT_BAIL_OUT,
-		Background:    color.RGBA{255, 255, 255, 255},
+		Width:               DEFAULT_WIDTH,
+		Height:              DEFAULT_HEIGHT,
+		MaxIterations:       MANDELBROT_SET_DEFAULT_ITERATIONS,
+		M:                   MANDELBROT_SET_DEFAULT_M,
+		BailOut:             MANDELBROT_SET_DEFAULT_BAIL_OUT,
+		Coloring:            MANDELBROT_SET_DEFAULT_COLORING,
+		DistanceThickness:   fractals.DISTANCE_ESTIMATE_DEFAULT_THICKNESS,
+		Precision:           fractals.PRECISION_AUTO,
+		SeriesApproximation: true,
+		Variant:             MANDELBROT_SET_DEFAULT_VARIANT,
+		Background:          color.RGBA{255, 255, 255, 255},
 	}
 	colorPaletteValue := MANDELBROT_SET_DEFAULT_COLOR_PALETTE
 	regionValue := MANDELBROT_SET_DEFAULT_REGION
+	radius := MANDELBROT_SET_DEFAULT_RADIUS
 	if query.Has("width") {
 		width, err := strconv.Atoi(query.Get("width"))
 		if err != nil {
@@ -63,16 +73,61 @@ func GetMandelbrotSet(ctx iris.Context) {
 		fractal.MaxIterations = iterations
 	}
 	if query.Has("m") {
-		m, err := strconv.ParseFloat(query.Get("m"), 64)
+		m, err := strconv.ParseComplex(query.Get("m"), 128)
 		if err != nil {
 			ctx.Text(err.Error())
 			return
 		}
-		fractal.M = m
+		fractal.M = real(m)
+		fractal.MImag = imag(m)
+	}
+	if query.Has("variant") {
+		variant := query.Get("variant")
+		if !fractals.IsValidMandelbrotVariant(variant) {
+			ctx.Text("Invalid variant")
+			return
+		}
+		fractal.Variant = variant
 	}
 	if query.Has("region") {
 		regionValue = query.Get("region")
 	}
+	if query.Has("center") {
+		center, err := helpers.ParseBigPoint(query.Get("center"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Center = &center
+	}
+	if query.Has("radius") {
+		value, err := strconv.ParseFloat(query.Get("radius"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if value <= 0 {
+			ctx.Text("radius must be greater than 0")
+			return
+		}
+		radius = value
+	}
+	if query.Has("precision") {
+		precision := query.Get("precision")
+		if !fractals.IsValidPrecision(precision) {
+			ctx.Text("Invalid precision")
+			return
+		}
+		fractal.Precision = precision
+	}
+	if query.Has("series_approximation") {
+		seriesApproximation, err := strconv.ParseBool(query.Get("series_approximation"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.SeriesApproximation = seriesApproximation
+	}
 	if query.Has("bail_out") {
 		bailOut, err := strconv.ParseFloat(query.Get("bail_out"), 32)
 		if err != nil {
@@ -81,6 +136,53 @@ func GetMandelbrotSet(ctx iris.Context) {
 		}
 		fractal.BailOut = bailOut
 	}
+	if query.Has("coloring") {
+		coloring := query.Get("coloring")
+		if !fractals.IsValidEscapeTimeColoring(coloring) {
+			ctx.Text("Invalid coloring")
+			return
+		}
+		fractal.Coloring = coloring
+	}
+	if fractal.Coloring == fractals.ESCAPE_TIME_COLORING_ORBIT_TRAP {
+		orbitTrap, err := parseOrbitTrap(query)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.OrbitTrap = orbitTrap
+	}
+	if query.Has("boundary_thickness") {
+		thickness, err := strconv.ParseFloat(query.Get("boundary_thickness"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if thickness <= 0 {
+			ctx.Text("boundary_thickness must be greater than 0")
+			return
+		}
+		fractal.DistanceThickness = thickness
+	}
+	if query.Has("anti_alias") {
+		antiAlias, err := strconv.ParseBool(query.Get("anti_alias"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.AntiAlias = antiAlias
+	}
+	formula, parameters, err := parseFormula(query, fractal.Coloring, fractal.Precision)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	if formula != "" && fractal.Variant != fractals.MANDELBROT_VARIANT_CLASSIC {
+		ctx.Text("Formulas can't be combined with variants")
+		return
+	}
+	fractal.Formula = formula
+	fractal.Parameters = parameters
 	if query.Has("background") {
 		background, err := helpers.ParseColor(query.Get("background"))
 		if err != nil {
@@ -89,11 +191,20 @@ func GetMandelbrotSet(ctx iris.Context) {
 		}
 		fractal.Background = background
 	}
-	region, err := helpers.ParseRect(regionValue)
+	exactRegion, err := helpers.ParseBigRect(regionValue)
 	if err != nil {
 		ctx.Text(err.Error())
 		return
 	}
+	region := exactRegion.Rect()
+	if fractal.Center == nil {
+		center := exactRegion.Center()
+		fractal.Center = &center
+	} else {
+		x, _ := fractal.Center.X.Float64()
+		y, _ := fractal.Center.Y.Float64()
+		region = helpers.Rect{X: x - radius, Y: y - radius, Width: 2 * radius, Height: 2 * radius}
+	}
 	colorPalette, err := helpers.ParseColorPalette(colorPaletteValue)
 	if err != nil {
 		ctx.Text(err.Error())
@@ -101,8 +212,20 @@ func GetMandelbrotSet(ctx iris.Context) {
 	}
 	fractal.Region = region
 	fractal.ColorPalette = colorPalette
+	// the image is buffered so that the stats of the render can be sent in
+	// the headers
+	var output bytes.Buffer
+	err = fractal.WriteImage(&output)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+		return
+	}
+	if fractal.Stats.Measured {
+		ctx.Header("X-Iterations", strconv.FormatInt(fractal.Stats.Iterations, 10))
+		ctx.Header("X-Iterations-Saved", strconv.FormatInt(fractal.Stats.IterationsSaved, 10))
+	}
 	ctx.ContentType("image/png")
-	err = fractal.WriteImage(ctx.ResponseWriter())
+	_, err = output.WriteTo(ctx.ResponseWriter())
 	if err != nil {
 		fmt.Printf("Error: %s\n", err.Error())
 	}
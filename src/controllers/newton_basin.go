@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"image/color"
 	"strconv"
+	"strings"
 
 	"github.com/yishakk/fractage/src/fractals"
 	"github.com/yishakk/fractage/src/helpers"
@@ -15,20 +16,32 @@ const (
 	NEWTON_BASIN_MAX_ITERATIONS        = 500_000
 	NEWTON_BASIN_DEFAULT_ITERATIONS    = 32
 	NEWTON_BASIN_DEFAULT_COLOR_PALETTE = "orange_blue"
-	NEWTON_BASIN_DEFAULT_BAIL_OUT      = 1e15
-	NEWTON_BASIN_DEFAULT_POLYNOMIAL    = "-1+x^5"
-	NEWTON_BASIN_DEFAULT_REGION        = "-2, -1.5, 4, 3"
+	// The default palette of the roots coloring, whose roots get colors
+	// from across the palette.
+	NEWTON_BASIN_DEFAULT_ROOTS_COLOR_PALETTE = "hue"
+	NEWTON_BASIN_DEFAULT_COLORING            = fractals.NEWTON_BASIN_COLORING_PHASE
+	NEWTON_BASIN_DEFAULT_BAIL_OUT            = 1e15
+	NEWTON_BASIN_DEFAULT_POLYNOMIAL          = "-1+x^5"
+	NEWTON_BASIN_DEFAULT_REGION              = "-2, -1.5, 4, 3"
+	// The variable of the functions of Newton basins.
+	NEWTON_BASIN_FUNCTION_VARIABLE = "z"
 )
 
 func GetNewtonBasin(ctx iris.Context) {
 	query := ctx.Request().URL.Query()
 	fractal := fractals.NewtonBasin{
-		Width:            DEFAULT_WIDTH,
-		Height:           DEFAULT_HEIGHT,
-		MaxIterations:    NEWTON_BASIN_DEFAULT_ITERATIONS,
-		BailOut:          NEWTON_BASIN_DEFAULT_BAIL_OUT,
-		UseDynamicColors: true,
-		Background:       color.RGBA{255, 255, 255, 255},
+		Width:             DEFAULT_WIDTH,
+		Height:            DEFAULT_HEIGHT,
+		MaxIterations:     NEWTON_BASIN_DEFAULT_ITERATIONS,
+		BailOut:           NEWTON_BASIN_DEFAULT_BAIL_OUT,
+		Coloring:          NEWTON_BASIN_DEFAULT_COLORING,
+		Background:        color.RGBA{255, 255, 255, 255},
+		NonConvergedColor: color.RGBA{0, 0, 0, 255},
+		InvalidColor:      color.RGBA{0, 0, 0, 255},
+		Method:            fractals.NEWTON_BASIN_DEFAULT_METHOD,
+		Tolerance:         fractals.NEWTON_BASIN_DEFAULT_TOLERANCE,
+		Relaxation:        fractals.NEWTON_BASIN_DEFAULT_RELAXATION,
+		HouseholderOrder:  fractals.NEWTON_BASIN_DEFAULT_HOUSEHOLDER_ORDER,
 	}
 	colorPaletteValue := NEWTON_BASIN_DEFAULT_COLOR_PALETTE
 	regionValue := NEWTON_BASIN_DEFAULT_REGION
@@ -49,12 +62,52 @@ func GetNewtonBasin(ctx iris.Context) {
 		}
 		fractal.Height = height
 	}
+	if query.Has("polynomial") && query.Has("function") {
+		ctx.Text("polynomial and function can't be used together")
+		return
+	}
 	if query.Has("polynomial") {
 		polynomialValue = query.Get("polynomial")
 	}
+	if query.Has("function") {
+		function, err := math_helper.ParseComplexExpression(query.Get("function"), []string{NEWTON_BASIN_FUNCTION_VARIABLE})
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Function = function
+	}
 	if query.Has("color_palette") {
 		colorPaletteValue = query.Get("color_palette")
-		fractal.UseDynamicColors = false
+		// palettes color the iterations unless another coloring is given
+		fractal.Coloring = fractals.NEWTON_BASIN_COLORING_ITERATIONS
+	}
+	if query.Has("coloring") {
+		coloring := query.Get("coloring")
+		if !fractals.IsValidNewtonBasinColoring(coloring) {
+			ctx.Text("Invalid coloring")
+			return
+		}
+		fractal.Coloring = strings.Trim(coloring, helpers.WHITESPACE_CUTSET)
+		if fractal.Coloring == fractals.NEWTON_BASIN_COLORING_ROOTS && !query.Has("color_palette") {
+			colorPaletteValue = NEWTON_BASIN_DEFAULT_ROOTS_COLOR_PALETTE
+		}
+	}
+	if query.Has("non_converged_color") {
+		nonConvergedColor, err := helpers.ParseColor(query.Get("non_converged_color"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.NonConvergedColor = nonConvergedColor
+	}
+	if query.Has("invalid_color") {
+		invalidColor, err := helpers.ParseColor(query.Get("invalid_color"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.InvalidColor = invalidColor
 	}
 	if query.Has("iterations") {
 		iterations, err := strconv.Atoi(query.Get("iterations"))
@@ -79,6 +132,54 @@ func GetNewtonBasin(ctx iris.Context) {
 		}
 		fractal.BailOut = bailOut
 	}
+	if query.Has("method") {
+		method := query.Get("method")
+		if !fractals.IsValidNewtonMethod(method) {
+			ctx.Text("Invalid method")
+			return
+		}
+		fractal.Method = strings.Trim(method, helpers.WHITESPACE_CUTSET)
+	}
+	if query.Has("a") {
+		relaxation, err := strconv.ParseComplex(query.Get("a"), 128)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if relaxation == 0 {
+			ctx.Text("a must not be 0")
+			return
+		}
+		fractal.Relaxation = relaxation
+	}
+	if query.Has("order") {
+		order, err := strconv.Atoi(query.Get("order"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		maxOrder := fractals.NEWTON_BASIN_MAX_HOUSEHOLDER_ORDER
+		if fractal.Function != nil {
+			maxOrder = fractals.NEWTON_BASIN_MAX_FUNCTION_HOUSEHOLDER_ORDER
+		}
+		if order < 1 || order > maxOrder {
+			ctx.Text(fmt.Sprintf("order must be between 1 and %d", maxOrder))
+			return
+		}
+		fractal.HouseholderOrder = order
+	}
+	if query.Has("tolerance") {
+		tolerance, err := strconv.ParseFloat(query.Get("tolerance"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if tolerance <= 0 {
+			ctx.Text("tolerance must be greater than 0")
+			return
+		}
+		fractal.Tolerance = tolerance
+	}
 	if query.Has("background") {
 		background, err := helpers.ParseColor(query.Get("background"))
 		if err != nil {
@@ -92,12 +193,36 @@ func GetNewtonBasin(ctx iris.Context) {
 		ctx.Text(err.Error())
 		return
 	}
-	polynomial, err := math_helper.ParseCmplxPolynomial(polynomialValue)
-	if err != nil {
-		ctx.Text(err.Error())
-		return
+	if fractal.Function != nil {
+		// functions that can be differentiated once can be differentiated
+		// as many times as the methods need, so this is checked before the
+		// image is started
+		_, err = fractal.Function.Derivative(NEWTON_BASIN_FUNCTION_VARIABLE)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+	} else {
+		polynomial, err := math_helper.ParseCmplxPolynomial(polynomialValue)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Polynomial = polynomial
+		roots, err := fractals.NewtonBasinRoots(polynomial)
+		if err != nil && fractal.Coloring == fractals.NEWTON_BASIN_COLORING_ROOTS {
+			ctx.Text(err.Error())
+			return
+		}
+		if err == nil {
+			rootValues := make([]string, len(roots))
+			for i, root := range roots {
+				rootValues[i] = strings.Trim(strconv.FormatComplex(root, 'g', -1, 128), "()")
+			}
+			fractal.Roots = roots
+			ctx.Header("X-Roots", strings.Join(rootValues, ", "))
+		}
 	}
-	fractal.Polynomial = polynomial
 	colorPalette, err := helpers.ParseColorPalette(colorPaletteValue)
 	if err != nil {
 		ctx.Text(err.Error())
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/yishakk/fractage/src/fractals"
+	"github.com/yishakk/fractage/src/helpers"
+	math_helper "github.com/yishakk/fractage/src/helpers/math"
+	"github.com/kataras/iris/v12"
+)
+
+const (
+	NOVA_MAX_ITERATIONS            = 500_000
+	NOVA_DEFAULT_ITERATIONS        = 64
+	NOVA_DEFAULT_MODE              = fractals.NOVA_MODE_MANDELBROT
+	NOVA_DEFAULT_COLOR_PALETTE     = "multi_colored"
+	NOVA_DEFAULT_COLORING          = fractals.NEWTON_BASIN_COLORING_ITERATIONS
+	NOVA_DEFAULT_BAIL_OUT          = 1e15
+	NOVA_DEFAULT_POLYNOMIAL        = "z^3-1"
+	NOVA_DEFAULT_C                 = -0.4 + 0.05i
+	NOVA_DEFAULT_JULIA_REGION      = "-2, -1.5, 4, 3"
+	NOVA_DEFAULT_MANDELBROT_REGION = "-2, -1.5, 3.5, 3"
+)
+
+func GetNova(ctx iris.Context) {
+	query := ctx.Request().URL.Query()
+	fractal := fractals.Nova{
+		Width:         DEFAULT_WIDTH,
+		Height:        DEFAULT_HEIGHT,
+		MaxIterations: NOVA_DEFAULT_ITERATIONS,
+		Mode:          NOVA_DEFAULT_MODE,
+		Relaxation:    fractals.NOVA_DEFAULT_RELAXATION,
+		C:             NOVA_DEFAULT_C,
+		BailOut:       NOVA_DEFAULT_BAIL_OUT,
+		Tolerance:     fractals.NOVA_DEFAULT_TOLERANCE,
+		Coloring:      NOVA_DEFAULT_COLORING,
+		Background:    color.RGBA{0, 0, 0, 255},
+	}
+	colorPaletteValue := NOVA_DEFAULT_COLOR_PALETTE
+	regionValue := ""
+	polynomialValue := NOVA_DEFAULT_POLYNOMIAL
+	criticalPoint := -1
+	if query.Has("width") {
+		width, err := strconv.Atoi(query.Get("width"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Width = width
+	}
+	if query.Has("height") {
+		height, err := strconv.Atoi(query.Get("height"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Height = height
+	}
+	if query.Has("mode") {
+		mode := query.Get("mode")
+		if !fractals.IsValidNovaMode(mode) {
+			ctx.Text("Invalid mode")
+			return
+		}
+		fractal.Mode = strings.Trim(mode, helpers.WHITESPACE_CUTSET)
+	}
+	if query.Has("polynomial") {
+		polynomialValue = query.Get("polynomial")
+	}
+	if query.Has("a") {
+		relaxation, err := strconv.ParseComplex(query.Get("a"), 128)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if relaxation == 0 {
+			ctx.Text("a must not be 0")
+			return
+		}
+		fractal.Relaxation = relaxation
+	}
+	if query.Has("c") {
+		c, err := strconv.ParseComplex(query.Get("c"), 128)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.C = c
+	}
+	if query.Has("z0") && query.Has("critical_point") {
+		ctx.Text("z0 and critical_point can't be used together")
+		return
+	}
+	if query.Has("z0") {
+		z0, err := strconv.ParseComplex(query.Get("z0"), 128)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Z0 = z0
+	}
+	if query.Has("critical_point") {
+		index, err := strconv.Atoi(query.Get("critical_point"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if index < 0 {
+			ctx.Text("critical_point must not be negative")
+			return
+		}
+		criticalPoint = index
+	}
+	if query.Has("color_palette") {
+		colorPaletteValue = query.Get("color_palette")
+	}
+	if query.Has("coloring") {
+		coloring := query.Get("coloring")
+		if !fractals.IsValidNovaColoring(coloring) {
+			ctx.Text("Invalid coloring")
+			return
+		}
+		fractal.Coloring = strings.Trim(coloring, helpers.WHITESPACE_CUTSET)
+	}
+	if query.Has("iterations") {
+		iterations, err := strconv.Atoi(query.Get("iterations"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if iterations < 0 || iterations > NOVA_MAX_ITERATIONS {
+			ctx.Text(fmt.Sprintf("Too many iterations. Max: %d\n", NOVA_MAX_ITERATIONS))
+			return
+		}
+		fractal.MaxIterations = iterations
+	}
+	if query.Has("region") {
+		regionValue = query.Get("region")
+	}
+	if query.Has("bail_out") {
+		bailOut, err := strconv.ParseFloat(query.Get("bail_out"), 32)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.BailOut = bailOut
+	}
+	if query.Has("tolerance") {
+		tolerance, err := strconv.ParseFloat(query.Get("tolerance"), 64)
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		if tolerance <= 0 {
+			ctx.Text("tolerance must be greater than 0")
+			return
+		}
+		fractal.Tolerance = tolerance
+	}
+	if query.Has("background") {
+		background, err := helpers.ParseColor(query.Get("background"))
+		if err != nil {
+			ctx.Text(err.Error())
+			return
+		}
+		fractal.Background = background
+	}
+	if regionValue == "" {
+		regionValue = NOVA_DEFAULT_MANDELBROT_REGION
+		if fractal.Mode == fractals.NOVA_MODE_JULIA {
+			regionValue = NOVA_DEFAULT_JULIA_REGION
+		}
+	}
+	region, err := helpers.ParseRect(regionValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	polynomial, err := math_helper.ParseCmplxPolynomial(polynomialValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	fractal.Polynomial = polynomial
+	// the mandelbrot mode starts at the critical point with the largest real
+	// part unless another starting point is given
+	needsCriticalPoint := criticalPoint >= 0 || (fractal.Mode == fractals.NOVA_MODE_MANDELBROT && !query.Has("z0"))
+	criticalPoints, err := fractals.NovaCriticalPoints(polynomial, fractal.Relaxation)
+	if err != nil && needsCriticalPoint {
+		ctx.Text(err.Error())
+		return
+	}
+	if err == nil {
+		pointValues := make([]string, len(criticalPoints))
+		for i, point := range criticalPoints {
+			pointValues[i] = strings.Trim(strconv.FormatComplex(point, 'g', -1, 128), "()")
+		}
+		ctx.Header("X-Critical-Points", strings.Join(pointValues, ", "))
+	}
+	if needsCriticalPoint {
+		if len(criticalPoints) == 0 {
+			ctx.Text("The step has no critical points")
+			return
+		}
+		if criticalPoint < 0 {
+			criticalPoint = len(criticalPoints) - 1
+		}
+		if criticalPoint >= len(criticalPoints) {
+			ctx.Text(fmt.Sprintf("critical_point must be between 0 and %d", len(criticalPoints)-1))
+			return
+		}
+		fractal.Z0 = criticalPoints[criticalPoint]
+	}
+	colorPalette, err := helpers.ParseColorPalette(colorPaletteValue)
+	if err != nil {
+		ctx.Text(err.Error())
+		return
+	}
+	fractal.Region = region
+	fractal.ColorPalette = colorPalette
+	ctx.ContentType("image/png")
+	err = fractal.WriteImage(ctx.ResponseWriter())
+	if err != nil {
+		fmt.Printf("Error: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/yishakk/fractage/src/fractals"
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+// Retrieves the orbit trap of an escape-time fractal from the query parameters.
+func parseOrbitTrap(query url.Values) (*fractals.OrbitTrap, error) {
+	trap := fractals.OrbitTrap{
+		Shape: fractals.ORBIT_TRAP_DEFAULT_SHAPE,
+		Size:  fractals.ORBIT_TRAP_DEFAULT_SIZE,
+		Mode:  fractals.ORBIT_TRAP_DEFAULT_MODE,
+	}
+	if query.Has("trap") {
+		trap.Shape = query.Get("trap")
+	}
+	if query.Has("trap_center") {
+		center, err := strconv.ParseComplex(query.Get("trap_center"), 128)
+		if err != nil {
+			return nil, err
+		}
+		trap.Center = center
+	}
+	if query.Has("trap_size") {
+		size, err := strconv.ParseFloat(query.Get("trap_size"), 64)
+		if err != nil {
+			return nil, err
+		}
+		trap.Size = size
+	}
+	if query.Has("trap_angle") {
+		angle, err := strconv.ParseFloat(query.Get("trap_angle"), 64)
+		if err != nil {
+			return nil, err
+		}
+		trap.Angle = angle
+	}
+	if query.Has("trap_mode") {
+		trap.Mode = query.Get("trap_mode")
+	}
+	if query.Has("trap_image") {
+		img, err := helpers.ParseDataURIImage(query.Get("trap_image"))
+		if err != nil {
+			return nil, err
+		}
+		trap.Image = img
+	}
+	err := trap.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &trap, nil
+}
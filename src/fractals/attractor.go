@@ -0,0 +1,283 @@
+package fractals
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+const (
+	ATTRACTOR_TYPE_CLIFFORD      = "clifford"
+	ATTRACTOR_TYPE_DE_JONG       = "de_jong"
+	ATTRACTOR_TYPE_IKEDA         = "ikeda"
+	ATTRACTOR_TYPE_TINKERBELL    = "tinkerbell"
+	ATTRACTOR_TYPE_GUMOWSKI_MIRA = "gumowski_mira"
+
+	ATTRACTOR_COLORING_DENSITY   = "density"
+	ATTRACTOR_COLORING_DIRECTION = "direction"
+
+	// The iterations that are skipped before the orbit is on the attractor.
+	ATTRACTOR_TRANSIENT_ITERATIONS = 1000
+	// The default fraction of the fitted bounds that is added around them.
+	ATTRACTOR_FIT_MARGIN = 0.05
+	// By default, the fitted bounds hold all of the points.
+	ATTRACTOR_FIT_PERCENTILE = 100
+)
+
+var (
+	ATTRACTOR_TYPES = map[string]func(props *Attractor, xIn, yIn float64) (xOut, yOut float64){
+		ATTRACTOR_TYPE_CLIFFORD:      clifford_attractor,
+		ATTRACTOR_TYPE_DE_JONG:       de_jong_attractor,
+		ATTRACTOR_TYPE_IKEDA:         ikeda_attractor,
+		ATTRACTOR_TYPE_TINKERBELL:    tinkerbell_attractor,
+		ATTRACTOR_TYPE_GUMOWSKI_MIRA: gumowski_mira_attractor,
+	}
+	// The coefficients a, b, c and d and the starting point of each type,
+	// which have well-known attractors.
+	ATTRACTOR_DEFAULTS = map[string]struct {
+		Coefficients [4]float64
+		X, Y         float64
+	}{
+		ATTRACTOR_TYPE_CLIFFORD:      {Coefficients: [4]float64{-1.4, 1.6, 1.0, 0.7}, X: 0.1, Y: 0.1},
+		ATTRACTOR_TYPE_DE_JONG:       {Coefficients: [4]float64{1.641, 1.902, 0.316, 1.525}, X: 0.1, Y: 0.1},
+		ATTRACTOR_TYPE_IKEDA:         {Coefficients: [4]float64{0.9, 0, 0, 0}, X: 0.1, Y: 0.1},
+		ATTRACTOR_TYPE_TINKERBELL:    {Coefficients: [4]float64{0.9, -0.6013, 2.0, 0.5}, X: -0.72, Y: -0.64},
+		ATTRACTOR_TYPE_GUMOWSKI_MIRA: {Coefficients: [4]float64{0.008, 0.05, -0.496, 0}, X: 0.1, Y: 0.1},
+	}
+	ATTRACTOR_COLORINGS = []string{
+		ATTRACTOR_COLORING_DENSITY,
+		ATTRACTOR_COLORING_DIRECTION,
+	}
+)
+
+// Properties of a strange attractor image, which is the density of the
+// points of an orbit of a two-dimensional map.
+type Attractor struct {
+	Width        int
+	Height       int
+	ColorPalette helpers.ColorPalette
+	Type         string
+	A            float64
+	B            float64
+	C            float64
+	D            float64
+	// The starting point of the orbit.
+	X float64
+	Y float64
+	// The number of points of the orbit that are plotted.
+	Points int
+	// The number of points of the orbit that FitRegion finds the bounds of.
+	FitPoints int
+	// The percentage of the points that FitRegion keeps inside the bounds on
+	// each axis, which ignores the outliers.
+	FitPercentile float64
+	// The fraction of the larger side of the fitted bounds that is added
+	// around them.
+	FitMargin float64
+	// The region of the plane to display.
+	Region      helpers.Rect
+	ToneMapping string
+	Gamma       float64
+	// density colors the pixels by their density, and direction colors them
+	// by the direction of the last step of the orbit that landed on them,
+	// with the angle of the step as the position of the palette.
+	Coloring   string
+	Background color.RGBA
+}
+
+// Checks if a name exists in the set of ATTRACTOR_TYPES names.
+func IsValidAttractorType(txt string) bool {
+	attractorType := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	_, found := ATTRACTOR_TYPES[attractorType]
+	return found
+}
+
+// Checks if a name exists in the set of ATTRACTOR_COLORINGS.
+func IsValidAttractorColoring(txt string) bool {
+	coloringName := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	for _, coloring := range ATTRACTOR_COLORINGS {
+		if coloring == coloringName {
+			return true
+		}
+	}
+	return false
+}
+
+// Finds the bounds of the first FitPoints points of the orbit after the
+// transient iterations, with a margin around them.
+func (props *Attractor) FitRegion() (helpers.Rect, error) {
+	step, found := ATTRACTOR_TYPES[props.Type]
+	if !found {
+		return helpers.EMPTY_REGION, errors.New("Invalid type")
+	}
+	x, y, err := props.skipTransient(step)
+	if err != nil {
+		return helpers.EMPTY_REGION, err
+	}
+	xs, ys := make([]float64, props.FitPoints), make([]float64, props.FitPoints)
+	for i := 0; i < props.FitPoints; i++ {
+		x, y = step(props, x, y)
+		if !isFinitePoint(x, y) {
+			return helpers.EMPTY_REGION, errors.New("The orbit escapes to infinity")
+		}
+		xs[i], ys[i] = x, y
+	}
+	return fitOrbitBounds(xs, ys, props.FitPercentile, props.FitMargin)
+}
+
+// Writes the attractor image to the given output.
+func (props *Attractor) WriteImage(output io.Writer) error {
+	viewport := image.Rect(0, 0, props.Width, props.Height)
+	img := image.NewRGBA(viewport)
+	helpers.FillImage(img, props.Background)
+	err := props.render(img)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(output, img)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Helper function for rendering the attractor. Pixels that the orbit never
+// lands on keep the background.
+func (props *Attractor) render(img *image.RGBA) error {
+	step, found := ATTRACTOR_TYPES[props.Type]
+	if !found {
+		return errors.New("Invalid type")
+	}
+	toneMapping, found := TONE_MAPPINGS[props.ToneMapping]
+	if !found {
+		return errors.New("Invalid tone mapping")
+	}
+	err := props.ColorPalette.TranslateColorTransitions()
+	if err != nil {
+		return err
+	}
+	x, y, err := props.skipTransient(step)
+	if err != nil {
+		return err
+	}
+	width, height := float64(props.Width), float64(props.Height)
+	scale := math.Max(props.Region.Width/width, props.Region.Height/height)
+	xOffset := props.Region.X - (width*scale-props.Region.Width)/2.0
+	yOffset := props.Region.Y - (height*scale-props.Region.Height)/2.0
+	direction := strings.Trim(props.Coloring, helpers.WHITESPACE_CUTSET) == ATTRACTOR_COLORING_DIRECTION
+	histogram := make(densityHistogram, props.Width*props.Height)
+	var angles []float64
+	if direction {
+		angles = make([]float64, len(histogram))
+	}
+	for i := 0; i < props.Points; i++ {
+		xn, yn := step(props, x, y)
+		if !isFinitePoint(xn, yn) {
+			break
+		}
+		px := int(math.Floor((xn - xOffset) / scale))
+		py := int(math.Floor((yn - yOffset) / scale))
+		if px >= 0 && px < props.Width && py >= 0 && py < props.Height {
+			index := py*props.Width + px
+			histogram[index]++
+			if direction {
+				angles[index] = math.Atan2(yn-y, xn-x)
+			}
+		}
+		x, y = xn, yn
+	}
+	maxCount := 0.0
+	for _, count := range histogram {
+		maxCount = math.Max(maxCount, float64(count))
+	}
+	for py := 0; py < props.Height; py++ {
+		for px := 0; px < props.Width; px++ {
+			index := py*props.Width + px
+			if histogram[index] == 0 {
+				continue
+			}
+			brightness := toneMapping(float64(histogram[index]), maxCount, props.Gamma)
+			if !direction {
+				pixelColor, err := props.ColorPalette.GetColor(brightness)
+				if err != nil {
+					return err
+				}
+				img.Set(px, py, pixelColor)
+				continue
+			}
+			pixelColor, err := props.ColorPalette.GetColor((angles[index] + math.Pi) / (2 * math.Pi))
+			if err != nil {
+				return err
+			}
+			img.Set(px, py, blendColors(props.Background, pixelColor, brightness))
+		}
+	}
+	return nil
+}
+
+// Iterates the orbit past its transient iterations.
+func (props *Attractor) skipTransient(step func(props *Attractor, xIn, yIn float64) (xOut, yOut float64)) (x, y float64, err error) {
+	x, y = props.X, props.Y
+	for i := 0; i < ATTRACTOR_TRANSIENT_ITERATIONS; i++ {
+		x, y = step(props, x, y)
+		if !isFinitePoint(x, y) {
+			return 0, 0, errors.New("The orbit escapes to infinity")
+		}
+	}
+	return x, y, nil
+}
+
+func isFinitePoint(x, y float64) bool {
+	return !math.IsInf(x, 0) && !math.IsNaN(x) && !math.IsInf(y, 0) && !math.IsNaN(y)
+}
+
+// Mixes two colors, with t = 0 for the first one and t = 1 for the second.
+func blendColors(from, to color.RGBA, t float64) color.RGBA {
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round((1-t)*float64(a) + t*float64(b)))
+	}
+	return color.RGBA{R: mix(from.R, to.R), G: mix(from.G, to.G), B: mix(from.B, to.B), A: 255}
+}
+
+func clifford_attractor(props *Attractor, xIn, yIn float64) (xOut, yOut float64) {
+	xOut = math.Sin(props.A*yIn) + props.C*math.Cos(props.A*xIn)
+	yOut = math.Sin(props.B*xIn) + props.D*math.Cos(props.B*yIn)
+	return
+}
+
+func de_jong_attractor(props *Attractor, xIn, yIn float64) (xOut, yOut float64) {
+	xOut = math.Sin(props.A*yIn) - math.Cos(props.B*xIn)
+	yOut = math.Sin(props.C*xIn) - math.Cos(props.D*yIn)
+	return
+}
+
+// The Ikeda map, whose parameter u is a.
+func ikeda_attractor(props *Attractor, xIn, yIn float64) (xOut, yOut float64) {
+	t := 0.4 - 6/(1+xIn*xIn+yIn*yIn)
+	sin, cos := math.Sincos(t)
+	xOut = 1 + props.A*(xIn*cos-yIn*sin)
+	yOut = props.A * (xIn*sin + yIn*cos)
+	return
+}
+
+func tinkerbell_attractor(props *Attractor, xIn, yIn float64) (xOut, yOut float64) {
+	xOut = xIn*xIn - yIn*yIn + props.A*xIn + props.B*yIn
+	yOut = 2*xIn*yIn + props.C*xIn + props.D*yIn
+	return
+}
+
+// The Gumowski-Mira map, whose parameter mu is c.
+func gumowski_mira_attractor(props *Attractor, xIn, yIn float64) (xOut, yOut float64) {
+	f := func(x float64) float64 {
+		return props.C*x + 2*(1-props.C)*x*x/(1+x*x)
+	}
+	xOut = yIn + props.A*(1-props.B*yIn*yIn)*yIn + f(xIn)
+	yOut = -xIn + f(xOut)
+	return
+}
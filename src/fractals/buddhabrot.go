@@ -0,0 +1,267 @@
+package fractals
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+const (
+	BUDDHABROT_MODE_BUDDHABROT = "buddhabrot"
+	BUDDHABROT_MODE_ANTI       = "anti"
+	BUDDHABROT_MODE_NEBULABROT = "nebulabrot"
+
+	TONE_MAPPING_LINEAR = "linear"
+	TONE_MAPPING_LOG    = "log"
+	TONE_MAPPING_SQRT   = "sqrt"
+	TONE_MAPPING_GAMMA  = "gamma"
+
+	// Orbits escape once |z| is greater than this value.
+	BUDDHABROT_BAIL_OUT = 2
+	// The most memory that the histograms of all of the workers can use,
+	// which lowers the number of workers of large images.
+	BUDDHABROT_MAX_HISTOGRAM_BYTES = 1 << 30
+)
+
+var (
+	BUDDHABROT_MODES = []string{
+		BUDDHABROT_MODE_BUDDHABROT,
+		BUDDHABROT_MODE_ANTI,
+		BUDDHABROT_MODE_NEBULABROT,
+	}
+	// Maps the visits of a pixel to a brightness between 0 and 1, given the
+	// visits of the most visited pixel.
+	TONE_MAPPINGS = map[string]func(count, maxCount, gamma float64) float64{
+		TONE_MAPPING_LINEAR: func(count, maxCount, gamma float64) float64 {
+			return count / maxCount
+		},
+		TONE_MAPPING_LOG: func(count, maxCount, gamma float64) float64 {
+			return math.Log1p(count) / math.Log1p(maxCount)
+		},
+		TONE_MAPPING_SQRT: func(count, maxCount, gamma float64) float64 {
+			return math.Sqrt(count / maxCount)
+		},
+		TONE_MAPPING_GAMMA: func(count, maxCount, gamma float64) float64 {
+			return math.Pow(count/maxCount, 1/gamma)
+		},
+	}
+	// The area of the complex plane that points are sampled from, which
+	// contains the Mandelbrot set.
+	BUDDHABROT_SAMPLE_REGION = helpers.Rect{X: -2, Y: -2, Width: 4, Height: 4}
+)
+
+// Properties of a Buddhabrot image.
+type Buddhabrot struct {
+	Width        int
+	Height       int
+	ColorPalette helpers.ColorPalette
+	Mode         string
+	// The maximum number of iterations of the buddhabrot and anti modes.
+	MaxIterations int
+	// Orbits that escape in fewer iterations are ignored by the buddhabrot
+	// mode.
+	MinIterations int
+	// The maximum numbers of iterations of the red, green and blue channels
+	// of the nebulabrot mode.
+	ChannelIterations [3]int
+	// The number of points sampled.
+	Samples int
+	// The seed of the random points, which makes images reproducible.
+	Seed int64
+	// The number of goroutines that sample points.
+	Workers     int
+	Region      helpers.Rect
+	ToneMapping string
+	Gamma       float64
+}
+
+// Counts the visits of the orbits to each pixel.
+type densityHistogram []uint32
+
+// Checks if a name exists in the set of BUDDHABROT_MODES names.
+func IsValidBuddhabrotMode(txt string) bool {
+	mode := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	for _, name := range BUDDHABROT_MODES {
+		if name == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if a name exists in the set of TONE_MAPPINGS names.
+func IsValidToneMapping(txt string) bool {
+	toneMapping := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	_, found := TONE_MAPPINGS[toneMapping]
+	return found
+}
+
+// Writes the Buddhabrot image to the given output.
+func (props *Buddhabrot) WriteImage(output io.Writer) error {
+	viewport := image.Rect(0, 0, props.Width, props.Height)
+	img := image.NewRGBA(viewport)
+	err := props.render(img)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(output, img)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Helper function for rendering the Buddhabrot. Every pixel is colored by
+// its density, so the image has no background.
+func (props *Buddhabrot) render(img *image.RGBA) error {
+	toneMapping, found := TONE_MAPPINGS[props.ToneMapping]
+	if !found {
+		return errors.New("Invalid tone mapping")
+	}
+	limits := []int{props.MaxIterations}
+	if props.Mode == BUDDHABROT_MODE_NEBULABROT {
+		limits = props.ChannelIterations[:]
+	}
+	histograms := props.sample(limits)
+	if props.Mode != BUDDHABROT_MODE_NEBULABROT {
+		err := props.ColorPalette.TranslateColorTransitions()
+		if err != nil {
+			return err
+		}
+	}
+	maxCounts := make([]float64, len(histograms))
+	for i, histogram := range histograms {
+		for _, count := range histogram {
+			maxCounts[i] = math.Max(maxCounts[i], float64(count))
+		}
+	}
+	brightness := func(channel, index int) float64 {
+		if maxCounts[channel] == 0 {
+			return 0
+		}
+		return toneMapping(float64(histograms[channel][index]), maxCounts[channel], props.Gamma)
+	}
+	for y := 0; y < props.Height; y++ {
+		for x := 0; x < props.Width; x++ {
+			index := y*props.Width + x
+			if props.Mode == BUDDHABROT_MODE_NEBULABROT {
+				img.Set(x, y, color.RGBA{
+					R: uint8(math.Round(255 * brightness(0, index))),
+					G: uint8(math.Round(255 * brightness(1, index))),
+					B: uint8(math.Round(255 * brightness(2, index))),
+					A: 255,
+				})
+				continue
+			}
+			pixelColor, err := props.ColorPalette.GetColor(brightness(0, index))
+			if err != nil {
+				return err
+			}
+			img.Set(x, y, pixelColor)
+		}
+	}
+	return nil
+}
+
+// Samples the points on props.Workers goroutines and merges their histograms,
+// which have one channel for each of the iteration limits. Each worker has
+// its own histograms, so there are only as many workers as there are
+// histograms that fit in BUDDHABROT_MAX_HISTOGRAM_BYTES.
+func (props *Buddhabrot) sample(limits []int) []densityHistogram {
+	// the counts are uint32s
+	histogramBytes := math.Max(1, float64(4*len(limits)*props.Width*props.Height))
+	maxWorkers := math.Floor(BUDDHABROT_MAX_HISTOGRAM_BYTES / histogramBytes)
+	workers := int(math.Max(1, math.Min(float64(props.Workers), maxWorkers)))
+	results := make([][]densityHistogram, workers)
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		// the samples are split evenly so that the image only depends on the
+		// seed and the number of workers
+		samples := props.Samples / workers
+		if worker < props.Samples%workers {
+			samples++
+		}
+		wg.Add(1)
+		go func(worker, samples int) {
+			defer wg.Done()
+			random := rand.New(rand.NewSource(props.Seed + int64(worker)))
+			results[worker] = props.sampleOrbits(random, samples, limits)
+		}(worker, samples)
+	}
+	wg.Wait()
+	histograms := results[0]
+	for _, result := range results[1:] {
+		for channel := range histograms {
+			for i, count := range result[channel] {
+				histograms[channel][i] += count
+			}
+		}
+	}
+	return histograms
+}
+
+// Traces the orbits of random points and counts the visits of the ones that
+// the mode keeps.
+func (props *Buddhabrot) sampleOrbits(random *rand.Rand, samples int, limits []int) []densityHistogram {
+	histograms := make([]densityHistogram, len(limits))
+	maxIterations := 0
+	for channel := range histograms {
+		histograms[channel] = make(densityHistogram, props.Width*props.Height)
+		maxIterations = int(math.Max(float64(maxIterations), float64(limits[channel])))
+	}
+	width, height := float64(props.Width), float64(props.Height)
+	step := math.Max(props.Region.Width/width, props.Region.Height/height)
+	xOffset := props.Region.X - (width*step-props.Region.Width)/2.0
+	yOffset := props.Region.Y - (height*step-props.Region.Height)/2.0
+	orbit := make([]complex128, 0, maxIterations)
+	for i := 0; i < samples; i++ {
+		C := complex(
+			BUDDHABROT_SAMPLE_REGION.X+random.Float64()*BUDDHABROT_SAMPLE_REGION.Width,
+			BUDDHABROT_SAMPLE_REGION.Y+random.Float64()*BUDDHABROT_SAMPLE_REGION.Height,
+		)
+		if props.Mode != BUDDHABROT_MODE_ANTI && inMainCardioidOrBulb(C) {
+			// the orbit never escapes
+			continue
+		}
+		orbit = orbit[:0]
+		Z := complex128(0)
+		n := 0
+		for n < maxIterations {
+			Z = Z*Z + C
+			if real(Z)*real(Z)+imag(Z)*imag(Z) > BUDDHABROT_BAIL_OUT*BUDDHABROT_BAIL_OUT {
+				break
+			}
+			orbit = append(orbit, Z)
+			n++
+		}
+		for channel, limit := range limits {
+			escaped := n < limit
+			switch props.Mode {
+			case BUDDHABROT_MODE_ANTI:
+				if escaped {
+					continue
+				}
+			default:
+				if !escaped || n < props.MinIterations {
+					continue
+				}
+			}
+			for _, z := range orbit[:int(math.Min(float64(n), float64(limit)))] {
+				x := int(math.Floor((real(z) - xOffset) / step))
+				y := int(math.Floor((imag(z) - yOffset) / step))
+				if x >= 0 && x < props.Width && y >= 0 && y < props.Height {
+					histograms[channel][y*props.Width+x]++
+				}
+			}
+		}
+	}
+	return histograms
+}
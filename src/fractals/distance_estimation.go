@@ -0,0 +1,129 @@
+package fractals
+
+import (
+	"image/color"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	ESCAPE_TIME_COLORING_DISTANCE = "distance"
+	ESCAPE_TIME_COLORING_BOUNDARY = "boundary"
+	// The default width of boundaries in pixels.
+	DISTANCE_ESTIMATE_DEFAULT_THICKNESS = 1
+	// The distance in pixels beyond which the distance coloring uses the
+	// start of the palette.
+	DISTANCE_COLORING_RANGE = 256
+)
+
+var (
+	BOUNDARY_COLORING_INSIDE_COLOR  = color.RGBA{0, 0, 0, 255}
+	BOUNDARY_COLORING_OUTSIDE_COLOR = color.RGBA{255, 255, 255, 255}
+)
+
+// Implemented by colorings that need the derivative of the orbit, which is
+// dz/dc for Mandelbrot sets and dz/dz0 for Julia sets.
+type EscapeTimeDerivativeColoring interface {
+	// Receives the derivative at the last point of the orbit.
+	SetDerivative(dz complex128)
+}
+
+// Estimates the distance of the starting point of an orbit that escaped at z
+// to the boundary of the set, given the derivative dz of the orbit.
+func estimateDistance(z, dz complex128) float64 {
+	absZ := cmplx.Abs(z)
+	return 0.5 * absZ * math.Log(absZ) / cmplx.Abs(dz)
+}
+
+// Returns the boundary thickness of the orbit in pixels.
+func (orbit *EscapeTimeOrbit) boundaryThickness() float64 {
+	if orbit.DistanceThickness <= 0 {
+		return DISTANCE_ESTIMATE_DEFAULT_THICKNESS
+	}
+	return orbit.DistanceThickness
+}
+
+// Colors by the estimated distance to the boundary of the set, measured in
+// pixels.
+type distanceColoring struct {
+	orbit      EscapeTimeOrbit
+	derivative complex128
+}
+
+func (coloring *distanceColoring) Reset(z complex128) {}
+
+func (coloring *distanceColoring) Visit(z complex128) {}
+
+func (coloring *distanceColoring) SetDerivative(dz complex128) {
+	coloring.derivative = dz
+}
+
+func (coloring *distanceColoring) Position(z complex128, n int, escaped bool) float64 {
+	if !escaped {
+		return 1
+	}
+	pixels := estimateDistance(z, coloring.derivative) / coloring.orbit.PixelSize
+	pixels /= coloring.orbit.boundaryThickness()
+	if math.IsNaN(pixels) {
+		return 1
+	}
+	return 1 - math.Min(1, math.Log1p(pixels)/math.Log1p(DISTANCE_COLORING_RANGE))
+}
+
+func (coloring *distanceColoring) MinBailOut() float64 {
+	return SMOOTH_COLORING_MIN_BAIL_OUT
+}
+
+// Draws the boundary of the set in black on a white background. With
+// anti-aliasing, pixels near the boundary get shades of gray that depend on
+// their estimated distance to it.
+type boundaryColoring struct {
+	orbit      EscapeTimeOrbit
+	derivative complex128
+}
+
+func (coloring *boundaryColoring) Reset(z complex128) {}
+
+func (coloring *boundaryColoring) Visit(z complex128) {}
+
+func (coloring *boundaryColoring) SetDerivative(dz complex128) {
+	coloring.derivative = dz
+}
+
+// Returns the estimated distance to the boundary in multiples of its
+// thickness, limited to 1.
+func (coloring *boundaryColoring) Position(z complex128, n int, escaped bool) float64 {
+	if !escaped {
+		return 0
+	}
+	pixels := estimateDistance(z, coloring.derivative) / coloring.orbit.PixelSize
+	pixels /= coloring.orbit.boundaryThickness()
+	if math.IsNaN(pixels) {
+		return 0
+	}
+	return math.Min(1, pixels)
+}
+
+func (coloring *boundaryColoring) Color(z complex128, n int, escaped bool) (color.RGBA, bool) {
+	coverage := coloring.Position(z, n, escaped)
+	if !coloring.orbit.AntiAlias {
+		if coverage < 1 {
+			return BOUNDARY_COLORING_INSIDE_COLOR, true
+		}
+		return BOUNDARY_COLORING_OUTSIDE_COLOR, true
+	}
+	inside, outside := BOUNDARY_COLORING_INSIDE_COLOR, BOUNDARY_COLORING_OUTSIDE_COLOR
+	blend := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + coverage*(float64(b)-float64(a))))
+	}
+	return color.RGBA{
+		R: blend(inside.R, outside.R),
+		G: blend(inside.G, outside.G),
+		B: blend(inside.B, outside.B),
+		A: 255,
+	}, true
+}
+
+func (coloring *boundaryColoring) MinBailOut() float64 {
+	return SMOOTH_COLORING_MIN_BAIL_OUT
+}
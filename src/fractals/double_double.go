@@ -0,0 +1,134 @@
+package fractals
+
+import (
+	"errors"
+	"image"
+	"math/cmplx"
+
+	math_helpers "github.com/yishakk/fractage/src/helpers/math"
+)
+
+var (
+	// The Julia set series that can be iterated with double-double
+	// arithmetic. zPrev is the point before z.
+	JULIA_SET_DOUBLE_DOUBLE_SERIES = map[string]func(*JuliaSet) func(z, zPrev math_helpers.ComplexDoubleDouble) math_helpers.ComplexDoubleDouble{
+		"classic": func(props *JuliaSet) func(z, zPrev math_helpers.ComplexDoubleDouble) math_helpers.ComplexDoubleDouble {
+			c := math_helpers.NewComplexDoubleDouble(props.C)
+			return func(z, zPrev math_helpers.ComplexDoubleDouble) math_helpers.ComplexDoubleDouble {
+				return z.Sqr().Add(c)
+			}
+		},
+		"phoenix": func(props *JuliaSet) func(z, zPrev math_helpers.ComplexDoubleDouble) math_helpers.ComplexDoubleDouble {
+			c := math_helpers.NewComplexDoubleDouble(props.C)
+			k := math_helpers.NewComplexDoubleDouble(props.GetVaraible('k', JULIA_SET_DEFAULT_VARIABLE_K))
+			return func(z, zPrev math_helpers.ComplexDoubleDouble) math_helpers.ComplexDoubleDouble {
+				return z.Sqr().Add(c).Add(k.Mul(zPrev))
+			}
+		},
+	}
+)
+
+// Returns the point of a pixel at the given offset from the center of an
+// image with double-double arithmetic.
+func doubleDoublePixel(centerX, centerY math_helpers.DoubleDouble, offset complex128) math_helpers.ComplexDoubleDouble {
+	return math_helpers.ComplexDoubleDouble{
+		Real: centerX.Add(math_helpers.NewDoubleDouble(real(offset))),
+		Imag: centerY.Add(math_helpers.NewDoubleDouble(imag(offset))),
+	}
+}
+
+// Renders the Mandelbrot set with double-double arithmetic.
+func (props *MandelbrotSet) renderDoubleDouble(img *image.RGBA, coloring EscapeTimeColoring, bailOut, step float64) error {
+	if !isIntegerExponent(complex(props.M, props.MImag)) {
+		return errors.New("The dd precision only supports integer values of m greater than 1")
+	}
+	m := int(props.M)
+	derivativeColoring, tracksDerivative := coloring.(EscapeTimeDerivativeColoring)
+	center := exactCenter(props.Center, props.Region)
+	centerX, centerY := math_helpers.BigToDoubleDouble(center.X), math_helpers.BigToDoubleDouble(center.Y)
+	for y := 0; y < props.Height; y++ {
+		for x := 0; x < props.Width; x++ {
+			offset := complex((float64(x)-float64(props.Width)/2)*step, (float64(y)-float64(props.Height)/2)*step)
+			C := doubleDoublePixel(centerX, centerY, offset)
+			Z := C
+			z := Z.Complex128()
+			dZ := complex128(1)
+			n := 0
+			coloring.Reset(z)
+			for n < props.MaxIterations {
+				if mandelbrotEscaped(z, complex(props.M, 0), bailOut) {
+					break
+				}
+				if tracksDerivative {
+					dZ = complex(props.M, 0)*intPow(z, m-1)*dZ + 1
+				}
+				if m == 2 {
+					Z = Z.Sqr().Add(C)
+				} else {
+					Z = Z.Pow(m).Add(C)
+				}
+				z = Z.Complex128()
+				coloring.Visit(z)
+				n++
+			}
+			if tracksDerivative {
+				derivativeColoring.SetDerivative(dZ)
+			}
+			// z escaped if n < props.MaxIterations
+			pixelColor, err := escapeTimePixelColor(&props.ColorPalette, coloring, z, n, n < props.MaxIterations)
+			if err != nil {
+				return err
+			}
+			img.Set(x, y, pixelColor)
+		}
+	}
+	return nil
+}
+
+// Renders the Julia set with double-double arithmetic.
+func (props *JuliaSet) renderDoubleDouble(img *image.RGBA, coloring EscapeTimeColoring, bailOut, step float64) error {
+	seriesFunction, found := JULIA_SET_DOUBLE_DOUBLE_SERIES[props.SeriesFunctionName]
+	if !found || props.Formula != "" {
+		return errors.New("The dd precision is only supported by the classic and phoenix series")
+	}
+	series := seriesFunction(props)
+	derivativeColoring, tracksDerivative := coloring.(EscapeTimeDerivativeColoring)
+	var seriesDerivative func(complex128) complex128
+	if tracksDerivative {
+		seriesDerivative = JULIA_SET_SERIES_DERIVATIVES[props.SeriesFunctionName](props)
+	}
+	center := exactCenter(props.Center, props.Region)
+	centerX, centerY := math_helpers.BigToDoubleDouble(center.X), math_helpers.BigToDoubleDouble(center.Y)
+	for y := 0; y < props.Height; y++ {
+		for x := 0; x < props.Width; x++ {
+			offset := complex((float64(x)-float64(props.Width)/2)*step, (float64(y)-float64(props.Height)/2)*step)
+			Z := doubleDoublePixel(centerX, centerY, offset)
+			zPrev, zNext := Z, Z
+			z := Z.Complex128()
+			dZ, dNext := 1+0i, 1+0i
+			n := 0
+			coloring.Reset(z)
+			for (n < props.MaxIterations) && (cmplx.Abs(z) < bailOut) {
+				zPrev = Z
+				Z = zNext
+				zNext = series(Z, zPrev)
+				z = Z.Complex128()
+				if tracksDerivative {
+					dZ = dNext
+					dNext = seriesDerivative(z) * dZ
+				}
+				coloring.Visit(z)
+				n++
+			}
+			if tracksDerivative {
+				derivativeColoring.SetDerivative(dZ)
+			}
+			pixelColor, err := escapeTimePixelColor(&props.ColorPalette, coloring, z, n, n < props.MaxIterations)
+			if err != nil {
+				return err
+			}
+			img.Set(x, y, pixelColor)
+		}
+	}
+	return nil
+}
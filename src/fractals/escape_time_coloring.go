@@ -0,0 +1,212 @@
+package fractals
+
+import (
+	"image/color"
+	"math"
+	"math/cmplx"
+	"strings"
+
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+const (
+	ESCAPE_TIME_COLORING_ESCAPE_COUNT = "escape_count"
+	ESCAPE_TIME_COLORING_EXPONENTIAL  = "exponential"
+	ESCAPE_TIME_COLORING_SMOOTH       = "smooth"
+	ESCAPE_TIME_COLORING_POTENTIAL    = "potential"
+	ESCAPE_TIME_COLORING_ORBIT_TRAP   = "orbit_trap"
+	// The smallest bail-out used by colorings that depend on how fast |z| grows.
+	SMOOTH_COLORING_MIN_BAIL_OUT = 1e6
+	// The exponent applied to the normalized potential to spread its values.
+	POTENTIAL_COLORING_EXPONENT = 0.25
+)
+
+var (
+	ESCAPE_TIME_COLORINGS = map[string]func(orbit EscapeTimeOrbit) EscapeTimeColoring{
+		ESCAPE_TIME_COLORING_ESCAPE_COUNT: func(orbit EscapeTimeOrbit) EscapeTimeColoring {
+			return &escapeCountColoring{orbit: orbit}
+		},
+		ESCAPE_TIME_COLORING_EXPONENTIAL: func(orbit EscapeTimeOrbit) EscapeTimeColoring {
+			return &exponentialColoring{orbit: orbit}
+		},
+		ESCAPE_TIME_COLORING_SMOOTH: func(orbit EscapeTimeOrbit) EscapeTimeColoring {
+			return &smoothColoring{orbit: orbit}
+		},
+		ESCAPE_TIME_COLORING_POTENTIAL: func(orbit EscapeTimeOrbit) EscapeTimeColoring {
+			return &potentialColoring{orbit: orbit}
+		},
+		ESCAPE_TIME_COLORING_ORBIT_TRAP: func(orbit EscapeTimeOrbit) EscapeTimeColoring {
+			return newOrbitTrapColoring(orbit.Trap)
+		},
+		ESCAPE_TIME_COLORING_DISTANCE: func(orbit EscapeTimeOrbit) EscapeTimeColoring {
+			return &distanceColoring{orbit: orbit}
+		},
+		ESCAPE_TIME_COLORING_BOUNDARY: func(orbit EscapeTimeOrbit) EscapeTimeColoring {
+			return &boundaryColoring{orbit: orbit}
+		},
+	}
+)
+
+// Computes the palette position of a pixel from the orbit of an escape-time
+// fractal. A coloring is reused for every pixel of an image.
+type EscapeTimeColoring interface {
+	// Starts a new orbit at z.
+	Reset(z complex128)
+	// Receives each point of the orbit after the first one.
+	Visit(z complex128)
+	// Returns the palette position of a pixel whose orbit ended at z after n
+	// iterations. escaped is false for orbits that stayed bounded.
+	Position(z complex128, n int, escaped bool) float64
+	// Returns the smallest bail-out the coloring works well with.
+	MinBailOut() float64
+}
+
+// Implemented by colorings that can pick the color of a pixel directly
+// instead of a palette position.
+type EscapeTimeDirectColoring interface {
+	// Returns the color of a pixel whose orbit ended at z after n iterations
+	// and whether the coloring picked one.
+	Color(z complex128, n int, escaped bool) (color.RGBA, bool)
+}
+
+// Properties of an escape-time orbit that colorings depend on.
+type EscapeTimeOrbit struct {
+	MaxIterations int
+	// The degree of the iterated function, e.g. 2 for z^2 + c.
+	Exponent float64
+	// The trap that the orbit_trap coloring measures the orbit against.
+	Trap *OrbitTrap
+	// The distance between the centers of neighbouring pixels.
+	PixelSize float64
+	// The width of boundaries in pixels for distance estimation colorings.
+	DistanceThickness float64
+	// Specifies if distance estimation colorings shade the edges of boundaries.
+	AntiAlias bool
+}
+
+// Colors by the number of iterations before the orbit escaped.
+type escapeCountColoring struct {
+	orbit EscapeTimeOrbit
+}
+
+func (coloring *escapeCountColoring) Reset(z complex128) {}
+
+func (coloring *escapeCountColoring) Visit(z complex128) {}
+
+func (coloring *escapeCountColoring) Position(z complex128, n int, escaped bool) float64 {
+	if !escaped {
+		return 1
+	}
+	return float64(n) / float64(coloring.orbit.MaxIterations)
+}
+
+func (coloring *escapeCountColoring) MinBailOut() float64 {
+	return 0
+}
+
+// Colors by the sum of exp(-|z|) over the points of the orbit.
+type exponentialColoring struct {
+	orbit EscapeTimeOrbit
+	sum   float64
+}
+
+func (coloring *exponentialColoring) Reset(z complex128) {
+	coloring.sum = math.Exp(-cmplx.Abs(z))
+}
+
+func (coloring *exponentialColoring) Visit(z complex128) {
+	coloring.sum += math.Exp(-cmplx.Abs(z))
+}
+
+func (coloring *exponentialColoring) Position(z complex128, n int, escaped bool) float64 {
+	if !escaped {
+		return 1
+	}
+	return coloring.sum / float64(coloring.orbit.MaxIterations)
+}
+
+func (coloring *exponentialColoring) MinBailOut() float64 {
+	return 0
+}
+
+// Colors by the normalized iteration count n + 1 - log(log|z|)/log(M), which
+// removes the bands of the escape count.
+type smoothColoring struct {
+	orbit EscapeTimeOrbit
+}
+
+func (coloring *smoothColoring) Reset(z complex128) {}
+
+func (coloring *smoothColoring) Visit(z complex128) {}
+
+func (coloring *smoothColoring) Position(z complex128, n int, escaped bool) float64 {
+	if !escaped {
+		return 1
+	}
+	mu := float64(n) + 1 - math.Log(math.Log(cmplx.Abs(z)))/math.Log(coloring.orbit.Exponent)
+	if math.IsNaN(mu) || math.IsInf(mu, 0) {
+		mu = float64(n)
+	}
+	return mu / float64(coloring.orbit.MaxIterations)
+}
+
+func (coloring *smoothColoring) MinBailOut() float64 {
+	return SMOOTH_COLORING_MIN_BAIL_OUT
+}
+
+// Colors by the continuous potential log|z|/M^n of the escaped orbit.
+type potentialColoring struct {
+	orbit EscapeTimeOrbit
+}
+
+func (coloring *potentialColoring) Reset(z complex128) {}
+
+func (coloring *potentialColoring) Visit(z complex128) {}
+
+func (coloring *potentialColoring) Position(z complex128, n int, escaped bool) float64 {
+	if !escaped {
+		return 1
+	}
+	potential := math.Log(cmplx.Abs(z)) / math.Pow(coloring.orbit.Exponent, float64(n))
+	if math.IsNaN(potential) || potential <= 0 {
+		return 1
+	}
+	return 1 - math.Pow(potential, POTENTIAL_COLORING_EXPONENT)
+}
+
+func (coloring *potentialColoring) MinBailOut() float64 {
+	return SMOOTH_COLORING_MIN_BAIL_OUT
+}
+
+// Checks if a name exists in the set of ESCAPE_TIME_COLORINGS names.
+func IsValidEscapeTimeColoring(txt string) bool {
+	coloringName := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	_, found := ESCAPE_TIME_COLORINGS[coloringName]
+	return found
+}
+
+// Checks if the escape-time coloring with the given name needs the
+// derivative of the orbit.
+func IsDerivativeEscapeTimeColoring(name string) bool {
+	if !IsValidEscapeTimeColoring(name) {
+		return false
+	}
+	_, ok := NewEscapeTimeColoring(name, EscapeTimeOrbit{}).(EscapeTimeDerivativeColoring)
+	return ok
+}
+
+// Creates the escape-time coloring with the given name.
+func NewEscapeTimeColoring(name string, orbit EscapeTimeOrbit) EscapeTimeColoring {
+	coloringName := strings.Trim(name, helpers.WHITESPACE_CUTSET)
+	return ESCAPE_TIME_COLORINGS[coloringName](orbit)
+}
+
+// Retrieves the color of a pixel whose orbit ended at z after n iterations.
+func escapeTimePixelColor(palette *helpers.ColorPalette, coloring EscapeTimeColoring, z complex128, n int, escaped bool) (color.RGBA, error) {
+	if directColoring, ok := coloring.(EscapeTimeDirectColoring); ok {
+		if pixelColor, found := directColoring.Color(z, n, escaped); found {
+			return pixelColor, nil
+		}
+	}
+	return palette.GetColor(coloring.Position(z, n, escaped))
+}
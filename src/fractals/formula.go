@@ -0,0 +1,120 @@
+package fractals
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yishakk/fractage/src/helpers"
+	math_helpers "github.com/yishakk/fractage/src/helpers/math"
+)
+
+const (
+	// The current point of the orbit.
+	FORMULA_VARIABLE_Z = "z"
+	// The constant of Julia sets, or the pixel of Mandelbrot sets.
+	FORMULA_VARIABLE_C = "c"
+	// The point of the orbit before z, which is the pixel at the start.
+	FORMULA_VARIABLE_ZPREV = "zprev"
+	// The point of the pixel.
+	FORMULA_VARIABLE_PIXEL = "pixel"
+)
+
+var (
+	// The variables of formulas, followed by their parameters.
+	FORMULA_VARIABLES = []string{
+		FORMULA_VARIABLE_Z,
+		FORMULA_VARIABLE_C,
+		FORMULA_VARIABLE_ZPREV,
+		FORMULA_VARIABLE_PIXEL,
+	}
+)
+
+// A user-defined formula that computes the next point of an orbit.
+type formulaSeries struct {
+	expression *math_helpers.ComplexExpression
+	// The values of the variables followed by the values of the parameters.
+	values []complex128
+}
+
+// Compiles a formula of the FORMULA_VARIABLES and the given parameters.
+func newFormulaSeries(formula string, parameters map[string]complex128) (*formulaSeries, error) {
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	variables := append(append([]string{}, FORMULA_VARIABLES...), names...)
+	expression, err := math_helpers.ParseComplexExpression(formula, variables)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid formula: %w", err)
+	}
+	series := formulaSeries{expression: expression, values: make([]complex128, len(variables))}
+	for i, name := range names {
+		series.values[len(FORMULA_VARIABLES)+i] = parameters[name]
+	}
+	return &series, nil
+}
+
+// Computes the point after z.
+func (series *formulaSeries) Next(z, zPrev, c, pixel complex128) complex128 {
+	series.values[0] = z
+	series.values[1] = c
+	series.values[2] = zPrev
+	series.values[3] = pixel
+	return series.expression.Evaluate(series.values)
+}
+
+// Checks if a formula of the given parameters can be compiled.
+func ValidateFormula(formula string, parameters map[string]complex128) error {
+	_, err := newFormulaSeries(formula, parameters)
+	return err
+}
+
+// Converts a comma-separated list of parameter assignments, such as
+// "k=0.5-0.1i, scale=2", to a map of names and complex numbers.
+func ParseFormulaParameters(txt string) (map[string]complex128, error) {
+	tokens, err := helpers.TokenizeParameters(txt)
+	if err != nil {
+		return nil, err
+	}
+	parameters := make(map[string]complex128, len(tokens))
+	for _, token := range tokens {
+		before, after, found := strings.Cut(token.Value, "=")
+		if !found {
+			return nil, token.Errorf("Invalid parameter assignment. It must be of the form name=value")
+		}
+		name := strings.Trim(before, helpers.WHITESPACE_CUTSET)
+		if !isFormulaParameterName(name) {
+			return nil, token.Errorf("Invalid parameter name %q", name)
+		}
+		if math_helpers.IsReservedExpressionName(name) {
+			return nil, token.Errorf("%q is the name of a constant or function", name)
+		}
+		for _, variable := range FORMULA_VARIABLES {
+			if name == variable {
+				return nil, token.Errorf("%q is the name of a variable", name)
+			}
+		}
+		valueText := strings.Trim(after, helpers.WHITESPACE_CUTSET)
+		value, err := strconv.ParseComplex(valueText, 128)
+		if err != nil {
+			return nil, token.Errorf("Invalid complex number %q", valueText)
+		}
+		parameters[name] = value
+	}
+	return parameters, nil
+}
+
+// Checks if a name is made of letters, digits and underscores and doesn't
+// start with a digit.
+func isFormulaParameterName(name string) bool {
+	for i, char := range name {
+		if !(unicode.IsLetter(char) || char == '_' || (i > 0 && unicode.IsDigit(char))) {
+			return false
+		}
+	}
+	return name != ""
+}
@@ -0,0 +1,53 @@
+package fractals
+
+import (
+	"math/cmplx"
+	"testing"
+)
+
+const (
+	benchmarkJuliaC     = -0.8 + 0.156i
+	benchmarkOrbitStart = 0.1 + 0.1i
+)
+
+// Iterates a series from a fixed point, restarting whenever the orbit
+// escapes so that it stays finite.
+func iterateSeries(b *testing.B, next func(z complex128) complex128) complex128 {
+	z := benchmarkOrbitStart
+	for i := 0; i < b.N; i++ {
+		z = next(z)
+		if cmplx.IsNaN(z) || real(z)*real(z)+imag(z)*imag(z) > 4 {
+			z = benchmarkOrbitStart
+		}
+	}
+	return z
+}
+
+// Compiles the formula of the classic series.
+func newBenchmarkClassicFormula(b *testing.B) *formulaSeries {
+	series, err := newFormulaSeries("z^2 + c", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	classic := JULIA_SET_SERIES["classic"](&JuliaSet{C: benchmarkJuliaC})
+	z := 0.3 - 0.2i
+	compiled, builtIn := series.Next(z, z, benchmarkJuliaC, z), classic(z)
+	if cmplx.Abs(compiled-builtIn) > 1e-12 {
+		b.Fatalf("the compiled formula gives %v instead of %v", compiled, builtIn)
+	}
+	return series
+}
+
+func BenchmarkFormulaClassicSeries(b *testing.B) {
+	classic := JULIA_SET_SERIES["classic"](&JuliaSet{C: benchmarkJuliaC})
+	b.ResetTimer()
+	iterateSeries(b, classic)
+}
+
+func BenchmarkFormulaClassicCompiled(b *testing.B) {
+	series := newBenchmarkClassicFormula(b)
+	b.ResetTimer()
+	iterateSeries(b, func(z complex128) complex128 {
+		return series.Next(z, z, benchmarkJuliaC, z)
+	})
+}
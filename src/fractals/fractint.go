@@ -0,0 +1,481 @@
+package fractals
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/cmplx"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yishakk/fractage/src/helpers"
+	math_helpers "github.com/yishakk/fractage/src/helpers/math"
+)
+
+const (
+	// The number of parameters p1 to p5 of Fractint formulas.
+	FRACTINT_PARAMETER_COUNT = 5
+	// The number of functions fn1 to fn4 of Fractint formulas.
+	FRACTINT_FUNCTION_COUNT = 4
+
+	// The indices of the FRACTINT_PREDEFINED_VARIABLES.
+	fractint_PIXEL   = 0
+	fractint_P1      = 1
+	fractint_MAXIT   = 6
+	fractint_SCRNMAX = 7
+	fractint_SCRNPIX = 8
+	fractint_WHITESQ = 9
+	fractint_ISMAND  = 10
+	fractint_CENTER  = 11
+)
+
+var (
+	// The functions of Fractint formulas, which fn1 to fn4 can also be set to.
+	FRACTINT_FUNCTIONS = map[string]func(complex128) complex128{
+		"sin":   cmplx.Sin,
+		"cos":   cmplx.Cos,
+		"cosxx": func(z complex128) complex128 { return cmplx.Conj(cmplx.Cos(z)) },
+		"tan":   cmplx.Tan,
+		"cotan": cmplx.Cot,
+		"sinh":  cmplx.Sinh,
+		"cosh":  cmplx.Cosh,
+		"tanh":  cmplx.Tanh,
+		"cotanh": func(z complex128) complex128 {
+			return 1 / cmplx.Tanh(z)
+		},
+		"asin":  cmplx.Asin,
+		"acos":  cmplx.Acos,
+		"atan":  cmplx.Atan,
+		"asinh": cmplx.Asinh,
+		"acosh": cmplx.Acosh,
+		"atanh": cmplx.Atanh,
+		"exp":   cmplx.Exp,
+		"log":   cmplx.Log,
+		"sqrt":  cmplx.Sqrt,
+		"sqr":   math_helpers.EXPRESSION_FUNCTIONS["sqr"],
+		"conj":  cmplx.Conj,
+		"abs":   math_helpers.EXPRESSION_FUNCTIONS["abs"],
+		"cabs":  math_helpers.EXPRESSION_FUNCTIONS["cabs"],
+		"real":  math_helpers.EXPRESSION_FUNCTIONS["real"],
+		"imag":  math_helpers.EXPRESSION_FUNCTIONS["imag"],
+		"flip":  math_helpers.EXPRESSION_FUNCTIONS["flip"],
+		"recip": func(z complex128) complex128 { return 1 / z },
+		"ident": func(z complex128) complex128 { return z },
+		"zero":  func(z complex128) complex128 { return 0 },
+		"one":   func(z complex128) complex128 { return 1 },
+		"floor": func(z complex128) complex128 { return complex(math.Floor(real(z)), math.Floor(imag(z))) },
+		"ceil":  func(z complex128) complex128 { return complex(math.Ceil(real(z)), math.Ceil(imag(z))) },
+		"trunc": func(z complex128) complex128 { return complex(math.Trunc(real(z)), math.Trunc(imag(z))) },
+		"round": func(z complex128) complex128 { return complex(math.Round(real(z)), math.Round(imag(z))) },
+	}
+	// The functions that fn1 to fn4 are set to when they aren't given, as in
+	// Fractint.
+	FRACTINT_DEFAULT_FUNCTIONS = [FRACTINT_FUNCTION_COUNT]string{"sin", "sqr", "sinh", "cosh"}
+	// The constants of Fractint formulas.
+	FRACTINT_CONSTANTS = map[string]complex128{
+		"pi": math.Pi,
+		"e":  math.E,
+	}
+	// The variables that Fractint sets before each pixel, followed by the
+	// variables of formulas, which start at 0.
+	FRACTINT_PREDEFINED_VARIABLES = []string{
+		"pixel", "p1", "p2", "p3", "p4", "p5",
+		"maxit", "scrnmax", "scrnpix", "whitesq", "ismand", "center",
+	}
+	// The names of Fractint formulas that can't be rendered.
+	FRACTINT_UNSUPPORTED_NAMES = []string{"rand", "srand", "lastsqr", "magxmag", "rotskew"}
+	// The keywords of the conditional blocks of Fractint formulas.
+	FRACTINT_BLOCK_KEYWORDS = []string{"if", "elseif", "else", "endif"}
+	// Matches the names of formulas and whether they are called.
+	fractintNamePattern = regexp.MustCompile(`[0-9.]+(?:e[+-]?[0-9]+)?|([a-z_][a-z0-9_]*)\s*(\()?`)
+)
+
+// A formula of a Fractint .frm file, such as
+//
+//	Mandel (XAXIS) {
+//	  z = 0, c = pixel:
+//	  z = sqr(z) + c
+//	  |z| <= 4
+//	}
+//
+// The statements before the colon initialize each pixel, the statements after
+// it are iterated, and the last one is the bail-out condition, which stops the
+// iterations when it's 0.
+type FractintFormula struct {
+	Name string
+	// The symmetry after the name, such as XAXIS, which renders ignore.
+	Symmetry string
+	init     []fractintStatement
+	loop     []fractintStatement
+}
+
+// A statement of a Fractint formula.
+type fractintStatement struct {
+	text string
+	// The 1-based line of the statement in its file.
+	line int
+}
+
+// The values that a Fractint formula is rendered with.
+type FractintParameters struct {
+	// The values of p1 to p5.
+	P [FRACTINT_PARAMETER_COUNT]complex128
+	// The names of the functions fn1 to fn4 in FRACTINT_FUNCTIONS, which are
+	// the FRACTINT_DEFAULT_FUNCTIONS when they are empty.
+	Functions [FRACTINT_FUNCTION_COUNT]string
+	// Specifies if ismand is 0, as in the Julia mode of Fractint.
+	Julia bool
+}
+
+// Sets fn1, fn2 and so on to the functions of the given names in
+// FRACTINT_FUNCTIONS.
+func (parameters *FractintParameters) SetFunctions(names []string) error {
+	if len(names) > FRACTINT_FUNCTION_COUNT {
+		return fmt.Errorf("Only %d functions are supported", FRACTINT_FUNCTION_COUNT)
+	}
+	for i, name := range names {
+		name = strings.ToLower(strings.Trim(name, helpers.WHITESPACE_CUTSET))
+		if _, found := FRACTINT_FUNCTIONS[name]; !found {
+			return fmt.Errorf("Unknown function %s", name)
+		}
+		parameters.Functions[i] = name
+	}
+	return nil
+}
+
+// Sets p1 to p5 from a comma-separated list of assignments, such as
+// "p1=0.5-0.1i, p2=2".
+func (parameters *FractintParameters) SetParameters(txt string) error {
+	values, err := ParseFormulaParameters(txt)
+	if err != nil {
+		return err
+	}
+	for name, value := range values {
+		index := -1
+		for i := 0; i < FRACTINT_PARAMETER_COUNT; i++ {
+			if name == fmt.Sprintf("p%d", i+1) {
+				index = i
+			}
+		}
+		if index < 0 {
+			return fmt.Errorf("Invalid parameter %s. Only p1 to p%d are supported", name, FRACTINT_PARAMETER_COUNT)
+		}
+		parameters.P[index] = value
+	}
+	return nil
+}
+
+// An entry of a Fractint file, such as Mandel (XAXIS) { ... }.
+type fractintEntry struct {
+	name string
+	body string
+	// The 1-based line of the start of the body.
+	line int
+}
+
+// Splits a Fractint .frm or .par file into its entries, without the comments
+// that start with ';'.
+func splitFractintEntries(txt string) ([]fractintEntry, error) {
+	lines := strings.Split(strings.ReplaceAll(txt, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		if before, _, found := strings.Cut(line, ";"); found {
+			lines[i] = before
+		}
+	}
+	text := strings.Join(lines, "\n")
+	var entries []fractintEntry
+	line := 1
+	nameStart := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			line++
+			nameStart = i + 1
+		case '}':
+			return nil, fmt.Errorf("line %d: '}' doesn't close an entry", line)
+		case '{':
+			name := strings.Trim(text[nameStart:i], helpers.WHITESPACE_CUTSET)
+			if name == "" {
+				return nil, fmt.Errorf("line %d: the entry has no name", line)
+			}
+			end := strings.IndexAny(text[i+1:], "{}")
+			if end < 0 || text[i+1+end] == '{' {
+				return nil, fmt.Errorf("line %d: the entry %s isn't closed", line, name)
+			}
+			body := text[i+1 : i+1+end]
+			entries = append(entries, fractintEntry{name: name, body: body, line: line})
+			line += strings.Count(body, "\n")
+			i += 1 + end
+			nameStart = i + 1
+		}
+	}
+	return entries, nil
+}
+
+// Parses the formulas of a Fractint .frm file.
+func ParseFractintFormulas(txt string) ([]FractintFormula, error) {
+	entries, err := splitFractintEntries(txt)
+	if err != nil {
+		return nil, err
+	}
+	formulas := make([]FractintFormula, 0, len(entries))
+	for _, entry := range entries {
+		formula, err := parseFractintFormula(entry)
+		if err != nil {
+			return nil, err
+		}
+		formulas = append(formulas, *formula)
+	}
+	return formulas, nil
+}
+
+// Parses an entry of a .frm file into a formula.
+func parseFractintFormula(entry fractintEntry) (*FractintFormula, error) {
+	formula := FractintFormula{Name: entry.name}
+	if strings.HasSuffix(entry.name, ")") {
+		if open := strings.LastIndex(entry.name, "("); open > 0 {
+			formula.Name = strings.Trim(entry.name[:open], helpers.WHITESPACE_CUTSET)
+			formula.Symmetry = strings.Trim(entry.name[open+1:len(entry.name)-1], helpers.WHITESPACE_CUTSET)
+		}
+	}
+	// Fractint formulas aren't case sensitive
+	body := strings.ToLower(entry.body)
+	line := entry.line
+	section := &formula.loop
+	foundColon := false
+	depth := 0
+	start := 0
+	addStatement := func(end int) {
+		text := strings.Trim(body[start:end], helpers.WHITESPACE_CUTSET)
+		if text != "" {
+			*section = append(*section, fractintStatement{text: text, line: line})
+		}
+		start = end + 1
+	}
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				addStatement(i)
+			}
+		case '\n':
+			addStatement(i)
+			line++
+		case ':':
+			if foundColon {
+				return nil, fmt.Errorf("Invalid formula %s: line %d: a formula can only have one ':'", formula.Name, line)
+			}
+			foundColon = true
+			addStatement(i)
+			// the statements so far initialize the pixels
+			formula.init = formula.loop
+			formula.loop = nil
+		}
+	}
+	addStatement(len(body))
+	if len(formula.loop) == 0 {
+		return nil, fmt.Errorf("Invalid formula %s: it has no iterated statements", formula.Name)
+	}
+	err := formula.Validate(FractintParameters{})
+	if err != nil {
+		return nil, err
+	}
+	return &formula, nil
+}
+
+// Finds the variables of the formula, which are the FRACTINT_PREDEFINED_VARIABLES
+// followed by the other names of the formula in alphabetical order.
+func (formula *FractintFormula) variables() ([]string, error) {
+	known := map[string]bool{}
+	for _, name := range FRACTINT_PREDEFINED_VARIABLES {
+		known[name] = true
+	}
+	var names []string
+	for _, statement := range append(append([]fractintStatement{}, formula.init...), formula.loop...) {
+		for _, match := range fractintNamePattern.FindAllStringSubmatch(statement.text, -1) {
+			name, called := match[1], match[2] != ""
+			if name == "" {
+				continue
+			}
+			for _, unsupported := range FRACTINT_UNSUPPORTED_NAMES {
+				if name == unsupported {
+					return nil, fmt.Errorf("Invalid formula %s: line %d: %s isn't supported", formula.Name, statement.line, name)
+				}
+			}
+			for _, keyword := range FRACTINT_BLOCK_KEYWORDS {
+				if name == keyword {
+					return nil, fmt.Errorf("Invalid formula %s: line %d: if, elseif, else and endif blocks aren't supported", formula.Name, statement.line)
+				}
+			}
+			_, isFunction := FRACTINT_FUNCTIONS[name]
+			isFunction = isFunction || isFractintFunctionVariable(name)
+			if called && !isFunction {
+				return nil, fmt.Errorf("Invalid formula %s: line %d: unknown function %s", formula.Name, statement.line, name)
+			}
+			if _, isConstant := FRACTINT_CONSTANTS[name]; isConstant || isFunction || known[name] {
+				continue
+			}
+			known[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append(append([]string{}, FRACTINT_PREDEFINED_VARIABLES...), names...), nil
+}
+
+// Checks if a name is one of the functions fn1 to fn4.
+func isFractintFunctionVariable(name string) bool {
+	for i := 1; i <= FRACTINT_FUNCTION_COUNT; i++ {
+		if name == fmt.Sprintf("fn%d", i) {
+			return true
+		}
+	}
+	return false
+}
+
+// Finds a formula by its name, which isn't case sensitive. The first formula
+// is returned when the name is empty.
+func FindFractintFormula(formulas []FractintFormula, name string) (*FractintFormula, error) {
+	if len(formulas) == 0 {
+		return nil, errors.New("The formula file has no formulas")
+	}
+	if name == "" {
+		return &formulas[0], nil
+	}
+	for i := range formulas {
+		if strings.EqualFold(formulas[i].Name, name) {
+			return &formulas[i], nil
+		}
+	}
+	return nil, fmt.Errorf("The formula %s wasn't found", name)
+}
+
+// Checks if the formula can be compiled with the given parameters.
+func (formula *FractintFormula) Validate(parameters FractintParameters) error {
+	_, err := formula.compile(&parameters)
+	return err
+}
+
+// A Fractint formula compiled for rendering.
+type fractintProgram struct {
+	init *math_helpers.ComplexStatements
+	loop *math_helpers.ComplexStatements
+	// The values of the variables before each pixel.
+	initial []complex128
+	values  []complex128
+	// The index of z in the values, or -1 if the formula has no z.
+	z int
+}
+
+// Compiles the formula with the given parameters.
+func (formula *FractintFormula) compile(parameters *FractintParameters) (*fractintProgram, error) {
+	variables, err := formula.variables()
+	if err != nil {
+		return nil, err
+	}
+	syntax := math_helpers.ExpressionSyntax{
+		Constants:        FRACTINT_CONSTANTS,
+		Functions:        make(map[string]func(complex128) complex128, len(FRACTINT_FUNCTIONS)+FRACTINT_FUNCTION_COUNT),
+		Conditions:       true,
+		FractintNotation: true,
+	}
+	for name, function := range FRACTINT_FUNCTIONS {
+		syntax.Functions[name] = function
+	}
+	for i, name := range parameters.Functions {
+		if name == "" {
+			name = FRACTINT_DEFAULT_FUNCTIONS[i]
+		}
+		function, found := FRACTINT_FUNCTIONS[name]
+		if !found {
+			return nil, fmt.Errorf("Invalid function fn%d: %s", i+1, name)
+		}
+		syntax.Functions[fmt.Sprintf("fn%d", i+1)] = function
+	}
+	compile := func(statements []fractintStatement) (*math_helpers.ComplexStatements, error) {
+		texts := make([]string, len(statements))
+		for i, statement := range statements {
+			texts[i] = statement.text
+		}
+		compiled, err := math_helpers.ParseComplexStatements(texts, variables, syntax)
+		var statementError *math_helpers.StatementError
+		if errors.As(err, &statementError) {
+			return nil, fmt.Errorf("Invalid formula %s: line %d: %w", formula.Name, statements[statementError.Statement].line, statementError.Err)
+		}
+		return compiled, err
+	}
+	program := fractintProgram{
+		initial: make([]complex128, len(variables)),
+		values:  make([]complex128, len(variables)),
+		z:       -1,
+	}
+	program.init, err = compile(formula.init)
+	if err != nil {
+		return nil, err
+	}
+	program.loop, err = compile(formula.loop)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range variables {
+		if name == "z" {
+			program.z = i
+		}
+	}
+	copy(program.initial[fractint_P1:], parameters.P[:])
+	if !parameters.Julia {
+		program.initial[fractint_ISMAND] = 1
+	}
+	return &program, nil
+}
+
+// Returns the current value of z.
+func (program *fractintProgram) Z() complex128 {
+	if program.z < 0 {
+		return 0
+	}
+	return program.values[program.z]
+}
+
+// Renders the Fractint formula of the Julia set, whose bail-out condition
+// replaces the bail-out of the set.
+func (props *JuliaSet) renderFractint(img *image.RGBA, coloring EscapeTimeColoring, xOffset, yOffset, step float64) error {
+	program, err := props.Fractint.compile(&props.FractintParameters)
+	if err != nil {
+		return err
+	}
+	program.initial[fractint_MAXIT] = complex(float64(props.MaxIterations), 0)
+	program.initial[fractint_SCRNMAX] = complex(float64(props.Width), float64(props.Height))
+	program.initial[fractint_CENTER] = complex(props.Region.X+props.Region.Width/2, props.Region.Y+props.Region.Height/2)
+	for y := 0; y < props.Height; y++ {
+		for x := 0; x < props.Width; x++ {
+			copy(program.values, program.initial)
+			program.values[fractint_PIXEL] = complex(xOffset+float64(x)*step, yOffset+float64(y)*step)
+			program.values[fractint_SCRNPIX] = complex(float64(x), float64(y))
+			if (x+y)%2 == 0 {
+				program.values[fractint_WHITESQ] = 1
+			}
+			program.init.Run(program.values)
+			coloring.Reset(program.Z())
+			n := 0
+			escaped := false
+			for n < props.MaxIterations && !escaped {
+				escaped = real(program.loop.Run(program.values)) == 0
+				coloring.Visit(program.Z())
+				n++
+			}
+			pixelColor, err := escapeTimePixelColor(&props.ColorPalette, coloring, program.Z(), n, escaped)
+			if err != nil {
+				return err
+			}
+			img.Set(x, y, pixelColor)
+		}
+	}
+	return nil
+}
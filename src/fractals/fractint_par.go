@@ -0,0 +1,377 @@
+package fractals
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+const (
+	FRACTINT_TYPE_FORMULA = "formula"
+	FRACTINT_TYPE_MANDEL  = "mandel"
+	FRACTINT_TYPE_JULIA   = "julia"
+
+	FRACTINT_DEFAULT_ITERATIONS = 150
+	FRACTINT_DEFAULT_BAIL_OUT   = 4
+	// The index of the colors of bounded pixels, which is blue in the
+	// default palette of Fractint.
+	FRACTINT_DEFAULT_INSIDE = 1
+	// The ratio of the height to the width of the views of center-mag.
+	FRACTINT_ASPECT_RATIO = 0.75
+)
+
+var (
+	// The formulas of the built-in types of Fractint, which are formatted
+	// with the bail-out.
+	FRACTINT_TYPE_FORMULAS = map[string]string{
+		FRACTINT_TYPE_MANDEL: "mandel {\nz = p1, c = pixel:\nz = sqr(z) + c\n|z| <= %g\n}",
+		FRACTINT_TYPE_JULIA:  "julia {\nz = pixel, c = p1:\nz = sqr(z) + c\n|z| <= %g\n}",
+	}
+	// The parameters of .par entries that don't change the image, or whose
+	// effect fractage can't reproduce but doesn't need to.
+	FRACTINT_IGNORED_PAR_PARAMETERS = []string{
+		"reset", "float", "periodicity", "passes", "formulafile", "cyclerange",
+		"textcolors", "sound", "hertz", "mathtolerance", "symmetry", "video",
+		"fillcolor", "bailoutest", "orbitdelay", "orbitinterval", "showorbit",
+		"nobof", "rseed", "savetime", "filename", "comment", "recordcolors",
+	}
+	// Matches a '\' at the end of a line, which continues the line.
+	fractintContinuationPattern = regexp.MustCompile(`\\\r?\n[ \t]*`)
+)
+
+// An entry of a Fractint .par file, whose view and coloring are translated to
+// the properties of fractage images.
+type FractintPar struct {
+	Name string
+	// The fractal type, which is one of the FRACTINT_TYPE_FORMULAS or formula.
+	Type string
+	// The name of the formula of the formula type.
+	FormulaName string
+	// The region of the view, or nil if the entry has none.
+	Region        *helpers.Rect
+	MaxIterations int
+	// The bail-out of the mandel and julia types.
+	BailOut    float64
+	Parameters FractintParameters
+	// The colors of the palette, or nil if the entry has none.
+	Colors []color.RGBA
+	// The index of the color of bounded pixels in Colors.
+	Inside int
+}
+
+// Parses the entries of a Fractint .par file. Entries of other kinds of
+// files, such as frm:name, are skipped.
+func ParseFractintPars(txt string) ([]FractintPar, error) {
+	entries, err := splitFractintEntries(txt)
+	if err != nil {
+		return nil, err
+	}
+	var pars []FractintPar
+	for _, entry := range entries {
+		if strings.Contains(entry.name, ":") {
+			continue
+		}
+		par, err := parseFractintPar(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid parameter set %s: %w", entry.name, err)
+		}
+		pars = append(pars, *par)
+	}
+	return pars, nil
+}
+
+// Parses an entry of a .par file.
+func parseFractintPar(entry fractintEntry) (*FractintPar, error) {
+	par := FractintPar{
+		Name:          entry.name,
+		Type:          FRACTINT_TYPE_MANDEL,
+		MaxIterations: FRACTINT_DEFAULT_ITERATIONS,
+		BailOut:       FRACTINT_DEFAULT_BAIL_OUT,
+		Inside:        FRACTINT_DEFAULT_INSIDE,
+	}
+	// long values such as colors continue on the next line after a '\'
+	body := fractintContinuationPattern.ReplaceAllString(entry.body, "")
+	for _, field := range strings.Fields(body) {
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			return nil, fmt.Errorf("Invalid parameter %q. It must be of the form key=value", field)
+		}
+		key = strings.ToLower(key)
+		var err error
+		switch key {
+		case "type":
+			par.Type = strings.ToLower(value)
+			if _, found := FRACTINT_TYPE_FORMULAS[par.Type]; !found && par.Type != FRACTINT_TYPE_FORMULA {
+				return nil, fmt.Errorf("The fractal type %s isn't supported", value)
+			}
+		case "formulaname":
+			par.FormulaName = value
+		case "corners":
+			par.Region, err = parseFractintCorners(value)
+		case "center-mag":
+			par.Region, err = parseFractintCenterMag(value)
+		case "maxiter":
+			par.MaxIterations, err = strconv.Atoi(value)
+			if err == nil && (par.MaxIterations <= 0 || par.MaxIterations > JULIA_SET_MAX_ITERATIONS) {
+				err = fmt.Errorf("It must be between 1 and %d", JULIA_SET_MAX_ITERATIONS)
+			}
+		case "bailout":
+			par.BailOut, err = strconv.ParseFloat(value, 64)
+		case "params":
+			err = parseFractintParams(value, &par.Parameters)
+		case "function":
+			err = par.Parameters.SetFunctions(strings.Split(value, "/"))
+		case "colors":
+			par.Colors, err = parseFractintColors(value)
+		case "inside":
+			par.Inside, err = strconv.Atoi(value)
+			if err != nil {
+				err = errors.New("Only color numbers are supported")
+			}
+		case "outside":
+			if strings.ToLower(value) != "iter" {
+				err = errors.New("Only iter is supported")
+			}
+		case "logmap", "decomp", "biomorph", "distest", "potential", "invert", "finattract", "ranges":
+			if value != "0" && value != "no" && value != "n" {
+				err = errors.New("Unsupported parameter")
+			}
+		default:
+			if !isIgnoredFractintParParameter(key) {
+				err = errors.New("Unsupported parameter")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	if par.Type == FRACTINT_TYPE_FORMULA && par.FormulaName == "" {
+		return nil, errors.New("The formula type needs a formulaname")
+	}
+	if par.Colors != nil && (par.Inside < 0 || par.Inside >= len(par.Colors)) {
+		return nil, fmt.Errorf("inside: the palette has no color %d", par.Inside)
+	}
+	return &par, nil
+}
+
+// Checks if a parameter of .par entries is in FRACTINT_IGNORED_PAR_PARAMETERS.
+func isIgnoredFractintParParameter(key string) bool {
+	for _, ignored := range FRACTINT_IGNORED_PAR_PARAMETERS {
+		if key == ignored {
+			return true
+		}
+	}
+	return false
+}
+
+// Splits a value of a .par entry at its slashes into numbers. Empty numbers
+// are 0.
+func parseFractintNumbers(value string) ([]float64, error) {
+	parts := strings.Split(value, "/")
+	numbers := make([]float64, len(parts))
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number %q", part)
+		}
+		numbers[i] = number
+	}
+	return numbers, nil
+}
+
+// Converts corners=xmin/xmax/ymin/ymax to a region. The corners of rotated
+// and skewed views, which have a third corner that differs from xmin/ymin,
+// aren't supported.
+func parseFractintCorners(value string) (*helpers.Rect, error) {
+	corners, err := parseFractintNumbers(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(corners) != 4 && len(corners) != 6 {
+		return nil, errors.New("It must be of the form xmin/xmax/ymin/ymax")
+	}
+	if len(corners) == 6 && (corners[4] != corners[0] || corners[5] != corners[2]) {
+		return nil, errors.New("Rotated and skewed views aren't supported")
+	}
+	return &helpers.Rect{X: corners[0], Y: corners[2], Width: corners[1] - corners[0], Height: corners[3] - corners[2]}, nil
+}
+
+// Converts center-mag=x/y/mag[/xmagfactor[/rotation[/skew]]] to a region. The
+// height of the view is 2/mag, and its width is the height divided by the
+// FRACTINT_ASPECT_RATIO and xmagfactor.
+func parseFractintCenterMag(value string) (*helpers.Rect, error) {
+	numbers, err := parseFractintNumbers(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(numbers) < 3 || len(numbers) > 6 {
+		return nil, errors.New("It must be of the form x/y/mag[/xmagfactor[/rotation[/skew]]]")
+	}
+	x, y, mag := numbers[0], numbers[1], numbers[2]
+	xMagFactor := 1.0
+	if len(numbers) > 3 && numbers[3] != 0 {
+		xMagFactor = numbers[3]
+	}
+	if len(numbers) > 4 && (numbers[4] != 0 || (len(numbers) > 5 && numbers[5] != 0)) {
+		return nil, errors.New("Rotated and skewed views aren't supported")
+	}
+	if mag <= 0 {
+		return nil, errors.New("mag must be greater than 0")
+	}
+	height := 2 / mag
+	width := height / FRACTINT_ASPECT_RATIO / xMagFactor
+	return &helpers.Rect{X: x - width/2, Y: y - height/2, Width: width, Height: height}, nil
+}
+
+// Converts params=re1/im1/re2/im2/... to the values of p1 to p5.
+func parseFractintParams(value string, parameters *FractintParameters) error {
+	numbers, err := parseFractintNumbers(value)
+	if err != nil {
+		return err
+	}
+	if len(numbers) > 2*FRACTINT_PARAMETER_COUNT {
+		return fmt.Errorf("Only %d numbers are supported", 2*FRACTINT_PARAMETER_COUNT)
+	}
+	for i := 0; i < len(numbers); i += 2 {
+		p := complex(numbers[i], 0)
+		if i+1 < len(numbers) {
+			p += complex(0, numbers[i+1])
+		}
+		parameters.P[i/2] = p
+	}
+	return nil
+}
+
+// Decodes colors=..., in which each color is 3 digits from 0 to 63 for red,
+// green and blue, written as 0-9, A-Z, _, ` and a-z, and <n> stands for n
+// colors that shade between their neighbours.
+func parseFractintColors(value string) ([]color.RGBA, error) {
+	if strings.HasPrefix(value, "@") {
+		return nil, errors.New("Map files aren't supported")
+	}
+	digit := func(char byte) (uint8, error) {
+		var level uint8
+		switch {
+		case char >= '0' && char <= '9':
+			level = char - '0'
+		case char >= 'A' && char <= 'Z':
+			level = char - 'A' + 10
+		case char >= '_' && char <= 'z':
+			level = char - '_' + 36
+		default:
+			return 0, fmt.Errorf("Invalid color digit %q", char)
+		}
+		// scale the 6-bit levels of VGA palettes to 8 bits
+		return level<<2 | level>>4, nil
+	}
+	var colors []color.RGBA
+	shades := 0
+	for i := 0; i < len(value); {
+		if value[i] == '<' {
+			end := strings.IndexByte(value[i:], '>')
+			if end < 0 {
+				return nil, errors.New("'<' isn't closed")
+			}
+			count, err := strconv.Atoi(value[i+1 : i+end])
+			if err != nil || count <= 0 || len(colors) == 0 {
+				return nil, fmt.Errorf("Invalid shading %q", value[i:i+end+1])
+			}
+			shades = count
+			i += end + 1
+			continue
+		}
+		if i+3 > len(value) {
+			return nil, errors.New("Each color must have 3 digits")
+		}
+		var levels [3]uint8
+		for j := range levels {
+			level, err := digit(value[i+j])
+			if err != nil {
+				return nil, err
+			}
+			levels[j] = level
+		}
+		next := color.RGBA{levels[0], levels[1], levels[2], 255}
+		if shades > 0 {
+			previous := colors[len(colors)-1]
+			for k := 1; k <= shades; k++ {
+				t := float64(k) / float64(shades+1)
+				shade := func(a, b uint8) uint8 {
+					return uint8(float64(a) + t*(float64(b)-float64(a)) + 0.5)
+				}
+				colors = append(colors, color.RGBA{shade(previous.R, next.R), shade(previous.G, next.G), shade(previous.B, next.B), 255})
+			}
+			shades = 0
+		}
+		colors = append(colors, next)
+		i += 3
+	}
+	if len(colors) < 2 {
+		return nil, errors.New("The palette must have at least 2 colors")
+	}
+	return colors, nil
+}
+
+// Finds an entry by its name, which isn't case sensitive. The first entry is
+// returned when the name is empty.
+func FindFractintPar(pars []FractintPar, name string) (*FractintPar, error) {
+	if len(pars) == 0 {
+		return nil, errors.New("The parameter file has no parameter sets")
+	}
+	if name == "" {
+		return &pars[0], nil
+	}
+	for i := range pars {
+		if strings.EqualFold(pars[i].Name, name) {
+			return &pars[i], nil
+		}
+	}
+	return nil, fmt.Errorf("The parameter set %s wasn't found", name)
+}
+
+// Returns the formula that the entry renders, which is found in the given
+// formulas for the formula type.
+func (par *FractintPar) Formula(formulas []FractintFormula) (*FractintFormula, error) {
+	if par.Type == FRACTINT_TYPE_FORMULA {
+		if formulas == nil {
+			return nil, fmt.Errorf("The formula %s needs its formula file", par.FormulaName)
+		}
+		return FindFractintFormula(formulas, par.FormulaName)
+	}
+	builtIn, err := ParseFractintFormulas(fmt.Sprintf(FRACTINT_TYPE_FORMULAS[par.Type], par.BailOut))
+	if err != nil {
+		return nil, err
+	}
+	return &builtIn[0], nil
+}
+
+// Translates the colors of the entry to a palette of the escape_count
+// coloring that reproduces the colors of Fractint: orbits that escape after n
+// iterations get color n, wrapping around to color 1 after the last one, and
+// bounded orbits get the inside color.
+func (par *FractintPar) ColorPalette(maxIterations int) helpers.ColorPalette {
+	hex := func(c color.RGBA) string {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	transitions := make([]helpers.Transition, 0, maxIterations+1)
+	for n := 0; n < maxIterations; n++ {
+		index := n
+		if index >= len(par.Colors) {
+			index = (n-1)%(len(par.Colors)-1) + 1
+		}
+		transitions = append(transitions, helpers.Transition{
+			Color:    hex(par.Colors[index]),
+			Position: float32(n) / float32(maxIterations),
+		})
+	}
+	transitions = append(transitions, helpers.Transition{Color: hex(par.Colors[par.Inside]), Position: 1})
+	return helpers.ColorPalette{Name: par.Name, Transitions: transitions}
+}
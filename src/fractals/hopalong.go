@@ -1,15 +1,26 @@
 package fractals
 
 import (
+	"errors"
 	"image"
 	"image/color"
 	"image/png"
 	"io"
 	"math"
+	"sort"
+	"strings"
 
 	"github.com/yishakk/fractage/src/helpers"
 )
 
+const (
+	HOPALONG_COLORING_DENSITY = "density"
+	HOPALONG_COLORING_AGE     = "age"
+
+	// Spreads the densities evenly over the palette by their rank.
+	TONE_MAPPING_EQUALIZATION = "equalization"
+)
+
 var (
 	HOPALONG_TYPES = map[string]func(props *Hopalong, xIn, yIn float64) (xOut, yOut float64){
 		"classic_bm":      classic_barry_martin_fractal,
@@ -17,58 +28,217 @@ var (
 		"additive_bm":     additive_barry_martin_fractal,
 		"gingerbread_man": gingerbread_man_fractal,
 	}
+	HOPALONG_COLORINGS = []string{
+		HOPALONG_COLORING_DENSITY,
+		HOPALONG_COLORING_AGE,
+	}
 )
 
 // Properties of a Hopalong image.
 type Hopalong struct {
-	Width           int
-	Height          int
-	Color           color.RGBA
-	UseRandomColors bool
-	A               float64
-	B               float64
-	C               float64
-	D               float64
-	X               float64
-	Y               float64
-	Type            string
-	Scale           float64
-	Resolution      int
-	Background      color.RGBA
+	Width        int
+	Height       int
+	ColorPalette helpers.ColorPalette
+	A            float64
+	B            float64
+	C            float64
+	D            float64
+	X            float64
+	Y            float64
+	Type         string
+	// The number of pixels per unit of x.
+	Scale float64
+	// The point of the plane at the middle of the image.
+	CenterX float64
+	CenterY float64
+	// The ratio of the pixels per unit of y to those per unit of x.
+	Aspect float64
+	// The number of points of the orbit that are plotted.
+	Points int
+	// One of the TONE_MAPPINGS or equalization.
+	ToneMapping string
+	Gamma       float64
+	// density colors the pixels by their density, and age colors them by the
+	// mean iteration at which the orbit landed on them, blended with the
+	// background by their density.
+	Coloring   string
+	Background color.RGBA
+	// The number of points of the orbit that FitFraming finds the bounds of.
+	FitPoints int
+	// The percentage of the points that FitFraming keeps inside the bounds
+	// on each axis, which ignores the outliers.
+	FitPercentile float64
+	// The fraction of the larger side of the fitted bounds that is added
+	// around them.
+	FitMargin float64
+	// Makes FitFraming change the aspect so that the bounds fill the image.
+	FitStretch bool
+}
+
+// Checks if a name exists in the set of TONE_MAPPINGS names or is
+// equalization.
+func IsValidHopalongToneMapping(txt string) bool {
+	toneMapping := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	return toneMapping == TONE_MAPPING_EQUALIZATION || IsValidToneMapping(toneMapping)
+}
+
+// Checks if a name exists in the set of HOPALONG_COLORINGS.
+func IsValidHopalongColoring(txt string) bool {
+	coloringName := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	for _, coloring := range HOPALONG_COLORINGS {
+		if coloring == coloringName {
+			return true
+		}
+	}
+	return false
+}
+
+// Frames the image around the bounds of the first FitPoints points of the
+// orbit by setting the scale, the center and, with FitStretch, the aspect.
+// The bounds are returned.
+func (props *Hopalong) FitFraming() (helpers.Rect, error) {
+	hopalong_fxn, found := HOPALONG_TYPES[props.Type]
+	if !found {
+		return helpers.EMPTY_REGION, errors.New("Invalid type")
+	}
+	x, y := props.X, props.Y
+	xs, ys := make([]float64, 0, props.FitPoints), make([]float64, 0, props.FitPoints)
+	for i := 0; i < props.FitPoints; i++ {
+		x, y = hopalong_fxn(props, x, y)
+		if isFinitePoint(x, y) {
+			xs, ys = append(xs, x), append(ys, y)
+		}
+	}
+	bounds, err := fitOrbitBounds(xs, ys, props.FitPercentile, props.FitMargin)
+	if err != nil {
+		return helpers.EMPTY_REGION, err
+	}
+	width, height := float64(props.Width), float64(props.Height)
+	if props.FitStretch {
+		props.Scale = width / bounds.Width
+		props.Aspect = (height / bounds.Height) / props.Scale
+	} else {
+		props.Scale = math.Min(width/bounds.Width, height/(bounds.Height*props.Aspect))
+	}
+	props.CenterX = bounds.X + bounds.Width/2
+	props.CenterY = bounds.Y + bounds.Height/2
+	return bounds, nil
 }
 
 // Writes the Hopalong image to the given output.
-func (props *Hopalong) WriteImage(output io.Writer) {
+func (props *Hopalong) WriteImage(output io.Writer) error {
 	viewport := image.Rect(0, 0, props.Width, props.Height)
 	img := image.NewRGBA(viewport)
 	helpers.FillImage(img, props.Background)
-	props.render(img)
-	err := png.Encode(output, img)
+	err := props.render(img)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	err = png.Encode(output, img)
+	if err != nil {
+		return err
+	}
+	return nil
 }
 
-// Helper function for rendering the Hopalong.
-func (props *Hopalong) render(img *image.RGBA) {
+// Helper function for rendering the Hopalong. The hits of the orbit on each
+// pixel are accumulated before they're tone mapped, and pixels that the
+// orbit never lands on keep the background.
+func (props *Hopalong) render(img *image.RGBA) error {
+	hopalong_fxn, found := HOPALONG_TYPES[props.Type]
+	if !found {
+		return errors.New("Invalid type")
+	}
+	err := props.ColorPalette.TranslateColorTransitions()
+	if err != nil {
+		return err
+	}
 	x, y := props.X, props.Y
 	midX, midY := float64(props.Width)/2.0, float64(props.Height)/2.0
-	ptColor := props.Color
-	if props.UseRandomColors {
-		ptColor = helpers.RandomColor()
-	}
-	hopalong_fxn := HOPALONG_TYPES[props.Type]
-	for i := 0; i < props.Width; i++ {
-		for j := 0; j < props.Height; j++ {
-			for k := 0; k < props.Resolution; k++ {
-				x, y = hopalong_fxn(props, x, y)
-				if props.UseRandomColors && i%50 == 0 {
-					ptColor = helpers.RandomColor()
+	age := strings.Trim(props.Coloring, helpers.WHITESPACE_CUTSET) == HOPALONG_COLORING_AGE
+	density := make([]float64, props.Width*props.Height)
+	var ages []float64
+	if age {
+		ages = make([]float64, len(density))
+	}
+	for i := 0; i < props.Points; i++ {
+		x, y = hopalong_fxn(props, x, y)
+		px := int(math.Floor(midX + (x-props.CenterX)*props.Scale))
+		py := int(math.Floor(midY - (y-props.CenterY)*props.Scale*props.Aspect))
+		if px < 0 || px >= props.Width || py < 0 || py >= props.Height {
+			continue
+		}
+		index := py*props.Width + px
+		density[index]++
+		if age {
+			ages[index] += float64(i) / float64(props.Points)
+		}
+	}
+	brightness, err := props.toneMap(density)
+	if err != nil {
+		return err
+	}
+	for py := 0; py < props.Height; py++ {
+		for px := 0; px < props.Width; px++ {
+			index := py*props.Width + px
+			if density[index] == 0 {
+				continue
+			}
+			if !age {
+				pixelColor, err := props.ColorPalette.GetColor(brightness[index])
+				if err != nil {
+					return err
 				}
-				img.Set(int(midX+x*props.Scale), int(midY-y*props.Scale), ptColor)
+				img.Set(px, py, pixelColor)
+				continue
 			}
+			pixelColor, err := props.ColorPalette.GetColor(ages[index] / density[index])
+			if err != nil {
+				return err
+			}
+			img.Set(px, py, blendColors(props.Background, pixelColor, brightness[index]))
+		}
+	}
+	return nil
+}
+
+// Maps the density of each pixel to a brightness between 0 and 1. The
+// equalization tone mapping gives each density the fraction of the visited
+// pixels whose densities are at most as high.
+func (props *Hopalong) toneMap(density []float64) ([]float64, error) {
+	toneMappingName := strings.Trim(props.ToneMapping, helpers.WHITESPACE_CUTSET)
+	brightness := make([]float64, len(density))
+	if toneMappingName == TONE_MAPPING_EQUALIZATION {
+		visited := make([]float64, 0, len(density))
+		for _, count := range density {
+			if count > 0 {
+				visited = append(visited, count)
+			}
+		}
+		sort.Float64s(visited)
+		for index, count := range density {
+			if count == 0 {
+				continue
+			}
+			rank := sort.Search(len(visited), func(i int) bool { return visited[i] > count })
+			brightness[index] = float64(rank) / float64(len(visited))
+		}
+		return brightness, nil
+	}
+	toneMapping, found := TONE_MAPPINGS[toneMappingName]
+	if !found {
+		return nil, errors.New("Invalid tone mapping")
+	}
+	maxCount := 0.0
+	for _, count := range density {
+		maxCount = math.Max(maxCount, count)
+	}
+	for index, count := range density {
+		if count > 0 {
+			brightness[index] = toneMapping(count, maxCount, props.Gamma)
 		}
 	}
+	return brightness, nil
 }
 
 func classic_barry_martin_fractal(props *Hopalong, xIn, yIn float64) (xOut, yOut float64) {
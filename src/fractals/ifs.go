@@ -8,7 +8,6 @@ import (
 	"io"
 	"math"
 	"math/rand"
-	"strconv"
 
 	"github.com/yishakk/fractage/src/helpers"
 )
@@ -113,59 +112,28 @@ func (props *IteratedFunctionSystem) render(img *image.RGBA) {
 
 // Retrieves a comma-separated list of the variables for each set of the IFS.
 func GetIFSVariables(txt string) ([][IFS_FXN_VARIABLES_COUNT]float64, error) {
-	values, err := helpers.GetCSV(txt)
+	tokens, err := helpers.TokenizeParameters(txt)
 	if err != nil {
 		return nil, err
 	}
-	if len(values)%IFS_FXN_VARIABLES_COUNT != 0 {
+	if len(tokens) == 0 || len(tokens)%IFS_FXN_VARIABLES_COUNT != 0 {
 		return nil, errors.New("Incomplete IFS variables provided.")
 	}
-	count := len(values) / IFS_FXN_VARIABLES_COUNT
+	count := len(tokens) / IFS_FXN_VARIABLES_COUNT
 	functions := make([][IFS_FXN_VARIABLES_COUNT]float64, count)
-	for i, j := 0, 0; i < len(values); i += IFS_FXN_VARIABLES_COUNT {
-		a, err := strconv.ParseFloat(values[i+IFS_FXN_INDEX_A], 64)
+	for i := 0; i < len(tokens); i++ {
+		value, err := tokens[i].Float()
 		if err != nil {
 			return nil, err
 		}
-		b, err := strconv.ParseFloat(values[i+IFS_FXN_INDEX_B], 64)
-		if err != nil {
-			return nil, err
-		}
-		c, err := strconv.ParseFloat(values[i+IFS_FXN_INDEX_C], 64)
-		if err != nil {
-			return nil, err
-		}
-		d, err := strconv.ParseFloat(values[i+IFS_FXN_INDEX_D], 64)
-		if err != nil {
-			return nil, err
-		}
-		e, err := strconv.ParseFloat(values[i+IFS_FXN_INDEX_E], 64)
-		if err != nil {
-			return nil, err
-		}
-		f, err := strconv.ParseFloat(values[i+IFS_FXN_INDEX_F], 64)
-		if err != nil {
-			return nil, err
-		}
-		probability, err := strconv.ParseFloat(values[i+IFS_FXN_INDEX_PROBABILITY], 64)
-		if err != nil {
-			return nil, err
-		}
-		functions[j][IFS_FXN_INDEX_A] = a
-		functions[j][IFS_FXN_INDEX_B] = b
-		functions[j][IFS_FXN_INDEX_C] = c
-		functions[j][IFS_FXN_INDEX_D] = d
-		functions[j][IFS_FXN_INDEX_E] = e
-		functions[j][IFS_FXN_INDEX_F] = f
-		functions[j][IFS_FXN_INDEX_PROBABILITY] = probability
-		j++
+		functions[i/IFS_FXN_VARIABLES_COUNT][i%IFS_FXN_VARIABLES_COUNT] = value
 	}
 	return functions, nil
 }
 
 // Retrieves a slice of colors for the IFS.
 func GetIFSColors(txt string, count int) []color.RGBA {
-	values, err := helpers.GetCSV(txt)
+	values, err := helpers.GetParameterValues(txt)
 	colors := make([]color.RGBA, count)
 	for i := 0; i < count; i++ {
 		if err != nil || i >= len(values) {
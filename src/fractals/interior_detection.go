@@ -0,0 +1,152 @@
+package fractals
+
+const (
+	PIXEL_STATE_UNKNOWN pixelState = iota
+	PIXEL_STATE_ESCAPED
+	// The orbit didn't escape within the maximum number of iterations.
+	PIXEL_STATE_BOUNDED
+	// The orbit was proven to stay bounded forever.
+	PIXEL_STATE_INTERIOR
+)
+
+const (
+	// Rectangles whose sides are shorter than this number of pixels are
+	// rendered pixel by pixel instead of being subdivided.
+	MARIANI_SILVER_MIN_SIZE = 8
+)
+
+// Specifies if the orbit of a pixel was computed and whether it escaped.
+type pixelState uint8
+
+// Counts the iterations of an escape-time render.
+type EscapeTimeStats struct {
+	// Specifies if the render counted its iterations, which only float64
+	// renders do.
+	Measured bool
+	// The number of iterations that were computed.
+	Iterations int64
+	// The number of iterations that interior detection skipped for orbits
+	// that stay bounded.
+	IterationsSaved int64
+}
+
+// Detects orbits that return to one of their earlier points with Brent's
+// method, which compares each point with the one at the last power of two.
+// Points are compared exactly, so a detected orbit would cycle forever.
+type cycleDetector struct {
+	saved  complex128
+	power  int
+	length int
+}
+
+func newCycleDetector(z complex128) cycleDetector {
+	return cycleDetector{saved: z, power: 1}
+}
+
+// Receives the next point of the orbit and returns true if the orbit cycles.
+func (detector *cycleDetector) Visit(z complex128) bool {
+	if z == detector.saved {
+		return true
+	}
+	detector.length++
+	if detector.length == detector.power {
+		detector.saved = z
+		detector.power *= 2
+		detector.length = 0
+	}
+	return false
+}
+
+// Checks if c is inside the main cardioid or the period-2 bulb of the
+// Mandelbrot set of z^2 + c.
+func inMainCardioidOrBulb(c complex128) bool {
+	x, y := real(c), imag(c)
+	q := (x-0.25)*(x-0.25) + y*y
+	if q*(q+(x-0.25)) < 0.25*y*y {
+		return true
+	}
+	return (x+1)*(x+1)+y*y < 0.0625
+}
+
+// Checks if a coloring colors all bounded orbits the same way, so their
+// iterations can be skipped.
+func allowsInteriorDetection(coloring EscapeTimeColoring) bool {
+	_, dependsOnOrbit := coloring.(*orbitTrapColoring)
+	return !dependsOnOrbit
+}
+
+// Renders the rectangle between the given corners with the Mariani-Silver
+// algorithm. A rectangle whose border is proven to be inside the set is
+// filled with the color of bounded orbits, since the Mandelbrot set has no
+// holes. Other rectangles are split into four. Borders that merely didn't
+// escape within the maximum number of iterations aren't trusted, because
+// thin filaments of late escaping pixels can pass between their pixels.
+func (render *mandelbrotRender) renderRect(x0, y0, x1, y1 int) error {
+	if x1-x0 < MARIANI_SILVER_MIN_SIZE || y1-y0 < MARIANI_SILVER_MIN_SIZE {
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				_, err := render.renderPixel(x, y)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	uniform := true
+	for x := x0; x <= x1; x++ {
+		for _, y := range []int{y0, y1} {
+			interior, err := render.renderPixel(x, y)
+			if err != nil {
+				return err
+			}
+			uniform = uniform && interior
+		}
+	}
+	for y := y0 + 1; y < y1; y++ {
+		for _, x := range []int{x0, x1} {
+			interior, err := render.renderPixel(x, y)
+			if err != nil {
+				return err
+			}
+			uniform = uniform && interior
+		}
+	}
+	if uniform {
+		return render.fillBounded(x0+1, y0+1, x1-1, y1-1)
+	}
+	midX, midY := (x0+x1)/2, (y0+y1)/2
+	for _, rect := range [][4]int{
+		{x0, y0, midX, midY},
+		{midX, y0, x1, midY},
+		{x0, midY, midX, y1},
+		{midX, midY, x1, y1},
+	} {
+		err := render.renderRect(rect[0], rect[1], rect[2], rect[3])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Colors the pixels of a rectangle as bounded orbits without iterating them.
+func (render *mandelbrotRender) fillBounded(x0, y0, x1, y1 int) error {
+	props := render.props
+	pixelColor, err := escapeTimePixelColor(&props.ColorPalette, render.coloring, 0, props.MaxIterations, false)
+	if err != nil {
+		return err
+	}
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			index := y*props.Width + x
+			if render.states[index] != PIXEL_STATE_UNKNOWN {
+				continue
+			}
+			render.img.Set(x, y, pixelColor)
+			render.states[index] = PIXEL_STATE_INTERIOR
+			render.stats.IterationsSaved += int64(props.MaxIterations)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package fractals
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+const (
+	JULIA_ATLAS_DEFAULT_COLUMNS            = 8
+	JULIA_ATLAS_DEFAULT_ROWS               = 6
+	JULIA_ATLAS_MAX_CELLS                  = 1024
+	JULIA_ATLAS_DEFAULT_CELL_WIDTH         = 171
+	JULIA_ATLAS_DEFAULT_CELL_HEIGHT        = 128
+	JULIA_ATLAS_MAX_CELL_SIZE              = 2048
+	JULIA_ATLAS_MAX_PIXELS                 = 32 * 1024 * 1024
+	JULIA_ATLAS_DEFAULT_ITERATIONS         = 100
+	JULIA_ATLAS_DEFAULT_REGION             = "-2, -1.25, 2.5, 2.5"
+	JULIA_ATLAS_DEFAULT_MANDELBROT_OPACITY = 0.35
+	JULIA_ATLAS_MANDELBROT_ITERATIONS      = 200
+	JULIA_ATLAS_MANDELBROT_BAIL_OUT        = 20
+	JULIA_ATLAS_MANDELBROT_COLOR_PALETTE   = "grayscale"
+)
+
+// Properties of a grid of Julia sets, whose cells use the value of c at their
+// center within the parameter region.
+type JuliaAtlas struct {
+	Columns    int
+	Rows       int
+	CellWidth  int
+	CellHeight int
+	// The region of the parameter plane that the grid covers.
+	Region helpers.Rect
+	// The Julia set of every cell, whose size and c are replaced.
+	Julia JuliaSet
+	// The set drawn behind the cells, whose size and region are replaced. No
+	// background is drawn when it's nil.
+	Mandelbrot *MandelbrotSet
+	// The weight of the Mandelbrot set in the color of each pixel.
+	MandelbrotOpacity float64
+	Workers           int
+}
+
+// A cell of a Julia atlas and its position in the image. C is formatted like
+// the c parameter of Julia sets.
+type JuliaAtlasCell struct {
+	Column int    `json:"column"`
+	Row    int    `json:"row"`
+	C      string `json:"c"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	c      complex128
+}
+
+// The cells of a Julia atlas in row-major order.
+type JuliaAtlasMap struct {
+	Columns int              `json:"columns"`
+	Rows    int              `json:"rows"`
+	Width   int              `json:"width"`
+	Height  int              `json:"height"`
+	Cells   []JuliaAtlasCell `json:"cells"`
+}
+
+// Returns the cells of the atlas, whose values of c map the centers of the
+// cells to the region like the pixels of the other escape-time fractals.
+func (props *JuliaAtlas) Cells() []JuliaAtlasCell {
+	width := float64(props.Columns * props.CellWidth)
+	height := float64(props.Rows * props.CellHeight)
+	step := math.Max(props.Region.Width/width, props.Region.Height/height)
+	xOffset := props.Region.X - (width*step-props.Region.Width)/2.0
+	yOffset := props.Region.Y - (height*step-props.Region.Height)/2.0
+	cells := make([]JuliaAtlasCell, 0, props.Columns*props.Rows)
+	for row := 0; row < props.Rows; row++ {
+		for column := 0; column < props.Columns; column++ {
+			x, y := column*props.CellWidth, row*props.CellHeight
+			c := complex(
+				xOffset+(float64(x)+float64(props.CellWidth)/2.0)*step,
+				yOffset+(float64(y)+float64(props.CellHeight)/2.0)*step,
+			)
+			cells = append(cells, JuliaAtlasCell{
+				Column: column,
+				Row:    row,
+				C:      strings.Trim(strconv.FormatComplex(c, 'g', -1, 128), "()"),
+				X:      x,
+				Y:      y,
+				Width:  props.CellWidth,
+				Height: props.CellHeight,
+				c:      c,
+			})
+		}
+	}
+	return cells
+}
+
+// Writes the cells of the atlas as JSON to the given output.
+func (props *JuliaAtlas) WriteMap(output io.Writer) error {
+	err := props.ValidateSize()
+	if err != nil {
+		return err
+	}
+	atlasMap := JuliaAtlasMap{
+		Columns: props.Columns,
+		Rows:    props.Rows,
+		Width:   props.Columns * props.CellWidth,
+		Height:  props.Rows * props.CellHeight,
+		Cells:   props.Cells(),
+	}
+	return json.NewEncoder(output).Encode(atlasMap)
+}
+
+// Checks that the atlas has between 1 and JULIA_ATLAS_MAX_CELLS cells and
+// that its image has at most JULIA_ATLAS_MAX_PIXELS pixels.
+func (props *JuliaAtlas) ValidateSize() error {
+	if props.Columns <= 0 || props.Rows <= 0 || props.CellWidth <= 0 || props.CellHeight <= 0 {
+		return errors.New("The atlas must have at least one cell of at least one pixel")
+	}
+	if props.Columns*props.Rows > JULIA_ATLAS_MAX_CELLS {
+		return fmt.Errorf("Too many cells. Max: %d", JULIA_ATLAS_MAX_CELLS)
+	}
+	width, height := props.Columns*props.CellWidth, props.Rows*props.CellHeight
+	if width*height > JULIA_ATLAS_MAX_PIXELS {
+		return fmt.Errorf("The image of the atlas is too large: %dx%d pixels. Max: %d pixels", width, height, JULIA_ATLAS_MAX_PIXELS)
+	}
+	return nil
+}
+
+// Writes the Julia atlas image to the given output.
+func (props *JuliaAtlas) WriteImage(output io.Writer) error {
+	err := props.ValidateSize()
+	if err != nil {
+		return err
+	}
+	viewport := image.Rect(0, 0, props.Columns*props.CellWidth, props.Rows*props.CellHeight)
+	img := image.NewRGBA(viewport)
+	helpers.FillImage(img, props.Julia.Background)
+	err = props.render(img)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(output, img)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Helper function for rendering the Julia atlas.
+func (props *JuliaAtlas) render(img *image.RGBA) error {
+	var background *image.RGBA
+	if props.Mandelbrot != nil {
+		mandelbrot := *props.Mandelbrot
+		mandelbrot.Width = img.Bounds().Dx()
+		mandelbrot.Height = img.Bounds().Dy()
+		mandelbrot.Region = props.Region
+		mandelbrot.Center = nil
+		background = image.NewRGBA(img.Bounds())
+		helpers.FillImage(background, mandelbrot.Background)
+		err := mandelbrot.render(background)
+		if err != nil {
+			return err
+		}
+	}
+	cells := props.Cells()
+	errs := make([]error, len(cells))
+	next := make(chan int)
+	workers := int(math.Max(1, float64(props.Workers)))
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = props.renderCell(img, background, cells[i])
+			}
+		}()
+	}
+	for i := range cells {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Renders the Julia set of a cell into its part of the image, blended with the
+// background when there is one.
+func (props *JuliaAtlas) renderCell(img, background *image.RGBA, cell JuliaAtlasCell) error {
+	julia := props.Julia
+	julia.Width = cell.Width
+	julia.Height = cell.Height
+	julia.C = cell.c
+	// every cell translates the colors of its own transitions
+	julia.ColorPalette.Transitions = append([]helpers.Transition(nil), props.Julia.ColorPalette.Transitions...)
+	cellImg := image.NewRGBA(image.Rect(0, 0, cell.Width, cell.Height))
+	helpers.FillImage(cellImg, julia.Background)
+	err := julia.render(cellImg)
+	if err != nil {
+		return err
+	}
+	bounds := image.Rect(cell.X, cell.Y, cell.X+cell.Width, cell.Y+cell.Height)
+	if background == nil {
+		draw.Draw(img, bounds, cellImg, image.Point{}, draw.Src)
+		return nil
+	}
+	opacity := math.Max(0, math.Min(1, props.MandelbrotOpacity))
+	blend := func(a, b uint8) uint8 {
+		return uint8(math.Round((1-opacity)*float64(a) + opacity*float64(b)))
+	}
+	for y := 0; y < cell.Height; y++ {
+		for x := 0; x < cell.Width; x++ {
+			cellColor := cellImg.RGBAAt(x, y)
+			backgroundColor := background.RGBAAt(cell.X+x, cell.Y+y)
+			img.SetRGBA(cell.X+x, cell.Y+y, color.RGBA{
+				R: blend(cellColor.R, backgroundColor.R),
+				G: blend(cellColor.G, backgroundColor.G),
+				B: blend(cellColor.B, backgroundColor.B),
+				A: 255,
+			})
+		}
+	}
+	return nil
+}
@@ -25,6 +25,8 @@ const (
 	JULIA_SET_DEFAULT_VARIABLES_TEXT = "i=3+0i, k=0.0-0.01i"
 	JULIA_SET_DEFAULT_VARIABLE_I     = 3 + 0i
 	JULIA_SET_DEFAULT_VARIABLE_K     = 0.0 - 0.01i
+	JULIA_SET_DEFAULT_COLORING       = ESCAPE_TIME_COLORING_EXPONENTIAL
+	JULIA_SET_DEFAULT_EXPONENT       = 2
 )
 
 var (
@@ -57,6 +59,39 @@ var (
 		"abs_asinh4": func(props *JuliaSet) func(complex128) complex128 { return absTrig(props, cmplx.Asinh) },
 		"abs_acosh4": func(props *JuliaSet) func(complex128) complex128 { return absTrig(props, cmplx.Acosh) },
 		"abs_atanh4": func(props *JuliaSet) func(complex128) complex128 { return absTrig(props, cmplx.Atanh) },
+		MANDELBROT_VARIANT_BURNING_SHIP: func(props *JuliaSet) func(complex128) complex128 {
+			return variantSeries(props, MANDELBROT_VARIANT_BURNING_SHIP)
+		},
+		MANDELBROT_VARIANT_TRICORN: func(props *JuliaSet) func(complex128) complex128 {
+			return variantSeries(props, MANDELBROT_VARIANT_TRICORN)
+		},
+		MANDELBROT_VARIANT_CELTIC: func(props *JuliaSet) func(complex128) complex128 {
+			return variantSeries(props, MANDELBROT_VARIANT_CELTIC)
+		},
+		MANDELBROT_VARIANT_PERPENDICULAR: func(props *JuliaSet) func(complex128) complex128 {
+			return variantSeries(props, MANDELBROT_VARIANT_PERPENDICULAR)
+		},
+		MANDELBROT_VARIANT_BUFFALO: func(props *JuliaSet) func(complex128) complex128 {
+			return variantSeries(props, MANDELBROT_VARIANT_BUFFALO)
+		},
+	}
+	// The degrees of the polynomial series, which smooth colorings depend on.
+	// Other series use JULIA_SET_DEFAULT_EXPONENT as an approximation.
+	JULIA_SET_SERIES_EXPONENTS = map[string]float64{
+		"classic":                        2,
+		"phoenix":                        2,
+		MANDELBROT_VARIANT_BURNING_SHIP:  2,
+		MANDELBROT_VARIANT_TRICORN:       2,
+		MANDELBROT_VARIANT_CELTIC:        2,
+		MANDELBROT_VARIANT_PERPENDICULAR: 2,
+		MANDELBROT_VARIANT_BUFFALO:       2,
+	}
+	// The derivatives of the series that distance estimation colorings
+	// support.
+	JULIA_SET_SERIES_DERIVATIVES = map[string]func(*JuliaSet) func(complex128) complex128{
+		"classic": func(props *JuliaSet) func(complex128) complex128 {
+			return func(z complex128) complex128 { return 2 * z }
+		},
 	}
 )
 
@@ -71,9 +106,33 @@ type JuliaSet struct {
 	BailOut            float64
 	Region             helpers.Rect
 	SeriesFunctionName string
-	Background         color.RGBA
-	zPrev              complex128
-	zNext              complex128
+	Coloring           string
+	OrbitTrap          *OrbitTrap
+	DistanceThickness  float64
+	AntiAlias          bool
+	Center             *helpers.BigPoint
+	Precision          string
+	// A formula that replaces the series, in which z starts at the pixel.
+	Formula    string
+	Parameters map[string]complex128
+	// A Fractint formula that replaces the series and the bail-out.
+	Fractint           *FractintFormula
+	FractintParameters FractintParameters
+	// The rendering method, which is escape_time when it's empty.
+	Method string
+	// The method that drew the last render, which is boundary_scan when miim
+	// falls back to it.
+	RenderedMethod string
+	// The number of points of the iim method.
+	Points int
+	// The maximum number of visits of each pixel of the miim method.
+	Density int
+	// The seed of the random points of the iim method.
+	Seed       int64
+	Background color.RGBA
+	zPrev      complex128
+	zNext      complex128
+	pixel      complex128
 }
 
 // Creates a function that computes the sum of c and the absolute value of
@@ -122,31 +181,87 @@ func (props *JuliaSet) render(img *image.RGBA) error {
 	}
 	var pixelColor color.RGBA
 	var n int
-	seriesFunction := JULIA_SET_SERIES[props.SeriesFunctionName](props)
+	var seriesFunction func(complex128) complex128
+	exponent, found := JULIA_SET_SERIES_EXPONENTS[props.SeriesFunctionName]
+	if props.Fractint != nil {
+		found = false
+	} else if props.Formula != "" {
+		formula, err := newFormulaSeries(props.Formula, props.Parameters)
+		if err != nil {
+			return err
+		}
+		seriesFunction = func(z complex128) complex128 {
+			return formula.Next(z, props.zPrev, props.C, props.pixel)
+		}
+		found = false
+	} else {
+		seriesFunction = JULIA_SET_SERIES[props.SeriesFunctionName](props)
+	}
+	if !found {
+		exponent = JULIA_SET_DEFAULT_EXPONENT
+	}
+	method := strings.Trim(props.Method, helpers.WHITESPACE_CUTSET)
+	if method != "" && method != JULIA_SET_METHOD_ESCAPE_TIME {
+		return props.renderWithMethod(img, method, seriesFunction, xOffset, yOffset, step)
+	}
+	props.RenderedMethod = JULIA_SET_METHOD_ESCAPE_TIME
+	coloring := NewEscapeTimeColoring(props.Coloring, EscapeTimeOrbit{
+		MaxIterations:     props.MaxIterations,
+		Exponent:          exponent,
+		Trap:              props.OrbitTrap,
+		PixelSize:         step,
+		DistanceThickness: props.DistanceThickness,
+		AntiAlias:         props.AntiAlias,
+	})
+	derivativeColoring, tracksDerivative := coloring.(EscapeTimeDerivativeColoring)
+	var seriesDerivative func(complex128) complex128
+	if tracksDerivative {
+		derivativeFunction, found := JULIA_SET_SERIES_DERIVATIVES[props.SeriesFunctionName]
+		if !found || props.Formula != "" || props.Fractint != nil {
+			return errors.New("Distance estimation colorings aren't supported by this series")
+		}
+		seriesDerivative = derivativeFunction(props)
+	}
+	bailOut := math.Max(props.BailOut, coloring.MinBailOut())
+	supportedPrecisions := []string{PRECISION_FLOAT64}
+	if _, found := JULIA_SET_DOUBLE_DOUBLE_SERIES[props.SeriesFunctionName]; found && props.Formula == "" && props.Fractint == nil {
+		supportedPrecisions = []string{PRECISION_FLOAT64, PRECISION_DOUBLE_DOUBLE}
+	}
+	switch choosePrecision(props.Precision, props.Region, step, supportedPrecisions) {
+	case PRECISION_DOUBLE_DOUBLE:
+		return props.renderDoubleDouble(img, coloring, bailOut, step)
+	case PRECISION_BIG:
+		return errors.New("The big precision is only supported by the Mandelbrot set")
+	}
+	if props.Fractint != nil {
+		return props.renderFractint(img, coloring, xOffset, yOffset, step)
+	}
 	for y := 0; y < int(height); y++ {
 		for x := 0; x < int(width); x++ {
 			n = 0
 			Z := complex(xOffset+float64(x)*step, yOffset+float64(y)*step)
 			props.zPrev = Z
 			props.zNext = Z
-			seriesValue := math.Exp(-cmplx.Abs(Z))
-			for (n < props.MaxIterations) && (cmplx.Abs(Z) < props.BailOut) {
+			props.pixel = Z
+			dZ, dNext := 1+0i, 1+0i
+			coloring.Reset(Z)
+			for (n < props.MaxIterations) && (cmplx.Abs(Z) < bailOut) {
 				props.zPrev = Z
 				Z = props.zNext
 				props.zNext = seriesFunction(Z)
-				seriesValue += math.Exp(-cmplx.Abs(Z))
+				if tracksDerivative {
+					dZ = dNext
+					dNext = seriesDerivative(Z) * dZ
+				}
+				coloring.Visit(Z)
 				n++
 			}
-			if n < props.MaxIterations {
-				pixelColor, err = props.ColorPalette.GetColor(seriesValue / float64(props.MaxIterations))
-				if err != nil {
-					return err
-				}
-			} else {
-				pixelColor, err = props.ColorPalette.GetColor(1)
-				if err != nil {
-					return err
-				}
+			if tracksDerivative {
+				derivativeColoring.SetDerivative(dZ)
+			}
+			pixelColor, err = escapeTimePixelColor(&props.ColorPalette, coloring, Z, n, n < props.MaxIterations)
+			if err != nil {
+				return err
 			}
 			img.Set(x, y, pixelColor)
 		}
@@ -177,29 +292,26 @@ func (props *JuliaSet) GetVaraible(c rune, defaultValue complex128) complex128 {
 
 // Converts a comma-separated list of variable assignments to a map of runes and complex numbers.
 func ParseJuliaSetVariables(txt string) (map[rune]complex128, error) {
-	values, err := helpers.GetCSV(txt)
+	tokens, err := helpers.TokenizeParameters(txt)
 	if err != nil {
 		return nil, err
 	}
-	variables := make(map[rune]complex128, len(values))
-	for i := 0; i < len(values); i++ {
-		rule := strings.Trim(values[i], helpers.WHITESPACE_CUTSET)
-		before, after, found := strings.Cut(rule, "=")
-		if found {
-			variable := []rune(strings.Trim(before, helpers.WHITESPACE_CUTSET))
-			if len(variable) == 1 {
-				valueText := strings.Trim(after, helpers.WHITESPACE_CUTSET)
-				value, err := strconv.ParseComplex(valueText, 128)
-				if err != nil {
-					return nil, err
-				}
-				variables[variable[0]] = value
-			} else {
-				return nil, errors.New("A variable must be a single character")
-			}
-		} else {
-			return nil, errors.New("Invalid variable assignment. It must be of the form variable=value")
+	variables := make(map[rune]complex128, len(tokens))
+	for _, token := range tokens {
+		before, after, found := strings.Cut(token.Value, "=")
+		if !found {
+			return nil, token.Errorf("Invalid variable assignment. It must be of the form variable=value")
+		}
+		variable := []rune(strings.Trim(before, helpers.WHITESPACE_CUTSET))
+		if len(variable) != 1 {
+			return nil, token.Errorf("A variable must be a single character")
+		}
+		valueText := strings.Trim(after, helpers.WHITESPACE_CUTSET)
+		value, err := strconv.ParseComplex(valueText, 128)
+		if err != nil {
+			return nil, token.Errorf("Invalid complex number %q", valueText)
 		}
+		variables[variable[0]] = value
 	}
 	return variables, nil
 }
@@ -0,0 +1,264 @@
+package fractals
+
+import (
+	"errors"
+	"image"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"strings"
+
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+const (
+	JULIA_SET_METHOD_ESCAPE_TIME   = "escape_time"
+	JULIA_SET_METHOD_IIM           = "iim"
+	JULIA_SET_METHOD_MIIM          = "miim"
+	JULIA_SET_METHOD_BOUNDARY_SCAN = "boundary_scan"
+
+	JULIA_SET_DEFAULT_METHOD  = JULIA_SET_METHOD_ESCAPE_TIME
+	JULIA_SET_DEFAULT_POINTS  = 1_000_000
+	JULIA_SET_MAX_POINTS      = 100_000_000
+	JULIA_SET_DEFAULT_DENSITY = 4
+	JULIA_SET_MAX_DENSITY     = 10_000
+	JULIA_SET_DEFAULT_SEED    = 1
+	// The number of points of the iim method that are skipped while they
+	// approach the Julia set.
+	IIM_SKIPPED_POINTS = 50
+	// The number of cells in each direction of the grid that caps the visits
+	// of the miim method outside of the image.
+	MIIM_OVERVIEW_SIZE = 1024
+	// The most pixels that fit in the width of a cell of the grid of the miim
+	// method. Deeper zooms visit too many preimages outside of the image, so
+	// they're drawn with the boundary_scan method instead.
+	MIIM_MAX_OVERVIEW_ZOOM = 64
+	// The miim method visits at most this many preimages for each of the
+	// points of the iim method.
+	MIIM_VISITS_PER_POINT = 10
+)
+
+var (
+	JULIA_SET_METHODS = []string{
+		JULIA_SET_METHOD_ESCAPE_TIME,
+		JULIA_SET_METHOD_IIM,
+		JULIA_SET_METHOD_MIIM,
+		JULIA_SET_METHOD_BOUNDARY_SCAN,
+	}
+)
+
+// Checks if a name exists in the set of JULIA_SET_METHODS.
+func IsValidJuliaSetMethod(txt string) bool {
+	methodName := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	for _, method := range JULIA_SET_METHODS {
+		if method == methodName {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if a method draws the boundary of z^2 + c by inverse iteration,
+// which only the classic series supports.
+func IsInverseIterationMethod(txt string) bool {
+	methodName := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	return methodName == JULIA_SET_METHOD_IIM || methodName == JULIA_SET_METHOD_MIIM
+}
+
+// Renders the Julia set with a method other than escape_time, which draws the
+// boundary of the set as points on the background.
+func (props *JuliaSet) renderWithMethod(img *image.RGBA, method string, seriesFunction func(complex128) complex128, xOffset, yOffset, step float64) error {
+	if props.Fractint != nil {
+		return errors.New("Fractint formulas only support the escape_time method")
+	}
+	if props.Precision != PRECISION_AUTO && props.Precision != PRECISION_FLOAT64 {
+		return errors.New("The iim, miim and boundary_scan methods only support the float64 precision")
+	}
+	if IsInverseIterationMethod(method) && (props.Formula != "" || props.SeriesFunctionName != "classic") {
+		return errors.New("The iim and miim methods are only supported by the classic series")
+	}
+	plot := newBoundaryPlot(props, xOffset, yOffset, step)
+	switch method {
+	case JULIA_SET_METHOD_IIM:
+		plot.inverseIteration()
+	case JULIA_SET_METHOD_MIIM:
+		if _, overviewStep := plot.miimOverview(); overviewStep/step > MIIM_MAX_OVERVIEW_ZOOM {
+			method = JULIA_SET_METHOD_BOUNDARY_SCAN
+			plot.boundaryScan(seriesFunction)
+		} else {
+			plot.modifiedInverseIteration()
+		}
+	case JULIA_SET_METHOD_BOUNDARY_SCAN:
+		plot.boundaryScan(seriesFunction)
+	default:
+		return errors.New("Invalid method")
+	}
+	props.RenderedMethod = method
+	return plot.draw(img)
+}
+
+// The weights of the pixels of a Julia set drawn as points.
+type boundaryPlot struct {
+	props   *JuliaSet
+	xOffset float64
+	yOffset float64
+	step    float64
+	// The weight of each pixel, which is 0 for pixels that aren't drawn.
+	weights []float64
+}
+
+func newBoundaryPlot(props *JuliaSet, xOffset, yOffset, step float64) *boundaryPlot {
+	return &boundaryPlot{
+		props:   props,
+		xOffset: xOffset,
+		yOffset: yOffset,
+		step:    step,
+		weights: make([]float64, props.Width*props.Height),
+	}
+}
+
+// Returns the index of the pixel of z, and false if z is outside the image.
+func (plot *boundaryPlot) pixelIndex(z complex128) (int, bool) {
+	x := int(math.Round((real(z) - plot.xOffset) / plot.step))
+	y := int(math.Round((imag(z) - plot.yOffset) / plot.step))
+	if x < 0 || x >= plot.props.Width || y < 0 || y >= plot.props.Height {
+		return 0, false
+	}
+	return y*plot.props.Width + x, true
+}
+
+// Returns the repelling fixed point of z^2 + c, which is on the Julia set.
+func (plot *boundaryPlot) repellingFixedPoint() complex128 {
+	return (1 + cmplx.Sqrt(1-4*plot.props.C)) / 2
+}
+
+// Plots the points of a random walk backwards along z^2 + c, which takes one
+// of the square roots of z - c at random at each step. The points approach
+// the Julia set, but they rarely reach the parts of it that attract few of
+// the preimages.
+func (plot *boundaryPlot) inverseIteration() {
+	random := rand.New(rand.NewSource(plot.props.Seed))
+	z := plot.repellingFixedPoint()
+	for i := 0; i < IIM_SKIPPED_POINTS+plot.props.Points; i++ {
+		z = cmplx.Sqrt(z - plot.props.C)
+		if random.Intn(2) == 0 {
+			z = -z
+		}
+		if i < IIM_SKIPPED_POINTS {
+			continue
+		}
+		if index, inside := plot.pixelIndex(z); inside {
+			plot.weights[index]++
+		}
+	}
+}
+
+// Returns the radius of the disk that the Julia set lies within, and the
+// width of the cells of the grid of the miim method that covers it.
+func (plot *boundaryPlot) miimOverview() (radius, step float64) {
+	radius = math.Max(2, cmplx.Abs(plot.props.C))
+	return radius, 2 * radius / MIIM_OVERVIEW_SIZE
+}
+
+// Plots the tree of the preimages of the repelling fixed point depth-first,
+// up to a depth of MaxIterations. A branch stops at a pixel that was already
+// visited Density times, so the sparse parts of the Julia set get as many
+// points as the dense parts. At most MIIM_VISITS_PER_POINT times Points
+// preimages are visited.
+func (plot *boundaryPlot) modifiedInverseIteration() {
+	props := plot.props
+	// the visits of points outside of the image are capped by cells, which
+	// the set crosses about as many times as the pixels that fit in their
+	// width
+	radius, overviewStep := plot.miimOverview()
+	overviewDensity := props.Density * int(math.Max(1, math.Ceil(overviewStep/plot.step)))
+	overview := make([]int, MIIM_OVERVIEW_SIZE*MIIM_OVERVIEW_SIZE)
+	type preimage struct {
+		z     complex128
+		depth int
+	}
+	stack := []preimage{{z: plot.repellingFixedPoint()}}
+	for visits := 0; len(stack) > 0 && visits < MIIM_VISITS_PER_POINT*props.Points; visits++ {
+		point := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if index, inside := plot.pixelIndex(point.z); inside {
+			if plot.weights[index] >= float64(props.Density) {
+				continue
+			}
+			plot.weights[index]++
+		} else {
+			x := int((real(point.z) + radius) / overviewStep)
+			y := int((imag(point.z) + radius) / overviewStep)
+			if x < 0 || x >= MIIM_OVERVIEW_SIZE || y < 0 || y >= MIIM_OVERVIEW_SIZE {
+				continue
+			}
+			if overview[y*MIIM_OVERVIEW_SIZE+x] >= overviewDensity {
+				continue
+			}
+			overview[y*MIIM_OVERVIEW_SIZE+x]++
+		}
+		if point.depth < props.MaxIterations {
+			w := cmplx.Sqrt(point.z - props.C)
+			stack = append(stack, preimage{z: w, depth: point.depth + 1}, preimage{z: -w, depth: point.depth + 1})
+		}
+	}
+}
+
+// Marks the pixels whose corners disagree on whether their orbits escape,
+// which are the pixels that the boundary of the set crosses. The weight of a
+// pixel is the fraction of its corners whose orbits stay bounded.
+func (plot *boundaryPlot) boundaryScan(seriesFunction func(complex128) complex128) {
+	props := plot.props
+	columns := props.Width + 1
+	bounded := make([]bool, columns*(props.Height+1))
+	for y := 0; y <= props.Height; y++ {
+		for x := 0; x <= props.Width; x++ {
+			Z := complex(plot.xOffset+(float64(x)-0.5)*plot.step, plot.yOffset+(float64(y)-0.5)*plot.step)
+			props.zPrev = Z
+			props.zNext = Z
+			props.pixel = Z
+			n := 0
+			for (n < props.MaxIterations) && (cmplx.Abs(Z) < props.BailOut) {
+				props.zPrev = Z
+				Z = props.zNext
+				props.zNext = seriesFunction(Z)
+				n++
+			}
+			bounded[y*columns+x] = n >= props.MaxIterations
+		}
+	}
+	for y := 0; y < props.Height; y++ {
+		for x := 0; x < props.Width; x++ {
+			count := 0
+			for _, corner := range []int{y*columns + x, y*columns + x + 1, (y+1)*columns + x, (y+1)*columns + x + 1} {
+				if bounded[corner] {
+					count++
+				}
+			}
+			if count > 0 && count < 4 {
+				plot.weights[y*props.Width+x] = float64(count) / 4
+			}
+		}
+	}
+}
+
+// Colors the plotted pixels by their weights, which are mapped to palette
+// positions relative to the greatest weight with the sqrt tone mapping.
+func (plot *boundaryPlot) draw(img *image.RGBA) error {
+	maxWeight := 0.0
+	for _, weight := range plot.weights {
+		maxWeight = math.Max(maxWeight, weight)
+	}
+	toneMapping := TONE_MAPPINGS[TONE_MAPPING_SQRT]
+	for i, weight := range plot.weights {
+		if weight == 0 {
+			continue
+		}
+		pixelColor, err := plot.props.ColorPalette.GetColor(toneMapping(weight, maxWeight, 1))
+		if err != nil {
+			return err
+		}
+		img.Set(i%plot.props.Width, i/plot.props.Width, pixelColor)
+	}
+	return nil
+}
@@ -270,26 +270,25 @@ func (props *LindenmayerSystem) BuildGenerator() []rune {
 }
 
 // Converts a comma-separated list of rewrite rules to a map of
-// variable and rewrite string.
+// variable and rewrite string. Rules that contain commas must be enclosed in
+// double quotes, and the rest of their text, including backslashes, is kept
+// as is.
 func ParseLindenmayerRules(txt string) (map[rune]string, error) {
-	values, err := helpers.GetCSV(txt)
+	tokens, err := helpers.TokenizeFlatParameters(txt)
 	if err != nil {
 		return nil, err
 	}
-	rules := make(map[rune]string, len(values))
-	for i := 0; i < len(values); i++ {
-		rule := strings.Trim(values[i], helpers.WHITESPACE_CUTSET)
-		if strings.ContainsRune(rule, '=') {
-			before, expression, _ := strings.Cut(rule, "=")
-			variable := []rune(strings.Trim(before, helpers.WHITESPACE_CUTSET))
-			if len(variable) == 1 {
-				rules[variable[0]] = expression
-			} else {
-				return nil, errors.New("The variable must be a single character")
-			}
-		} else {
-			return nil, errors.New("Invalid rewrite rule")
+	rules := make(map[rune]string, len(tokens))
+	for _, token := range tokens {
+		before, expression, found := strings.Cut(token.Value, "=")
+		if !found {
+			return nil, token.Errorf("Invalid rewrite rule")
+		}
+		variable := []rune(strings.Trim(before, helpers.WHITESPACE_CUTSET))
+		if len(variable) != 1 {
+			return nil, token.Errorf("The variable must be a single character")
 		}
+		rules[variable[0]] = expression
 	}
 	return rules, nil
 }
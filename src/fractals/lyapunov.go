@@ -0,0 +1,240 @@
+package fractals
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+const (
+	LYAPUNOV_MAP_LOGISTIC = "logistic"
+	LYAPUNOV_MAP_SINE     = "sine"
+	LYAPUNOV_MAP_GAUSS    = "gauss"
+
+	LYAPUNOV_DEFAULT_MAP = LYAPUNOV_MAP_LOGISTIC
+	LYAPUNOV_DEFAULT_X0  = 0.5
+	// The default width parameter of the gauss map.
+	LYAPUNOV_DEFAULT_ALPHA = 6.2
+)
+
+var (
+	// The maps x -> f(x, r), with their derivatives with respect to x, whose
+	// parameter r follows the sequence. alpha is only used by the gauss map.
+	LYAPUNOV_MAPS = map[string]lyapunovMap{
+		LYAPUNOV_MAP_LOGISTIC: {
+			next:       func(x, r, alpha float64) float64 { return r * x * (1 - x) },
+			derivative: func(x, r, alpha float64) float64 { return r * (1 - 2*x) },
+		},
+		LYAPUNOV_MAP_SINE: {
+			next:       func(x, r, alpha float64) float64 { return r * math.Sin(math.Pi*x) },
+			derivative: func(x, r, alpha float64) float64 { return r * math.Pi * math.Cos(math.Pi*x) },
+		},
+		LYAPUNOV_MAP_GAUSS: {
+			next:       func(x, r, alpha float64) float64 { return math.Exp(-alpha*x*x) + r },
+			derivative: func(x, r, alpha float64) float64 { return -2 * alpha * x * math.Exp(-alpha*x*x) },
+		},
+	}
+)
+
+// A one-dimensional map of a Lyapunov fractal.
+type lyapunovMap struct {
+	next       func(x, r, alpha float64) float64
+	derivative func(x, r, alpha float64) float64
+}
+
+// Properties of a Markus-Lyapunov fractal image, which colors each point
+// (a, b) of the region by the Lyapunov exponent of a map whose parameter
+// alternates between a and b as given by a sequence such as AABAB.
+type Lyapunov struct {
+	Width  int
+	Height int
+	// The name of one of the LYAPUNOV_MAPS.
+	Map string
+	// The letters A and B, which choose the parameter of each iteration.
+	Sequence string
+	// The iterations before the exponent is measured.
+	WarmUp int
+	// The iterations that the exponent is measured over.
+	Iterations int
+	X0         float64
+	// The width parameter of the gauss map.
+	Alpha float64
+	// The region of the (a, b) plane to display.
+	Region helpers.Rect
+	// The palette of the negative exponents, which starts at exponents of 0.
+	StableColorPalette helpers.ColorPalette
+	// The palette of the positive exponents, which starts at exponents of 0.
+	ChaoticColorPalette helpers.ColorPalette
+	// The color of the points whose orbits overflow.
+	Background color.RGBA
+	// The number of goroutines that render rows.
+	Workers int
+}
+
+// Checks if a name exists in the set of LYAPUNOV_MAPS.
+func IsValidLyapunovMap(txt string) bool {
+	mapName := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	_, found := LYAPUNOV_MAPS[mapName]
+	return found
+}
+
+// Checks if a sequence only has the letters A and B.
+func IsValidLyapunovSequence(txt string) bool {
+	sequence := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	if sequence == "" {
+		return false
+	}
+	for _, char := range sequence {
+		if char != 'A' && char != 'B' {
+			return false
+		}
+	}
+	return true
+}
+
+// Writes the Lyapunov fractal image to the given output.
+func (props *Lyapunov) WriteImage(output io.Writer) error {
+	viewport := image.Rect(0, 0, props.Width, props.Height)
+	img := image.NewRGBA(viewport)
+	helpers.FillImage(img, props.Background)
+	err := props.render(img)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(output, img)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Helper function for rendering the Lyapunov fractal. The exponents of the
+// rows are computed on props.Workers goroutines, and colored once all of
+// them are known.
+func (props *Lyapunov) render(img *image.RGBA) error {
+	lyapunovMap, found := LYAPUNOV_MAPS[strings.Trim(props.Map, helpers.WHITESPACE_CUTSET)]
+	if !found {
+		return errors.New("Invalid map")
+	}
+	if !IsValidLyapunovSequence(props.Sequence) {
+		return errors.New("Invalid sequence")
+	}
+	if props.Iterations <= 0 {
+		return errors.New("The exponents must be measured over at least one iteration")
+	}
+	sequence := strings.Trim(props.Sequence, helpers.WHITESPACE_CUTSET)
+	width, height := float64(props.Width), float64(props.Height)
+	step := math.Max(props.Region.Width/width, props.Region.Height/height)
+	xOffset := props.Region.X - (width*step-props.Region.Width)/2.0
+	yOffset := props.Region.Y - (height*step-props.Region.Height)/2.0
+	exponents := make([]float64, props.Width*props.Height)
+	rows := make(chan int)
+	workers := int(math.Max(1, float64(props.Workers)))
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				b := yOffset + float64(y)*step
+				for x := 0; x < props.Width; x++ {
+					a := xOffset + float64(x)*step
+					exponents[y*props.Width+x] = props.exponent(lyapunovMap, sequence, a, b)
+				}
+			}
+		}()
+	}
+	for y := 0; y < props.Height; y++ {
+		rows <- y
+	}
+	close(rows)
+	wg.Wait()
+	// the exponents of each sign are scaled by their mean size, since the
+	// most negative exponents are those of superstable orbits
+	var stableSum, chaoticSum float64
+	var stableCount, chaoticCount int
+	for _, exponent := range exponents {
+		if math.IsInf(exponent, 0) || math.IsNaN(exponent) {
+			continue
+		}
+		if exponent < 0 {
+			stableSum -= exponent
+			stableCount++
+		} else {
+			chaoticSum += exponent
+			chaoticCount++
+		}
+	}
+	stableScale := stableSum / math.Max(1, float64(stableCount))
+	chaoticScale := chaoticSum / math.Max(1, float64(chaoticCount))
+	err := props.StableColorPalette.TranslateColorTransitions()
+	if err != nil {
+		return err
+	}
+	err = props.ChaoticColorPalette.TranslateColorTransitions()
+	if err != nil {
+		return err
+	}
+	for y := 0; y < props.Height; y++ {
+		for x := 0; x < props.Width; x++ {
+			exponent := exponents[y*props.Width+x]
+			var pixelColor color.RGBA
+			switch {
+			case math.IsNaN(exponent) || math.IsInf(exponent, 1):
+				continue
+			case exponent < 0:
+				// superstable orbits have exponents of -Inf, which are at the
+				// end of the palette
+				pixelColor, err = props.StableColorPalette.GetColor(lyapunovShade(-exponent, stableScale))
+			default:
+				pixelColor, err = props.ChaoticColorPalette.GetColor(lyapunovShade(exponent, chaoticScale))
+			}
+			if err != nil {
+				return err
+			}
+			img.Set(x, y, pixelColor)
+		}
+	}
+	return nil
+}
+
+// Maps the size of an exponent to a position of a palette with 1 - e^(-size
+// / scale), which is 0 for exponents of 0 and approaches 1 for large ones.
+func lyapunovShade(size, scale float64) float64 {
+	if scale == 0 {
+		return 0
+	}
+	return 1 - math.Exp(-size/scale)
+}
+
+// Computes the Lyapunov exponent of the map at a point (a, b), which is the
+// average of ln|f'(x)| over the measured iterations.
+func (props *Lyapunov) exponent(lyapunovMap lyapunovMap, sequence string, a, b float64) float64 {
+	parameter := func(n int) float64 {
+		if sequence[n%len(sequence)] == 'A' {
+			return a
+		}
+		return b
+	}
+	x := props.X0
+	for n := 0; n < props.WarmUp; n++ {
+		x = lyapunovMap.next(x, parameter(n), props.Alpha)
+	}
+	sum := 0.0
+	for n := props.WarmUp; n < props.WarmUp+props.Iterations; n++ {
+		r := parameter(n)
+		sum += math.Log(math.Abs(lyapunovMap.derivative(x, r, props.Alpha)))
+		x = lyapunovMap.next(x, r, props.Alpha)
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return math.NaN()
+		}
+	}
+	return sum / float64(props.Iterations)
+}
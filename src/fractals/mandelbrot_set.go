@@ -1,12 +1,13 @@
 package fractals
 
 import (
+	"errors"
 	"image"
 	"image/color"
 	"image/png"
 	"io"
 	"math"
-	"math/cmplx"
+	"strings"
 
 	"github.com/yishakk/fractage/src/helpers"
 )
@@ -18,9 +19,31 @@ type MandelbrotSet struct {
 	ColorPalette  helpers.ColorPalette
 	MaxIterations int
 	M             float64
-	BailOut       float64
-	Region        helpers.Rect
-	Background    color.RGBA
+	// The imaginary part of the exponent m.
+	MImag             float64
+	BailOut           float64
+	Region            helpers.Rect
+	Coloring          string
+	OrbitTrap         *OrbitTrap
+	DistanceThickness float64
+	AntiAlias         bool
+	// The exact center of the region, which keeps the digits that Region loses
+	// for the dd and big precisions.
+	Center *helpers.BigPoint
+	// The precision of the arithmetic, which is float64 when it's empty.
+	Precision string
+	// Filled in with the work done by the last render, which is only measured
+	// by float64 renders.
+	Stats EscapeTimeStats
+	// Specifies if renders with the big precision skip iterations with a
+	// series approximation.
+	SeriesApproximation bool
+	// The variant of the set, which is classic when it's empty.
+	Variant string
+	// A formula that replaces z^m + c, in which c is the pixel.
+	Formula    string
+	Parameters map[string]complex128
+	Background color.RGBA
 }
 
 // Writes the Mandelbrot set image to the given output.
@@ -41,48 +64,201 @@ func (props *MandelbrotSet) WriteImage(output io.Writer) error {
 
 // Helper function for rendering the Mandelbrot set.
 func (props *MandelbrotSet) render(img *image.RGBA) error {
+	props.Stats = EscapeTimeStats{}
 	width, height := float64(props.Width), float64(props.Height)
-	bailOutPow := math.Pow(props.BailOut, props.M)
 	step := math.Max(props.Region.Width/width, props.Region.Height/height)
+	coloring := NewEscapeTimeColoring(props.Coloring, EscapeTimeOrbit{
+		MaxIterations:     props.MaxIterations,
+		Exponent:          props.M,
+		Trap:              props.OrbitTrap,
+		PixelSize:         step,
+		DistanceThickness: props.DistanceThickness,
+		AntiAlias:         props.AntiAlias,
+	})
+	derivativeColoring, tracksDerivative := coloring.(EscapeTimeDerivativeColoring)
+	var err error
+	variant := strings.Trim(props.Variant, helpers.WHITESPACE_CUTSET)
+	if variant == "" {
+		variant = MANDELBROT_VARIANT_CLASSIC
+	}
+	power, found := MANDELBROT_VARIANTS[variant]
+	if !found {
+		return errors.New("Invalid variant")
+	}
+	classic := variant == MANDELBROT_VARIANT_CLASSIC
+	var formula *formulaSeries
+	if props.Formula != "" {
+		if !classic {
+			return errors.New("Formulas can't be combined with variants")
+		}
+		formula, err = newFormulaSeries(props.Formula, props.Parameters)
+		if err != nil {
+			return err
+		}
+		// the interior of the set of a formula is unknown
+		classic = false
+	}
+	if tracksDerivative && !classic {
+		return errors.New("Distance estimation colorings are only supported by the classic variant without a formula")
+	}
+	exponent := complex(props.M, props.MImag)
+	bailOut := math.Max(props.BailOut, coloring.MinBailOut())
 	xOffset := props.Region.X - (width*step-props.Region.Width)/2.0
 	yOffset := props.Region.Y - (height*step-props.Region.Height)/2.0
-	err := props.ColorPalette.TranslateColorTransitions()
+	err = props.ColorPalette.TranslateColorTransitions()
 	if err != nil {
 		return err
 	}
-	var pixelColor color.RGBA
-	var x2, y2 float64
-	var C, Z complex128
-	var n int
-	for y := 0; y < int(height); y++ {
-		for x := 0; x < int(width); x++ {
-			n = 0
-			C = complex(xOffset+float64(x)*step, yOffset+float64(y)*step)
-			Z = complex(xOffset+float64(x)*step, yOffset+float64(y)*step)
-			for n < props.MaxIterations {
-				x2 = math.Pow(real(Z), props.M)
-				y2 = math.Pow(imag(Z), props.M)
-				if x2+y2 > bailOutPow {
-					// Z diverges
-					break
-				}
-				Z = cmplx.Pow(Z, complex(props.M, 0)) + C
-				n++
+	supportedPrecisions := []string{PRECISION_FLOAT64}
+	if classic && isIntegerExponent(exponent) {
+		supportedPrecisions = PRECISIONS
+	}
+	precision := choosePrecision(props.Precision, props.Region, step, supportedPrecisions)
+	if !classic && precision != PRECISION_FLOAT64 {
+		return errors.New("The dd and big precisions are only supported by the classic variant without a formula")
+	}
+	switch precision {
+	case PRECISION_DOUBLE_DOUBLE:
+		return props.renderDoubleDouble(img, coloring, bailOut, step)
+	case PRECISION_BIG:
+		return props.renderPerturbation(img, coloring, bailOut, step)
+	}
+	// the orbits of formulas may depend on zprev, so a repeated point doesn't
+	// mean that they cycle
+	detectInterior := allowsInteriorDetection(coloring) && formula == nil
+	render := mandelbrotRender{
+		props:              props,
+		img:                img,
+		coloring:           coloring,
+		derivativeColoring: derivativeColoring,
+		tracksDerivative:   tracksDerivative,
+		exponent:           exponent,
+		bailOut:            bailOut,
+		xOffset:            xOffset,
+		yOffset:            yOffset,
+		step:               step,
+		power:              power,
+		pow:                newPowFunction(exponent),
+		derivativePow:      newPowFunction(exponent - 1),
+		classic:            classic,
+		formula:            formula,
+		detectInterior:     detectInterior,
+		states:             make([]pixelState, props.Width*props.Height),
+	}
+	// the bounded orbits of z^m + c form a set without holes for integers m
+	// from 2 and bail-outs from 2
+	if render.detectInterior && classic && isIntegerExponent(exponent) && bailOut >= 2 {
+		err = render.renderRect(0, 0, props.Width-1, props.Height-1)
+	} else {
+		err = render.renderRows()
+	}
+	props.Stats = render.stats
+	props.Stats.Measured = true
+	return err
+}
+
+// The state of a float64 render of the Mandelbrot set.
+type mandelbrotRender struct {
+	props              *MandelbrotSet
+	img                *image.RGBA
+	coloring           EscapeTimeColoring
+	derivativeColoring EscapeTimeDerivativeColoring
+	tracksDerivative   bool
+	exponent           complex128
+	bailOut            float64
+	xOffset            float64
+	yOffset            float64
+	step               float64
+	// Computes the term of the variant that replaces z^m.
+	power         func(z complex128, pow func(complex128) complex128) complex128
+	pow           func(complex128) complex128
+	derivativePow func(complex128) complex128
+	classic       bool
+	formula       *formulaSeries
+	// Specifies if pixels whose orbits are known to stay bounded can skip
+	// their iterations.
+	detectInterior bool
+	states         []pixelState
+	stats          EscapeTimeStats
+}
+
+// Renders every pixel of the image row by row.
+func (render *mandelbrotRender) renderRows() error {
+	for y := 0; y < render.props.Height; y++ {
+		for x := 0; x < render.props.Width; x++ {
+			_, err := render.renderPixel(x, y)
+			if err != nil {
+				return err
 			}
-			if n < props.MaxIterations {
-				// Z escaped
-				pixelColor, err = props.ColorPalette.GetColor(float64(n) / float64(props.MaxIterations))
-				if err != nil {
-					return err
-				}
+		}
+	}
+	return nil
+}
+
+// Iterates the orbit of a pixel and colors it, unless that was done already.
+// Returns true if the orbit was proven to stay bounded forever.
+func (render *mandelbrotRender) renderPixel(x, y int) (bool, error) {
+	props := render.props
+	index := y*props.Width + x
+	if render.states[index] != PIXEL_STATE_UNKNOWN {
+		return render.states[index] == PIXEL_STATE_INTERIOR, nil
+	}
+	n := 0
+	C := complex(render.xOffset+float64(x)*render.step, render.yOffset+float64(y)*render.step)
+	Z := complex(render.xOffset+float64(x)*render.step, render.yOffset+float64(y)*render.step)
+	dZ := complex128(1)
+	interior := false
+	// with bail-outs below 2, points of the cardioid and the bulb can escape
+	if render.detectInterior && render.classic && render.exponent == 2 && render.bailOut >= 2 &&
+		!mandelbrotEscaped(Z, render.exponent, render.bailOut) && inMainCardioidOrBulb(C) {
+		n = props.MaxIterations
+		interior = true
+		render.stats.IterationsSaved += int64(props.MaxIterations)
+	} else {
+		zPrev := Z
+		cycle := newCycleDetector(Z)
+		render.coloring.Reset(Z)
+		for n < props.MaxIterations {
+			if mandelbrotEscaped(Z, render.exponent, render.bailOut) {
+				// Z diverges
+				break
+			}
+			if render.tracksDerivative {
+				dZ = render.exponent*render.derivativePow(Z)*dZ + 1
+			}
+			if render.formula != nil {
+				Z, zPrev = render.formula.Next(Z, zPrev, C, C), Z
 			} else {
-				pixelColor, err = props.ColorPalette.GetColor(1)
-				if err != nil {
-					return err
-				}
+				Z = render.power(Z, render.pow) + C
+			}
+			render.coloring.Visit(Z)
+			n++
+			render.stats.Iterations++
+			if render.detectInterior && cycle.Visit(Z) {
+				// Z is periodic
+				render.stats.IterationsSaved += int64(props.MaxIterations - n)
+				n = props.MaxIterations
+				interior = true
 			}
-			img.Set(x, y, pixelColor)
 		}
 	}
-	return nil
+	if render.tracksDerivative {
+		render.derivativeColoring.SetDerivative(dZ)
+	}
+	// Z escaped if n < props.MaxIterations
+	bounded := n >= props.MaxIterations
+	pixelColor, err := escapeTimePixelColor(&props.ColorPalette, render.coloring, Z, n, !bounded)
+	if err != nil {
+		return false, err
+	}
+	render.img.Set(x, y, pixelColor)
+	switch {
+	case interior:
+		render.states[index] = PIXEL_STATE_INTERIOR
+	case bounded:
+		render.states[index] = PIXEL_STATE_BOUNDED
+	default:
+		render.states[index] = PIXEL_STATE_ESCAPED
+	}
+	return interior, nil
 }
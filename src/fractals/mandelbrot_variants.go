@@ -0,0 +1,63 @@
+package fractals
+
+import (
+	"math"
+	"math/cmplx"
+	"strings"
+
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+const (
+	MANDELBROT_VARIANT_CLASSIC       = "classic"
+	MANDELBROT_VARIANT_BURNING_SHIP  = "burning_ship"
+	MANDELBROT_VARIANT_TRICORN       = "tricorn"
+	MANDELBROT_VARIANT_CELTIC        = "celtic"
+	MANDELBROT_VARIANT_PERPENDICULAR = "perpendicular"
+	MANDELBROT_VARIANT_BUFFALO       = "buffalo"
+)
+
+var (
+	// The terms that replace z^m in z^m + c for the variants of the
+	// Mandelbrot set, given a function that raises numbers to the power of m.
+	// The variants fold z before raising it to the power of m or fold the
+	// power.
+	MANDELBROT_VARIANTS = map[string]func(z complex128, pow func(complex128) complex128) complex128{
+		MANDELBROT_VARIANT_CLASSIC: func(z complex128, pow func(complex128) complex128) complex128 {
+			return pow(z)
+		},
+		MANDELBROT_VARIANT_BURNING_SHIP: func(z complex128, pow func(complex128) complex128) complex128 {
+			return pow(complex(math.Abs(real(z)), math.Abs(imag(z))))
+		},
+		MANDELBROT_VARIANT_TRICORN: func(z complex128, pow func(complex128) complex128) complex128 {
+			return pow(cmplx.Conj(z))
+		},
+		MANDELBROT_VARIANT_CELTIC: func(z complex128, pow func(complex128) complex128) complex128 {
+			power := pow(z)
+			return complex(math.Abs(real(power)), imag(power))
+		},
+		MANDELBROT_VARIANT_PERPENDICULAR: func(z complex128, pow func(complex128) complex128) complex128 {
+			return pow(complex(math.Abs(real(z)), -imag(z)))
+		},
+		MANDELBROT_VARIANT_BUFFALO: func(z complex128, pow func(complex128) complex128) complex128 {
+			power := pow(z)
+			return complex(math.Abs(real(power)), math.Abs(imag(power)))
+		},
+	}
+)
+
+// Checks if a name exists in the set of MANDELBROT_VARIANTS names.
+func IsValidMandelbrotVariant(txt string) bool {
+	variant := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	_, found := MANDELBROT_VARIANTS[variant]
+	return found
+}
+
+// Creates the Julia set series of a variant of the Mandelbrot set of degree 2.
+func variantSeries(props *JuliaSet, variant string) func(complex128) complex128 {
+	power := MANDELBROT_VARIANTS[variant]
+	pow := newPowFunction(2)
+	return func(z complex128) complex128 {
+		return power(z, pow) + props.C
+	}
+}
@@ -0,0 +1,49 @@
+package fractals
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+const (
+	// Integer exponents up to this magnitude are computed by repeated
+	// multiplication instead of cmplx.Pow.
+	MULTIBROT_MAX_INTEGER_EXPONENT = 64
+)
+
+// Creates a function that raises z to the power of m. Integer exponents are
+// computed with multiplications, which are faster and more accurate than the
+// logarithms of cmplx.Pow.
+func newPowFunction(m complex128) func(complex128) complex128 {
+	k := int(real(m))
+	if imag(m) != 0 || real(m) != float64(k) || k > MULTIBROT_MAX_INTEGER_EXPONENT || k < -MULTIBROT_MAX_INTEGER_EXPONENT {
+		return func(z complex128) complex128 {
+			return cmplx.Pow(z, m)
+		}
+	}
+	switch {
+	case k == 2:
+		return func(z complex128) complex128 { return z * z }
+	case k < 0:
+		return func(z complex128) complex128 { return 1 / intPow(z, -k) }
+	default:
+		return func(z complex128) complex128 { return intPow(z, k) }
+	}
+}
+
+// Checks if m is an integer that the dd and big precisions support.
+func isIntegerExponent(m complex128) bool {
+	return imag(m) == 0 && real(m) == math.Trunc(real(m)) && real(m) >= 2
+}
+
+// Checks if z escaped from the Mandelbrot set of z^m + c. Orbits escape once
+// |z| is greater than the bail-out. With exponents whose real part is
+// negative, z^m has its pole at 0 instead of infinity, so orbits also escape
+// when they get closer than 1/bailOut to 0.
+func mandelbrotEscaped(z, m complex128, bailOut float64) bool {
+	r2 := real(z)*real(z) + imag(z)*imag(z)
+	if real(m) < 0 {
+		return r2 > bailOut*bailOut || r2*bailOut*bailOut < 1
+	}
+	return r2 > bailOut*bailOut
+}
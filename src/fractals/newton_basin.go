@@ -7,26 +7,125 @@ import (
 	"io"
 	"math"
 	"math/cmplx"
+	"sort"
+	"strings"
 
 	"github.com/yishakk/fractage/src/helpers"
 	math_helpers "github.com/B3zaleel/fractage/src/helpers/math"
 )
 
 const (
-	MAX_DELTA = 1e-14
+	NEWTON_BASIN_COLORING_PHASE      = "phase"
+	NEWTON_BASIN_COLORING_ITERATIONS = "iterations"
+	NEWTON_BASIN_COLORING_ROOTS      = "roots"
+	// The relative distance within which points are the same root.
+	NEWTON_BASIN_ROOT_TOLERANCE = 1e-4
+	// The brightness of the root colors of the pixels that take the maximum
+	// number of iterations.
+	NEWTON_BASIN_MIN_ROOT_SHADE = 0.3
+)
+
+var (
+	NEWTON_BASIN_COLORINGS = []string{
+		NEWTON_BASIN_COLORING_PHASE,
+		NEWTON_BASIN_COLORING_ITERATIONS,
+		NEWTON_BASIN_COLORING_ROOTS,
+	}
 )
 
 // Properties of a Newton basin image.
 type NewtonBasin struct {
-	Width            int
-	Height           int
-	ColorPalette     helpers.ColorPalette
-	MaxIterations    int
-	Polynomial       math_helpers.CmplxPolynomial
-	BailOut          float64
-	Region           helpers.Rect
-	Background       color.RGBA
-	UseDynamicColors bool
+	Width         int
+	Height        int
+	ColorPalette  helpers.ColorPalette
+	MaxIterations int
+	Polynomial    math_helpers.CmplxPolynomial
+	BailOut       float64
+	Region        helpers.Rect
+	Background    color.RGBA
+	// The coloring of the pixels, which is phase when it's empty.
+	Coloring string
+	// The distinct roots of the polynomial, which the roots coloring finds
+	// when they're nil. The roots of functions are the distinct points that
+	// the pixels converge to.
+	Roots []complex128
+	// The color of the pixels that the roots coloring can't match to a root.
+	NonConvergedColor color.RGBA
+	// The color of the pixels whose iterations divide by zero or overflow.
+	InvalidColor color.RGBA
+	// The iteration scheme, which is newton when it's empty.
+	Method string
+	// The step size at which the iteration of a pixel has converged.
+	Tolerance float64
+	// The factor a of the steps z - a * p(z)/p'(z) of Newton's method.
+	Relaxation complex128
+	// The order of Householder's method.
+	HouseholderOrder int
+	// A function of one variable, such as sin(z) - 1, whose roots are
+	// approached instead of those of the polynomial when it isn't nil.
+	Function *math_helpers.ComplexExpression
+}
+
+// Checks if a name exists in the set of NEWTON_BASIN_COLORINGS.
+func IsValidNewtonBasinColoring(txt string) bool {
+	coloringName := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	for _, coloring := range NEWTON_BASIN_COLORINGS {
+		if coloring == coloringName {
+			return true
+		}
+	}
+	return false
+}
+
+// Finds the distinct roots of a polynomial, sorted by their real and then
+// imaginary parts. The approximations of a multiple root are averaged.
+func NewtonBasinRoots(polynomial math_helpers.CmplxPolynomial) ([]complex128, error) {
+	roots, err := polynomial.Roots()
+	if err != nil {
+		return nil, err
+	}
+	var distinct []complex128
+	var counts []int
+	for _, root := range roots {
+		index := nearestRoot(distinct, root)
+		if index < 0 {
+			distinct = append(distinct, root)
+			counts = append(counts, 1)
+			continue
+		}
+		counts[index]++
+		distinct[index] += (root - distinct[index]) / complex(float64(counts[index]), 0)
+	}
+	sortRoots(distinct)
+	return distinct, nil
+}
+
+// Sorts roots by their real and then imaginary parts.
+func sortRoots(roots []complex128) {
+	sort.Slice(roots, func(i, j int) bool {
+		a, b := roots[i], roots[j]
+		if math.Abs(real(a)-real(b)) > NEWTON_BASIN_ROOT_TOLERANCE {
+			return real(a) < real(b)
+		}
+		return imag(a) < imag(b)
+	})
+}
+
+// Returns the index of the root that a point converged to, or -1 when it
+// isn't within NEWTON_BASIN_ROOT_TOLERANCE of any of them.
+func nearestRoot(roots []complex128, z complex128) int {
+	index := -1
+	minDistance := math.Inf(1)
+	for i, root := range roots {
+		distance := cmplx.Abs(z - root)
+		if distance < minDistance {
+			index, minDistance = i, distance
+		}
+	}
+	if index >= 0 && minDistance > NEWTON_BASIN_ROOT_TOLERANCE*math.Max(1, cmplx.Abs(roots[index])) {
+		return -1
+	}
+	return index
 }
 
 // Writes the Newton basin image to the given output.
@@ -55,41 +154,126 @@ func (props *NewtonBasin) render(img *image.RGBA) error {
 	if err != nil {
 		return err
 	}
-	var pixelColor color.RGBA
-	var n int
-	poly := props.Polynomial
-	polyDeriv := props.Polynomial.FirstDerivative()
+	iteration, err := newNewtonIteration(props)
+	if err != nil {
+		return err
+	}
+	coloring := strings.Trim(props.Coloring, helpers.WHITESPACE_CUTSET)
+	roots := props.Roots
+	if coloring == NEWTON_BASIN_COLORING_ROOTS && roots == nil && props.Function == nil {
+		roots, err = NewtonBasinRoots(props.Polynomial)
+		if err != nil {
+			return err
+		}
+	}
+	// the roots of functions are the distinct points that the pixels converge
+	// to, so they're colored once all of them are found
+	discoverRoots := coloring == NEWTON_BASIN_COLORING_ROOTS && roots == nil
+	var pixels []newtonPixel
 	for y := 0; y <= int(height); y++ {
 		for x := 0; x <= int(width); x++ {
-			n = 0
-			Z := complex(xOffset+float64(x)*step, yOffset+float64(y)*step)
-			delta := Z
-			Z1 := Z
-			for (n < props.MaxIterations) && (cmplx.Abs(Z) < props.BailOut) && (cmplx.Abs(delta) > MAX_DELTA) {
-				Z = Z - poly.Evaluate(Z)/polyDeriv.Evaluate(Z)
-				delta = Z1 - Z
-				Z1 = Z
-				n++
-			}
-			mag := float64(props.MaxIterations-n) / float64(props.MaxIterations)
-			if props.UseDynamicColors {
-				var angle float64
-				if Z == 0+0i {
-					angle = 0
-				} else {
-					angle = cmplx.Phase(Z)
+			pixel := props.iterate(iteration, complex(xOffset+float64(x)*step, yOffset+float64(y)*step))
+			if discoverRoots {
+				if pixel.converged && pixel.valid() && nearestRoot(roots, pixel.z) < 0 {
+					roots = append(roots, pixel.z)
 				}
-				pixelColor = color.RGBA{
-					R: uint8(255 * mag * (math.Sin(angle)/2 + 0.5)),
-					G: uint8(255 * mag * (math.Sin(angle+1*math.Pi/3)/2 + 0.5)),
-					B: uint8(255 * mag * (math.Sin(angle+5*math.Pi/3)/2 + 0.5)),
-					A: 255,
-				}
-			} else {
-				pixelColor, err = props.ColorPalette.GetColor(mag)
+				pixels = append(pixels, pixel)
+				continue
+			}
+			pixelColor, err := props.pixelColor(pixel, coloring, roots)
+			if err != nil {
+				return err
 			}
 			img.Set(x, y, pixelColor)
 		}
 	}
+	if !discoverRoots {
+		return nil
+	}
+	sortRoots(roots)
+	i := 0
+	for y := 0; y <= int(height); y++ {
+		for x := 0; x <= int(width); x++ {
+			pixelColor, err := props.pixelColor(pixels[i], coloring, roots)
+			if err != nil {
+				return err
+			}
+			img.Set(x, y, pixelColor)
+			i++
+		}
+	}
 	return nil
 }
+
+// The result of the iterations of a pixel.
+type newtonPixel struct {
+	z         complex128
+	n         int
+	converged bool
+}
+
+// Checks if the iterations of a pixel ended at a number, rather than at a
+// division by zero or an overflow.
+func (pixel newtonPixel) valid() bool {
+	return !cmplx.IsNaN(pixel.z) && !cmplx.IsInf(pixel.z)
+}
+
+// Iterates the method of the Newton basin from a point.
+func (props *NewtonBasin) iterate(iteration newtonIteration, z complex128) newtonPixel {
+	n := 0
+	converged := false
+	iteration.Reset(z)
+	for (n < props.MaxIterations) && (cmplx.Abs(z) < props.BailOut) && !converged {
+		z, converged = iteration.Next(z)
+		n++
+	}
+	return newtonPixel{z: z, n: n, converged: converged}
+}
+
+// Computes the color of a pixel for a coloring of the Newton basin.
+func (props *NewtonBasin) pixelColor(pixel newtonPixel, coloring string, roots []complex128) (color.RGBA, error) {
+	if !pixel.valid() {
+		return props.InvalidColor, nil
+	}
+	mag := float64(props.MaxIterations-pixel.n) / float64(props.MaxIterations)
+	switch coloring {
+	case NEWTON_BASIN_COLORING_ITERATIONS:
+		return props.ColorPalette.GetColor(mag)
+	case NEWTON_BASIN_COLORING_ROOTS:
+		index := nearestRoot(roots, pixel.z)
+		if index < 0 {
+			return props.NonConvergedColor, nil
+		}
+		// each root has its own palette color, which is darker for pixels
+		// that converge slowly but never as dark as the pixels that don't
+		// converge
+		rootColor, err := props.ColorPalette.GetColor(float64(index) / float64(len(roots)))
+		if err != nil {
+			return rootColor, err
+		}
+		shade := NEWTON_BASIN_MIN_ROOT_SHADE + (1-NEWTON_BASIN_MIN_ROOT_SHADE)*mag
+		return color.RGBA{
+			R: uint8(math.Round(shade * float64(rootColor.R))),
+			G: uint8(math.Round(shade * float64(rootColor.G))),
+			B: uint8(math.Round(shade * float64(rootColor.B))),
+			A: 255,
+		}, nil
+	}
+	return newtonPhaseColor(pixel.z, mag), nil
+}
+
+// Colors a point by its phase, with a brightness of mag.
+func newtonPhaseColor(z complex128, mag float64) color.RGBA {
+	var angle float64
+	if z == 0+0i {
+		angle = 0
+	} else {
+		angle = cmplx.Phase(z)
+	}
+	return color.RGBA{
+		R: uint8(255 * mag * (math.Sin(angle)/2 + 0.5)),
+		G: uint8(255 * mag * (math.Sin(angle+1*math.Pi/3)/2 + 0.5)),
+		B: uint8(255 * mag * (math.Sin(angle+5*math.Pi/3)/2 + 0.5)),
+		A: 255,
+	}
+}
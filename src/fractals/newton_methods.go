@@ -0,0 +1,289 @@
+package fractals
+
+import (
+	"errors"
+	"fmt"
+	"math/cmplx"
+	"strings"
+
+	"github.com/yishakk/fractage/src/helpers"
+	math_helpers "github.com/yishakk/fractage/src/helpers/math"
+)
+
+const (
+	NEWTON_METHOD_NEWTON      = "newton"
+	NEWTON_METHOD_HALLEY      = "halley"
+	NEWTON_METHOD_HOUSEHOLDER = "householder"
+	NEWTON_METHOD_SCHRODER    = "schroder"
+	NEWTON_METHOD_SECANT      = "secant"
+
+	NEWTON_BASIN_DEFAULT_METHOD            = NEWTON_METHOD_NEWTON
+	NEWTON_BASIN_DEFAULT_TOLERANCE         = 1e-14
+	NEWTON_BASIN_DEFAULT_RELAXATION        = 1 + 0i
+	NEWTON_BASIN_DEFAULT_HOUSEHOLDER_ORDER = 3
+	NEWTON_BASIN_MAX_HOUSEHOLDER_ORDER     = 16
+	// The symbolic derivatives of functions grow geometrically with their
+	// order, unlike the derivatives of polynomials.
+	NEWTON_BASIN_MAX_FUNCTION_HOUSEHOLDER_ORDER = 6
+	// The distance of the second starting point of the secant method from
+	// the pixel.
+	SECANT_INITIAL_STEP = 1e-3
+)
+
+var (
+	NEWTON_METHODS = []string{
+		NEWTON_METHOD_NEWTON,
+		NEWTON_METHOD_HALLEY,
+		NEWTON_METHOD_HOUSEHOLDER,
+		NEWTON_METHOD_SCHRODER,
+		NEWTON_METHOD_SECANT,
+	}
+)
+
+// A function of a complex variable whose roots Newton basins approach, such
+// as a polynomial.
+type complexFunction interface {
+	Evaluate(z complex128) complex128
+}
+
+// Adapts an expression of one variable to a complexFunction.
+type expressionFunction struct {
+	expression *math_helpers.ComplexExpression
+	values     []complex128
+}
+
+func (function *expressionFunction) Evaluate(z complex128) complex128 {
+	function.values[0] = z
+	return function.expression.Evaluate(function.values)
+}
+
+// An iteration scheme that approaches the roots of a function.
+type newtonIteration interface {
+	// Starts the iteration at a pixel.
+	Reset(z complex128)
+	// Computes the next point and whether the iteration converged, which is
+	// when the step is at most the tolerance.
+	Next(z complex128) (complex128, bool)
+}
+
+// Checks if a name exists in the set of NEWTON_METHODS.
+func IsValidNewtonMethod(txt string) bool {
+	methodName := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	for _, method := range NEWTON_METHODS {
+		if method == methodName {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the function of a Newton basin and its derivatives up to the given
+// order, which are computed symbolically for expressions.
+func newtonDerivatives(props *NewtonBasin, order int) ([]complexFunction, error) {
+	if props.Function == nil {
+		derivatives := []complexFunction{props.Polynomial}
+		poly := props.Polynomial
+		for k := 1; k <= order; k++ {
+			poly = poly.FirstDerivative()
+			derivatives = append(derivatives, poly)
+		}
+		return derivatives, nil
+	}
+	expression := props.Function
+	variable := expression.Variables[0]
+	values := make([]complex128, len(expression.Variables))
+	derivatives := []complexFunction{&expressionFunction{expression: expression, values: values}}
+	for k := 1; k <= order; k++ {
+		var err error
+		expression, err = expression.Derivative(variable)
+		if err != nil {
+			return nil, err
+		}
+		derivatives = append(derivatives, &expressionFunction{expression: expression, values: values})
+	}
+	return derivatives, nil
+}
+
+// Creates the iteration of the method of a Newton basin.
+func newNewtonIteration(props *NewtonBasin) (newtonIteration, error) {
+	tolerance := props.Tolerance
+	if tolerance <= 0 {
+		tolerance = NEWTON_BASIN_DEFAULT_TOLERANCE
+	}
+	method := strings.Trim(props.Method, helpers.WHITESPACE_CUTSET)
+	switch method {
+	case "", NEWTON_METHOD_NEWTON:
+		relaxation := props.Relaxation
+		if relaxation == 0 {
+			relaxation = NEWTON_BASIN_DEFAULT_RELAXATION
+		}
+		derivatives, err := newtonDerivatives(props, 1)
+		if err != nil {
+			return nil, err
+		}
+		return &newtonStep{poly: derivatives[0], deriv: derivatives[1], relaxation: relaxation, tolerance: tolerance}, nil
+	case NEWTON_METHOD_HALLEY, NEWTON_METHOD_SCHRODER:
+		derivatives, err := newtonDerivatives(props, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &secondOrderStep{
+			poly:      derivatives[0],
+			deriv:     derivatives[1],
+			deriv2:    derivatives[2],
+			schroder:  method == NEWTON_METHOD_SCHRODER,
+			tolerance: tolerance,
+		}, nil
+	case NEWTON_METHOD_HOUSEHOLDER:
+		order := props.HouseholderOrder
+		if order == 0 {
+			order = NEWTON_BASIN_DEFAULT_HOUSEHOLDER_ORDER
+		}
+		if order < 1 || order > NEWTON_BASIN_MAX_HOUSEHOLDER_ORDER {
+			return nil, errors.New("Invalid Householder order")
+		}
+		if props.Function != nil && order > NEWTON_BASIN_MAX_FUNCTION_HOUSEHOLDER_ORDER {
+			return nil, fmt.Errorf("The Householder order of a function can't be more than %d", NEWTON_BASIN_MAX_FUNCTION_HOUSEHOLDER_ORDER)
+		}
+		derivatives, err := newtonDerivatives(props, order)
+		if err != nil {
+			return nil, err
+		}
+		return &householderStep{
+			derivatives: derivatives,
+			taylor:      make([]complex128, order+1),
+			reciprocal:  make([]complex128, order+1),
+			tolerance:   tolerance,
+		}, nil
+	case NEWTON_METHOD_SECANT:
+		derivatives, err := newtonDerivatives(props, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &secantStep{poly: derivatives[0], tolerance: tolerance}, nil
+	}
+	return nil, errors.New("Invalid method")
+}
+
+// Newton's method z - a * p(z)/p'(z) with a complex relaxation factor a.
+type newtonStep struct {
+	poly       complexFunction
+	deriv      complexFunction
+	relaxation complex128
+	tolerance  float64
+}
+
+func (step *newtonStep) Reset(z complex128) {}
+
+func (step *newtonStep) Next(z complex128) (complex128, bool) {
+	p := step.poly.Evaluate(z)
+	if p == 0 {
+		return z, true
+	}
+	next := z - step.relaxation*p/step.deriv.Evaluate(z)
+	return next, cmplx.Abs(z-next) <= step.tolerance
+}
+
+// Halley's method z - 2pp'/(2p'^2 - pp”), or Schröder's method
+// z - pp'/(p'^2 - pp”), which converges quadratically to multiple roots.
+type secondOrderStep struct {
+	poly      complexFunction
+	deriv     complexFunction
+	deriv2    complexFunction
+	schroder  bool
+	tolerance float64
+}
+
+func (step *secondOrderStep) Reset(z complex128) {}
+
+func (step *secondOrderStep) Next(z complex128) (complex128, bool) {
+	p := step.poly.Evaluate(z)
+	if p == 0 {
+		return z, true
+	}
+	dp, d2p := step.deriv.Evaluate(z), step.deriv2.Evaluate(z)
+	var next complex128
+	if step.schroder {
+		next = z - p*dp/(dp*dp-p*d2p)
+	} else {
+		next = z - 2*p*dp/(2*dp*dp-p*d2p)
+	}
+	return next, cmplx.Abs(z-next) <= step.tolerance
+}
+
+// Householder's method of order d, z + d * (1/p)^(d-1)(z) / (1/p)^(d)(z),
+// which is Newton's method for d = 1 and Halley's method for d = 2. The
+// derivatives of 1/p come from the Taylor coefficients of p at z.
+type householderStep struct {
+	// p and its derivatives up to order d.
+	derivatives []complexFunction
+	taylor      []complex128
+	reciprocal  []complex128
+	tolerance   float64
+}
+
+func (step *householderStep) Reset(z complex128) {}
+
+func (step *householderStep) Next(z complex128) (complex128, bool) {
+	factorial := 1.0
+	for k, derivative := range step.derivatives {
+		if k > 0 {
+			factorial *= float64(k)
+		}
+		step.taylor[k] = derivative.Evaluate(z) / complex(factorial, 0)
+	}
+	if step.taylor[0] == 0 {
+		return z, true
+	}
+	// the Taylor coefficients r of p(z)/p, whose ratios are those of 1/p,
+	// satisfy p * r = p(z)
+	step.reciprocal[0] = 1
+	for k := 1; k < len(step.reciprocal); k++ {
+		var sum complex128
+		for j := 1; j <= k; j++ {
+			sum += step.taylor[j] * step.reciprocal[k-j]
+		}
+		step.reciprocal[k] = -sum / step.taylor[0]
+	}
+	// d * (1/p)^(d-1) / (1/p)^(d) = d * (d-1)! r[d-1] / (d! r[d])
+	d := len(step.reciprocal) - 1
+	next := z + step.reciprocal[d-1]/step.reciprocal[d]
+	return next, cmplx.Abs(z-next) <= step.tolerance
+}
+
+// The secant method, which replaces p'(z) of Newton's method with the slope
+// between the last two points. The first of them is SECANT_INITIAL_STEP away
+// from the pixel.
+type secantStep struct {
+	poly      complexFunction
+	previous  complex128
+	previousP complex128
+	// Specifies if the slope became 0 away from a root, after which the
+	// iteration stays at its point without converging.
+	stalled   bool
+	tolerance float64
+}
+
+func (step *secantStep) Reset(z complex128) {
+	step.previous = z + SECANT_INITIAL_STEP
+	step.previousP = step.poly.Evaluate(step.previous)
+	step.stalled = false
+}
+
+func (step *secantStep) Next(z complex128) (complex128, bool) {
+	if step.stalled {
+		return z, false
+	}
+	p := step.poly.Evaluate(z)
+	if p == 0 {
+		return z, true
+	}
+	if p == step.previousP {
+		// the slope is 0, so the iteration can't go further
+		step.stalled = true
+		return z, false
+	}
+	next := z - p*(z-step.previous)/(p-step.previousP)
+	step.previous, step.previousP = z, p
+	return next, cmplx.Abs(z-next) <= step.tolerance
+}
@@ -0,0 +1,179 @@
+package fractals
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"math/cmplx"
+	"strings"
+
+	"github.com/yishakk/fractage/src/helpers"
+	math_helpers "github.com/yishakk/fractage/src/helpers/math"
+)
+
+const (
+	NOVA_MODE_JULIA      = "julia"
+	NOVA_MODE_MANDELBROT = "mandelbrot"
+
+	NOVA_DEFAULT_RELAXATION = 1 + 0i
+	NOVA_DEFAULT_TOLERANCE  = 1e-8
+	// The size of p' below which a critical point is a pole of the step.
+	NOVA_POLE_TOLERANCE = 1e-9
+)
+
+var (
+	NOVA_MODES = []string{
+		NOVA_MODE_JULIA,
+		NOVA_MODE_MANDELBROT,
+	}
+	// The colorings of the Newton basin that nova fractals support.
+	NOVA_COLORINGS = []string{
+		NEWTON_BASIN_COLORING_PHASE,
+		NEWTON_BASIN_COLORING_ITERATIONS,
+	}
+)
+
+// Properties of a nova fractal image, whose orbits follow the relaxed Newton
+// step z - a * p(z)/p'(z) + c.
+type Nova struct {
+	Width         int
+	Height        int
+	ColorPalette  helpers.ColorPalette
+	MaxIterations int
+	Polynomial    math_helpers.CmplxPolynomial
+	// The relaxation factor a.
+	Relaxation complex128
+	// The value of c in the julia mode.
+	C complex128
+	// The starting point of the orbits in the mandelbrot mode.
+	Z0 complex128
+	// The julia mode starts the orbits at the pixels, while the mandelbrot
+	// mode uses the pixels as c. It's mandelbrot when it's empty.
+	Mode      string
+	BailOut   float64
+	Tolerance float64
+	Region    helpers.Rect
+	// The coloring of the pixels, which is iterations when it's empty.
+	Coloring   string
+	Background color.RGBA
+}
+
+// Checks if a name exists in the set of NOVA_MODES.
+func IsValidNovaMode(txt string) bool {
+	modeName := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	for _, mode := range NOVA_MODES {
+		if mode == modeName {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if a name exists in the set of NOVA_COLORINGS.
+func IsValidNovaColoring(txt string) bool {
+	coloringName := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	for _, coloring := range NOVA_COLORINGS {
+		if coloring == coloringName {
+			return true
+		}
+	}
+	return false
+}
+
+// Finds the critical points of the step z - a * p(z)/p'(z) + c, which don't
+// depend on c. They're the roots of (1 - a)p'^2 + a * p * p” that aren't
+// poles of the step, sorted like the roots of a Newton basin.
+func NovaCriticalPoints(polynomial math_helpers.CmplxPolynomial, relaxation complex128) ([]complex128, error) {
+	deriv := polynomial.FirstDerivative()
+	deriv2 := deriv.FirstDerivative()
+	derivSquared := deriv.Multiply(deriv)
+	product := polynomial.Multiply(deriv2)
+	numerator := derivSquared.Scale(1 - relaxation).Add(product.Scale(relaxation))
+	if len(numerator.Terms) == 0 {
+		return nil, errors.New("The step has no critical points")
+	}
+	points, err := NewtonBasinRoots(numerator)
+	if err != nil {
+		return nil, err
+	}
+	criticalPoints := []complex128{}
+	for _, point := range points {
+		if cmplx.Abs(deriv.Evaluate(point)) < NOVA_POLE_TOLERANCE && cmplx.Abs(polynomial.Evaluate(point)) >= NOVA_POLE_TOLERANCE {
+			continue
+		}
+		criticalPoints = append(criticalPoints, point)
+	}
+	return criticalPoints, nil
+}
+
+// Writes the nova fractal image to the given output.
+func (props *Nova) WriteImage(output io.Writer) error {
+	viewport := image.Rect(0, 0, props.Width, props.Height)
+	img := image.NewRGBA(viewport)
+	helpers.FillImage(img, props.Background)
+	err := props.render(img)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(output, img)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Helper function for rendering the nova fractal.
+func (props *Nova) render(img *image.RGBA) error {
+	width, height := float64(props.Width), float64(props.Height)
+	step := math.Max(props.Region.Width/width, props.Region.Height/height)
+	xOffset := props.Region.X - (width*step-props.Region.Width)/2.0
+	yOffset := props.Region.Y - (height*step-props.Region.Height)/2.0
+	err := props.ColorPalette.TranslateColorTransitions()
+	if err != nil {
+		return err
+	}
+	relaxation := props.Relaxation
+	if relaxation == 0 {
+		relaxation = NOVA_DEFAULT_RELAXATION
+	}
+	tolerance := props.Tolerance
+	if tolerance <= 0 {
+		tolerance = NOVA_DEFAULT_TOLERANCE
+	}
+	mandelbrot := strings.Trim(props.Mode, helpers.WHITESPACE_CUTSET) != NOVA_MODE_JULIA
+	coloring := strings.Trim(props.Coloring, helpers.WHITESPACE_CUTSET)
+	poly := props.Polynomial
+	polyDeriv := poly.FirstDerivative()
+	var pixelColor color.RGBA
+	for y := 0; y < props.Height; y++ {
+		for x := 0; x < props.Width; x++ {
+			pixel := complex(xOffset+float64(x)*step, yOffset+float64(y)*step)
+			Z, C := pixel, props.C
+			if mandelbrot {
+				Z, C = props.Z0, pixel
+			}
+			n := 0
+			converged := false
+			for (n < props.MaxIterations) && (cmplx.Abs(Z) < props.BailOut) && !converged {
+				next := Z - relaxation*poly.Evaluate(Z)/polyDeriv.Evaluate(Z) + C
+				converged = cmplx.Abs(next-Z) <= tolerance
+				Z = next
+				n++
+			}
+			mag := float64(props.MaxIterations-n) / float64(props.MaxIterations)
+			if coloring == NEWTON_BASIN_COLORING_PHASE {
+				pixelColor = newtonPhaseColor(Z, mag)
+			} else {
+				pixelColor, err = props.ColorPalette.GetColor(mag)
+				if err != nil {
+					return err
+				}
+			}
+			img.Set(x, y, pixelColor)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package fractals
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+// Finds the bounds of the points of an orbit that ignore its outliers. On
+// each axis, the bounds hold the middle percentile percent of the points,
+// and a margin of margin times the larger side is added around them.
+func fitOrbitBounds(xs, ys []float64, percentile, margin float64) (helpers.Rect, error) {
+	if len(xs) == 0 || len(xs) != len(ys) {
+		return helpers.EMPTY_REGION, errors.New("The orbit has no points")
+	}
+	if percentile <= 0 || percentile > 100 {
+		return helpers.EMPTY_REGION, errors.New("The percentile must be greater than 0 and at most 100")
+	}
+	xMin, xMax := percentileRange(xs, percentile)
+	yMin, yMax := percentileRange(ys, percentile)
+	width, height := xMax-xMin, yMax-yMin
+	if width == 0 && height == 0 {
+		return helpers.EMPTY_REGION, errors.New("The orbit converges to a point")
+	}
+	margin *= math.Max(width, height)
+	return helpers.Rect{
+		X:      xMin - margin,
+		Y:      yMin - margin,
+		Width:  width + 2*margin,
+		Height: height + 2*margin,
+	}, nil
+}
+
+// Finds the smallest and largest of the middle percentile percent of the
+// values.
+func percentileRange(values []float64, percentile float64) (min, max float64) {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	outliers := int(math.Floor((1 - percentile/100) / 2 * float64(len(sorted)-1)))
+	return sorted[outliers], sorted[len(sorted)-1-outliers]
+}
@@ -0,0 +1,172 @@
+package fractals
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	ORBIT_TRAP_POINT  = "point"
+	ORBIT_TRAP_CROSS  = "cross"
+	ORBIT_TRAP_CIRCLE = "circle"
+	ORBIT_TRAP_LINE   = "line"
+	ORBIT_TRAP_IMAGE  = "image"
+
+	ORBIT_TRAP_MODE_MIN     = "min"
+	ORBIT_TRAP_MODE_AVERAGE = "average"
+
+	ORBIT_TRAP_DEFAULT_SHAPE = ORBIT_TRAP_POINT
+	ORBIT_TRAP_DEFAULT_MODE  = ORBIT_TRAP_MODE_MIN
+	ORBIT_TRAP_DEFAULT_SIZE  = 0.5
+)
+
+var (
+	ORBIT_TRAP_SHAPES = map[string]func(trap *OrbitTrap, w complex128) float64{
+		ORBIT_TRAP_POINT: func(trap *OrbitTrap, w complex128) float64 {
+			return cmplx.Abs(w)
+		},
+		ORBIT_TRAP_CROSS: func(trap *OrbitTrap, w complex128) float64 {
+			return math.Min(math.Abs(real(w)), math.Abs(imag(w)))
+		},
+		ORBIT_TRAP_CIRCLE: func(trap *OrbitTrap, w complex128) float64 {
+			return math.Abs(cmplx.Abs(w) - trap.Size)
+		},
+		ORBIT_TRAP_LINE: func(trap *OrbitTrap, w complex128) float64 {
+			return math.Abs(imag(w))
+		},
+		ORBIT_TRAP_IMAGE: func(trap *OrbitTrap, w complex128) float64 {
+			// distance to the rectangle covered by the image
+			halfWidth, halfHeight := trap.imageSize()
+			dx := math.Max(math.Abs(real(w))-halfWidth, 0)
+			dy := math.Max(math.Abs(imag(w))-halfHeight, 0)
+			return math.Hypot(dx, dy)
+		},
+	}
+)
+
+// Properties of an orbit trap.
+type OrbitTrap struct {
+	Shape string
+	// The position of the trap in the complex plane.
+	Center complex128
+	// The distance scale of the coloring, which is also the radius of circle
+	// traps and the width of image traps.
+	Size float64
+	// The rotation of the trap in degrees.
+	Angle float64
+	// Specifies if the minimum or the average distance of the orbit is used.
+	Mode string
+	// The image of image traps.
+	Image image.Image
+}
+
+// Returns half the width and height of the area covered by an image trap.
+func (trap *OrbitTrap) imageSize() (halfWidth, halfHeight float64) {
+	bounds := trap.Image.Bounds()
+	halfWidth = trap.Size / 2
+	halfHeight = halfWidth * float64(bounds.Dy()) / float64(bounds.Dx())
+	return
+}
+
+// Translates and rotates z into the coordinate system of the trap.
+func (trap *OrbitTrap) transform(z complex128) complex128 {
+	return (z - trap.Center) * cmplx.Rect(1, -trap.Angle*math.Pi/180)
+}
+
+// Checks that the properties of the trap are valid.
+func (trap *OrbitTrap) Validate() error {
+	if _, found := ORBIT_TRAP_SHAPES[trap.Shape]; !found {
+		return errors.New("Invalid orbit trap shape")
+	}
+	if trap.Mode != ORBIT_TRAP_MODE_MIN && trap.Mode != ORBIT_TRAP_MODE_AVERAGE {
+		return errors.New("Invalid orbit trap mode")
+	}
+	if trap.Size <= 0 {
+		return errors.New("The orbit trap size must be greater than 0")
+	}
+	if trap.Shape == ORBIT_TRAP_IMAGE && (trap.Image == nil || trap.Image.Bounds().Empty()) {
+		return errors.New("An image orbit trap needs an image")
+	}
+	return nil
+}
+
+// Colors by the distance of the orbit to an orbit trap.
+type orbitTrapColoring struct {
+	trap     *OrbitTrap
+	distance func(trap *OrbitTrap, w complex128) float64
+	sum      float64
+	min      float64
+	count    int
+	// The color of the image trap where the orbit first landed on it.
+	hitColor color.RGBA
+	hit      bool
+}
+
+// Creates a coloring for the given orbit trap, which defaults to a point
+// trap at the origin.
+func newOrbitTrapColoring(trap *OrbitTrap) *orbitTrapColoring {
+	if trap == nil {
+		trap = &OrbitTrap{
+			Shape: ORBIT_TRAP_DEFAULT_SHAPE,
+			Size:  ORBIT_TRAP_DEFAULT_SIZE,
+			Mode:  ORBIT_TRAP_DEFAULT_MODE,
+		}
+	}
+	return &orbitTrapColoring{trap: trap, distance: ORBIT_TRAP_SHAPES[trap.Shape]}
+}
+
+func (coloring *orbitTrapColoring) Reset(z complex128) {
+	coloring.sum = 0
+	coloring.min = math.Inf(1)
+	coloring.count = 0
+	coloring.hit = false
+	coloring.Visit(z)
+}
+
+func (coloring *orbitTrapColoring) Visit(z complex128) {
+	w := coloring.trap.transform(z)
+	d := coloring.distance(coloring.trap, w)
+	if math.IsNaN(d) {
+		return
+	}
+	coloring.sum += d
+	coloring.min = math.Min(coloring.min, d)
+	coloring.count++
+	if coloring.trap.Shape == ORBIT_TRAP_IMAGE && !coloring.hit && d == 0 {
+		coloring.hitColor, coloring.hit = coloring.imageColor(w)
+	}
+}
+
+// Retrieves the color of the trap image at w, which is inside the image area.
+func (coloring *orbitTrapColoring) imageColor(w complex128) (color.RGBA, bool) {
+	bounds := coloring.trap.Image.Bounds()
+	halfWidth, halfHeight := coloring.trap.imageSize()
+	x := bounds.Min.X + int((real(w)+halfWidth)/(2*halfWidth)*float64(bounds.Dx()))
+	y := bounds.Min.Y + int((imag(w)+halfHeight)/(2*halfHeight)*float64(bounds.Dy()))
+	x = int(math.Min(float64(x), float64(bounds.Max.X-1)))
+	y = int(math.Min(float64(y), float64(bounds.Max.Y-1)))
+	pixelColor := color.RGBAModel.Convert(coloring.trap.Image.At(x, y)).(color.RGBA)
+	return pixelColor, pixelColor.A > 0
+}
+
+func (coloring *orbitTrapColoring) Position(z complex128, n int, escaped bool) float64 {
+	if coloring.count == 0 {
+		return 1
+	}
+	d := coloring.min
+	if coloring.trap.Mode == ORBIT_TRAP_MODE_AVERAGE {
+		d = coloring.sum / float64(coloring.count)
+	}
+	return d / (d + coloring.trap.Size)
+}
+
+func (coloring *orbitTrapColoring) Color(z complex128, n int, escaped bool) (color.RGBA, bool) {
+	return coloring.hitColor, coloring.hit
+}
+
+func (coloring *orbitTrapColoring) MinBailOut() float64 {
+	return 0
+}
@@ -0,0 +1,341 @@
+package fractals
+
+import (
+	"errors"
+	"image"
+	"math"
+	"math/big"
+	"math/cmplx"
+
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+const (
+	// A pixel is glitched when its |z| falls below this fraction of the |z|
+	// of the reference orbit.
+	PERTURBATION_GLITCH_TOLERANCE = 1e-3
+	// The maximum number of reference orbits computed for an image.
+	PERTURBATION_MAX_REFERENCES = 32
+	// The smallest pixel size that float64 deltas can represent.
+	PERTURBATION_MIN_PIXEL_SIZE = 1e-290
+	// The bits of precision of reference orbits beyond the ones needed to
+	// tell neighbouring pixels apart.
+	REFERENCE_ORBIT_EXTRA_PRECISION = 64
+	// The largest error of the series approximation in pixels.
+	SERIES_APPROXIMATION_TOLERANCE = 1e-3
+)
+
+// The orbit of a point computed with arbitrary precision and rounded to
+// float64.
+type referenceOrbit struct {
+	// The offset of the point from the center of the image.
+	offset complex128
+	points []complex128
+}
+
+// A pixel of a deep zoom image.
+type perturbationPixel struct {
+	x, y int
+	// The offset of the pixel from the center of the image.
+	offset complex128
+}
+
+// A pixel whose orbit couldn't be computed from a reference orbit.
+type glitchedPixel struct {
+	perturbationPixel
+	// The ratio of |z| to the |z| of the reference orbit when the glitch was
+	// detected.
+	ratio float64
+	// Specifies if the reference orbit ended before the orbit of the pixel.
+	ended bool
+	n     int
+}
+
+// The terms A, B and C of the series approximation
+// δ_n = Aδc + Bδc^2 + Cδc^3 after a number of skipped iterations.
+type seriesApproximation struct {
+	skip    int
+	a, b, c complex128
+}
+
+// The state of a deep zoom render of the Mandelbrot set. Pixels are iterated
+// as float64 deltas from reference orbits that are computed with arbitrary
+// precision.
+type perturbationRender struct {
+	props              *MandelbrotSet
+	img                *image.RGBA
+	coloring           EscapeTimeColoring
+	derivativeColoring EscapeTimeDerivativeColoring
+	tracksDerivative   bool
+	bailOut            float64
+	step               float64
+	m                  int
+	center             helpers.BigPoint
+	precision          uint
+	// The binomial coefficients of m.
+	binomials []complex128
+}
+
+// Renders a deep zoom of the Mandelbrot set around its exact center.
+func (props *MandelbrotSet) renderPerturbation(img *image.RGBA, coloring EscapeTimeColoring, bailOut, step float64) error {
+	if !isIntegerExponent(complex(props.M, props.MImag)) {
+		return errors.New("Deep zoom only supports integer values of m greater than 1")
+	}
+	if step < PERTURBATION_MIN_PIXEL_SIZE {
+		return errors.New("The region is too small for deep zoom")
+	}
+	render := perturbationRender{
+		props:     props,
+		img:       img,
+		coloring:  coloring,
+		bailOut:   bailOut,
+		step:      step,
+		m:         int(props.M),
+		center:    exactCenter(props.Center, props.Region),
+		precision: uint(math.Max(53, -math.Log2(step))) + REFERENCE_ORBIT_EXTRA_PRECISION,
+	}
+	render.derivativeColoring, render.tracksDerivative = coloring.(EscapeTimeDerivativeColoring)
+	render.binomials = make([]complex128, render.m+1)
+	render.binomials[0] = 1
+	for k := 1; k <= render.m; k++ {
+		render.binomials[k] = render.binomials[k-1] * complex(float64(render.m-k+1)/float64(k), 0)
+	}
+	pending := make([]perturbationPixel, 0, props.Width*props.Height)
+	for y := 0; y < props.Height; y++ {
+		for x := 0; x < props.Width; x++ {
+			pending = append(pending, perturbationPixel{
+				x:      x,
+				y:      y,
+				offset: complex((float64(x)-float64(props.Width)/2)*step, (float64(y)-float64(props.Height)/2)*step),
+			})
+		}
+	}
+	reference := render.newReferenceOrbit(0)
+	for references := 1; len(pending) > 0; references++ {
+		glitched, err := render.renderPixels(reference, pending, references < PERTURBATION_MAX_REFERENCES)
+		if err != nil {
+			return err
+		}
+		if len(glitched) == 0 {
+			break
+		}
+		// the most glitched pixel is usually close to the center of its glitch
+		best := glitched[0]
+		for _, pixel := range glitched[1:] {
+			if best.ended && (!pixel.ended || pixel.n > best.n) || !best.ended && !pixel.ended && pixel.ratio < best.ratio {
+				best = pixel
+			}
+		}
+		reference = render.newReferenceOrbit(best.offset)
+		pending = pending[:0]
+		for _, pixel := range glitched {
+			pending = append(pending, pixel.perturbationPixel)
+		}
+	}
+	return nil
+}
+
+// Colors the given pixels from a reference orbit and returns the ones that
+// glitched.
+func (render *perturbationRender) renderPixels(reference *referenceOrbit, pixels []perturbationPixel, detectGlitches bool) ([]glitchedPixel, error) {
+	series := seriesApproximation{a: 1}
+	if render.props.SeriesApproximation && allowsSkippedIterations(render.coloring) {
+		series = render.approximateSeries(reference, pixels)
+	}
+	var glitched []glitchedPixel
+	for _, pixel := range pixels {
+		dc := pixel.offset - reference.offset
+		z, dz, n, ok := render.iterate(reference, dc, series, detectGlitches)
+		if !ok {
+			ratio := cmplx.Abs(z) / cmplx.Abs(reference.points[n])
+			glitched = append(glitched, glitchedPixel{
+				perturbationPixel: pixel,
+				ratio:             ratio,
+				ended:             n+1 >= len(reference.points),
+				n:                 n,
+			})
+			continue
+		}
+		if render.tracksDerivative {
+			render.derivativeColoring.SetDerivative(dz)
+		}
+		// z escaped if n < MaxIterations
+		pixelColor, err := escapeTimePixelColor(&render.props.ColorPalette, render.coloring, z, n, n < render.props.MaxIterations)
+		if err != nil {
+			return nil, err
+		}
+		render.img.Set(pixel.x, pixel.y, pixelColor)
+	}
+	return glitched, nil
+}
+
+// Iterates the orbit of the pixel at offset dc from the reference orbit and
+// returns its last point, derivative and iteration count. ok is false when
+// the pixel glitched.
+func (render *perturbationRender) iterate(reference *referenceOrbit, dc complex128, series seriesApproximation, detectGlitches bool) (z, dz complex128, n int, ok bool) {
+	n = series.skip
+	delta := dc * (series.a + dc*(series.b+dc*series.c))
+	dz = series.a + dc*(2*series.b+3*dc*series.c)
+	z = reference.points[n] + delta
+	if n > 0 && render.escaped(z) {
+		// the pixel escaped during the skipped iterations
+		return render.iterate(reference, dc, seriesApproximation{a: 1}, detectGlitches)
+	}
+	render.coloring.Reset(z)
+	for n < render.props.MaxIterations {
+		if render.escaped(z) {
+			break
+		}
+		if n+1 >= len(reference.points) {
+			if detectGlitches {
+				return z, dz, n, false
+			}
+			// continues without the reference orbit, which loses precision
+			if render.tracksDerivative {
+				dz = complex(float64(render.m), 0)*intPow(z, render.m-1)*dz + 1
+			}
+			z = intPow(z, render.m) + reference.points[0] + dc
+			render.coloring.Visit(z)
+			n++
+			continue
+		}
+		if render.tracksDerivative {
+			dz = complex(float64(render.m), 0)*intPow(z, render.m-1)*dz + 1
+		}
+		delta = render.perturb(reference.points[n], delta) + dc
+		n++
+		z = reference.points[n] + delta
+		render.coloring.Visit(z)
+		if detectGlitches && cmplx.Abs(z) < PERTURBATION_GLITCH_TOLERANCE*cmplx.Abs(reference.points[n]) {
+			return z, dz, n, false
+		}
+	}
+	return z, dz, n, true
+}
+
+// Returns (Z + δ)^m - Z^m for a point Z of the reference orbit.
+func (render *perturbationRender) perturb(Z, delta complex128) complex128 {
+	if render.m == 2 {
+		return (2*Z + delta) * delta
+	}
+	// Horner's scheme over the binomial expansion
+	var sum complex128
+	ZPow := complex128(1)
+	for k := render.m; k >= 1; k-- {
+		sum = sum*delta + render.binomials[k]*ZPow
+		ZPow *= Z
+	}
+	return sum * delta
+}
+
+// Checks if z is beyond the bail-out.
+func (render *perturbationRender) escaped(z complex128) bool {
+	return mandelbrotEscaped(z, complex(render.props.M, 0), render.bailOut)
+}
+
+// Computes the orbit of the point at the given offset from the center of the
+// image with arbitrary precision.
+func (render *perturbationRender) newReferenceOrbit(offset complex128) *referenceOrbit {
+	newFloat := func() *big.Float {
+		return new(big.Float).SetPrec(render.precision)
+	}
+	cx, cy := newFloat().SetFloat64(real(offset)), newFloat().SetFloat64(imag(offset))
+	cx.Add(cx, render.center.X)
+	cy.Add(cy, render.center.Y)
+	zx, zy := newFloat().Set(cx), newFloat().Set(cy)
+	bx, by, t1, t2 := newFloat(), newFloat(), newFloat(), newFloat()
+	reference := referenceOrbit{offset: offset}
+	for n := 0; ; n++ {
+		x, _ := zx.Float64()
+		y, _ := zy.Float64()
+		z := complex(x, y)
+		reference.points = append(reference.points, z)
+		if n == render.props.MaxIterations || render.escaped(z) {
+			break
+		}
+		// z = z^m + c
+		bx.Set(zx)
+		by.Set(zy)
+		for i := 1; i < render.m; i++ {
+			t1.Mul(zx, bx)
+			t2.Mul(zy, by)
+			t1.Sub(t1, t2)
+			t2.Mul(zx, by)
+			zy.Mul(zy, bx)
+			zy.Add(zy, t2)
+			zx.Set(t1)
+		}
+		zx.Add(zx, cx)
+		zy.Add(zy, cy)
+	}
+	return &reference
+}
+
+// Finds how many iterations the pixels can skip with a series approximation
+// by comparing it with the iterated orbits of the pixels at the edges of the
+// area they cover.
+func (render *perturbationRender) approximateSeries(reference *referenceOrbit, pixels []perturbationPixel) seriesApproximation {
+	minDc := pixels[0].offset - reference.offset
+	maxDc := minDc
+	for _, pixel := range pixels[1:] {
+		dc := pixel.offset - reference.offset
+		minDc = complex(math.Min(real(minDc), real(dc)), math.Min(imag(minDc), imag(dc)))
+		maxDc = complex(math.Max(real(maxDc), real(dc)), math.Max(imag(maxDc), imag(dc)))
+	}
+	midDc := (minDc + maxDc) / 2
+	probes := []complex128{
+		minDc, maxDc,
+		complex(real(minDc), imag(maxDc)), complex(real(maxDc), imag(minDc)),
+		complex(real(midDc), imag(minDc)), complex(real(midDc), imag(maxDc)),
+		complex(real(minDc), imag(midDc)), complex(real(maxDc), imag(midDc)),
+	}
+	deltas := make([]complex128, len(probes))
+	copy(deltas, probes)
+	m := complex(float64(render.m), 0)
+	series := seriesApproximation{a: 1}
+	for series.skip+1 < len(reference.points) {
+		Z := reference.points[series.skip]
+		d1 := m * intPow(Z, render.m-1)
+		d2 := render.binomials[2] * intPow(Z, render.m-2)
+		var d3 complex128
+		if render.m >= 3 {
+			d3 = render.binomials[3] * intPow(Z, render.m-3)
+		}
+		next := seriesApproximation{
+			skip: series.skip + 1,
+			a:    d1*series.a + 1,
+			b:    d1*series.b + d2*series.a*series.a,
+			c:    d1*series.c + 2*d2*series.a*series.b + d3*series.a*series.a*series.a,
+		}
+		tolerance := SERIES_APPROXIMATION_TOLERANCE * render.step * cmplx.Abs(next.a)
+		for i, dc := range probes {
+			deltas[i] = render.perturb(Z, deltas[i]) + dc
+			approximation := dc * (next.a + dc*(next.b+dc*next.c))
+			z := reference.points[next.skip] + deltas[i]
+			if render.escaped(z) || !(cmplx.Abs(approximation-deltas[i]) <= tolerance) {
+				return series
+			}
+		}
+		series = next
+	}
+	return series
+}
+
+// Checks if a coloring gives the same result when the first iterations of an
+// orbit are skipped.
+func allowsSkippedIterations(coloring EscapeTimeColoring) bool {
+	switch coloring.(type) {
+	case *exponentialColoring, *orbitTrapColoring:
+		return false
+	}
+	return true
+}
+
+// Raises z to a non-negative integer power.
+func intPow(z complex128, k int) complex128 {
+	result := complex128(1)
+	for ; k > 0; k-- {
+		result *= z
+	}
+	return result
+}
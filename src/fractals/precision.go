@@ -0,0 +1,86 @@
+package fractals
+
+import (
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/yishakk/fractage/src/helpers"
+)
+
+const (
+	PRECISION_AUTO          = "auto"
+	PRECISION_FLOAT64       = "float64"
+	PRECISION_DOUBLE_DOUBLE = "dd"
+	PRECISION_BIG           = "big"
+	// The smallest pixel sizes, relative to the magnitude of the coordinates
+	// of the region, that float64 and double-double arithmetic resolve.
+	FLOAT64_MIN_RELATIVE_PIXEL_SIZE       = 1e-13
+	DOUBLE_DOUBLE_MIN_RELATIVE_PIXEL_SIZE = 1e-29
+)
+
+var (
+	// The precisions from the cheapest to the most expensive one.
+	PRECISIONS = []string{
+		PRECISION_FLOAT64,
+		PRECISION_DOUBLE_DOUBLE,
+		PRECISION_BIG,
+	}
+)
+
+// Checks if a name exists in the set of PRECISIONS names or is auto.
+func IsValidPrecision(txt string) bool {
+	precision := strings.Trim(txt, helpers.WHITESPACE_CUTSET)
+	if precision == PRECISION_AUTO {
+		return true
+	}
+	for _, name := range PRECISIONS {
+		if name == precision {
+			return true
+		}
+	}
+	return false
+}
+
+// Picks the precision that a render uses. auto picks the cheapest of the
+// supported precisions that resolves pixels of the given size in the region,
+// or the most precise one when none of them does. An empty precision is
+// float64.
+func choosePrecision(precision string, region helpers.Rect, step float64, supported []string) string {
+	precision = strings.Trim(precision, helpers.WHITESPACE_CUTSET)
+	if precision == "" {
+		return PRECISION_FLOAT64
+	}
+	if precision != PRECISION_AUTO {
+		return precision
+	}
+	// the orbits of escape-time fractals visit points around |z| = 1
+	magnitude := math.Max(1, math.Max(
+		math.Max(math.Abs(region.X), math.Abs(region.X+region.Width)),
+		math.Max(math.Abs(region.Y), math.Abs(region.Y+region.Height)),
+	))
+	relativeStep := step / magnitude
+	minRelativeSteps := map[string]float64{
+		PRECISION_FLOAT64:       FLOAT64_MIN_RELATIVE_PIXEL_SIZE,
+		PRECISION_DOUBLE_DOUBLE: DOUBLE_DOUBLE_MIN_RELATIVE_PIXEL_SIZE,
+		PRECISION_BIG:           0,
+	}
+	for _, name := range supported {
+		if relativeStep >= minRelativeSteps[name] {
+			return name
+		}
+	}
+	return supported[len(supported)-1]
+}
+
+// Returns the exact center of a region whose center may be known with more
+// digits than its float64 values have.
+func exactCenter(center *helpers.BigPoint, region helpers.Rect) helpers.BigPoint {
+	if center != nil {
+		return *center
+	}
+	return helpers.BigPoint{
+		X: big.NewFloat(region.X + region.Width/2),
+		Y: big.NewFloat(region.Y + region.Height/2),
+	}
+}
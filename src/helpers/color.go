@@ -2,10 +2,11 @@ package helpers
 
 import (
 	"errors"
+	"fmt"
 	"image/color"
+	"math"
 	"math/rand"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -36,118 +37,230 @@ func RandomAlphaColor() color.RGBA {
 
 // Parses a given color value.
 func ParseColor(txt string) (color.RGBA, error) {
-	colorParsers := make(map[string]func(string) (color.RGBA, error), 2)
+	colorParsers := make(map[string]func(string) (color.RGBA, error), 6)
 	colorParsers["#"] = ParseHexColor
 	colorParsers["rgb"] = ParseRGBColor
-	colorText := strings.Trim(strings.ToLower(txt), " ")
+	colorParsers["hsl"] = ParseHSLColor
+	colorParsers["hsv"] = ParseHSVColor
+	colorParsers["hwb"] = ParseHWBColor
+	colorParsers["oklch"] = ParseOKLCHColor
+	colorText := strings.Trim(strings.ToLower(txt), WHITESPACE_CUTSET)
 
 	for prefix, parser := range colorParsers {
 		if strings.HasPrefix(colorText, prefix) {
 			return parser(colorText)
 		}
 	}
-	return ParseNameColor(txt)
+	return ParseNameColor(colorText)
 }
 
 // Parses a hexadecimal color value.
 //
-// Format of text: #[0-9a-f]{3, 12}
+// Format of text: #rgb, #rgba, #rrggbb or #rrggbbaa, where each component is
+// made of hexadecimal digits.
 func ParseHexColor(txt string) (color.RGBA, error) {
-	valid, err := regexp.Match("^#[0-9a-f]*$", []byte(txt))
-	if err != nil || !valid {
+	if !strings.HasPrefix(txt, "#") {
 		return color.RGBA{}, errors.New("Invalid hex color pattern")
 	}
-	valuesTxt := []rune(SubString(txt, 1, len(txt)))
-	colorParts := make([]rune, 8)
-	if len(valuesTxt) == 3 || len(valuesTxt) == 4 {
-		colorParts[0] = valuesTxt[0]
-		colorParts[1] = valuesTxt[0]
-		colorParts[2] = valuesTxt[1]
-		colorParts[3] = valuesTxt[1]
-		colorParts[4] = valuesTxt[2]
-		colorParts[5] = valuesTxt[2]
-		colorParts[6] = 'f'
-		colorParts[7] = 'f'
-		if len(valuesTxt) == 4 {
-			colorParts[6] = valuesTxt[3]
-			colorParts[7] = valuesTxt[3]
+	valuesTxt := SubString(txt, 1, len(txt))
+	digits := 0
+	switch len(valuesTxt) {
+	case 3, 4:
+		digits = 1
+	case 3 * 2, 4 * 2:
+		digits = 2
+	default:
+		return color.RGBA{}, fmt.Errorf("Invalid hex color pattern: expected 3, 4, 6 or 8 digits, got %d", len(valuesTxt))
+	}
+	channels := [4]uint8{0, 0, 0, 255}
+	for i, name := range []string{"red", "green", "blue", "alpha"} {
+		if (i+1)*digits > len(valuesTxt) {
+			break
 		}
-	} else if len(valuesTxt) == 3*2 || len(valuesTxt) == 4*2 {
-		colorParts[0] = valuesTxt[0]
-		colorParts[1] = valuesTxt[1]
-		colorParts[2] = valuesTxt[2]
-		colorParts[3] = valuesTxt[3]
-		colorParts[4] = valuesTxt[4]
-		colorParts[5] = valuesTxt[5]
-		colorParts[6] = 'f'
-		colorParts[7] = 'f'
-		if len(valuesTxt) == 4*2 {
-			colorParts[6] = valuesTxt[6]
-			colorParts[7] = valuesTxt[7]
+		componentTxt := valuesTxt[i*digits : (i+1)*digits]
+		value, err := strconv.ParseUint(componentTxt, 16, 8)
+		if err != nil {
+			return color.RGBA{}, fmt.Errorf("Invalid %s component in hex color: %q", name, componentTxt)
 		}
-	} else {
-		return color.RGBA{}, errors.New("Invalid hex color pattern")
+		if digits == 1 {
+			// a single digit is repeated, so f is ff
+			value *= 0x11
+		}
+		channels[i] = uint8(value)
+	}
+	return color.RGBA{channels[0], channels[1], channels[2], channels[3]}, nil
+}
+
+// Parses an rgb(a)? color value.
+//
+// Format of text: rgb(r, g, b), rgba(r, g, b, a) or rgb(r g b / a), where each
+// channel is a number in the range 0-255 or a percentage. In the
+// comma-separated form an integer alpha is in the range 0-255, otherwise the
+// alpha is a fraction in the range 0-1 or a percentage.
+func ParseRGBColor(txt string) (color.RGBA, error) {
+	args, alphaText, legacy, err := getColorFunctionArgs(txt, "rgb", "rgba")
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	var channels [3]float64
+	for i, name := range []string{"red", "green", "blue"} {
+		channels[i], err = parseColorComponent(args[i], name, "rgb", 255, 255)
+		if err != nil {
+			return color.RGBA{}, err
+		}
+	}
+	a := uint8(255)
+	if len(alphaText) > 0 {
+		if legacy && isInteger(alphaText) {
+			value, err := parseColorComponent(alphaText, "alpha", "rgb", 255, 255)
+			if err != nil {
+				return color.RGBA{}, err
+			}
+			a = uint8(math.Round(value))
+		} else {
+			a, err = parseAlphaComponent(alphaText, "rgb")
+			if err != nil {
+				return color.RGBA{}, err
+			}
+		}
+	}
+	return color.RGBA{
+		uint8(math.Round(channels[0])),
+		uint8(math.Round(channels[1])),
+		uint8(math.Round(channels[2])),
+		a,
+	}, nil
+}
+
+// Parses an hsl(a)? color value.
+//
+// Format of text: hsl(h, s, l), hsla(h, s, l, a) or hsl(h s l / a), where h is
+// a hue angle and s and l are percentages or fractions in the range 0-1.
+func ParseHSLColor(txt string) (color.RGBA, error) {
+	args, alphaText, _, err := getColorFunctionArgs(txt, "hsl", "hsla")
+	if err != nil {
+		return color.RGBA{}, err
 	}
-	r, err := strconv.ParseInt(string(colorParts[0:2]), 16, 16)
-	if err != nil || r < 0 || r > 255 {
+	h, err := parseHueComponent(args[0], "hsl")
+	if err != nil {
 		return color.RGBA{}, err
 	}
-	g, err := strconv.ParseInt(string(colorParts[2:4]), 16, 16)
-	if err != nil || g < 0 || g > 255 {
+	s, err := parseColorComponent(args[1], "saturation", "hsl", 1, 1)
+	if err != nil {
 		return color.RGBA{}, err
 	}
-	b, err := strconv.ParseInt(string(colorParts[4:6]), 16, 16)
-	if err != nil || b < 0 || b > 255 {
+	l, err := parseColorComponent(args[2], "lightness", "hsl", 1, 1)
+	if err != nil {
 		return color.RGBA{}, err
 	}
-	a, err := strconv.ParseInt(string(colorParts[6:8]), 16, 16)
-	if err != nil || a < 0 || a > 255 {
+	a, err := parseAlphaComponent(alphaText, "hsl")
+	if err != nil {
 		return color.RGBA{}, err
 	}
-	return color.RGBA{uint8(r), uint8(g), uint8(b), uint8(a)}, nil
+	r, g, b := hslToRGB(h, s, l)
+	return unitRGBToColor(r, g, b, a), nil
 }
 
-// Parses an rgb(a)? color value.
+// Parses an hsv(a)? color value.
 //
-// Format of text: rgb(\d+, \d+, \d+) or rgb(\d+, \d+, \d+)
-func ParseRGBColor(txt string) (color.RGBA, error) {
-	valid, err := regexp.Match("^rgba?\\([\\d, ]+\\)$", []byte(txt))
-	if err != nil || !valid {
-		return color.RGBA{}, errors.New("Invalid rgb color pattern")
-	}
-	start := 4
-	if txt[start-1] == 'a' {
-		start++
-	}
-	valuesTxt := SubString(txt, start, -1)
-	colorParts, err := GetCSV(valuesTxt)
-	if err != nil || !(len(colorParts) == 3 || len(colorParts) == 4) {
-		return color.RGBA{}, errors.New("Invalid rgb color pattern")
-	}
-	r, g, b, a := 0, 0, 0, 255
-	r, err = strconv.Atoi(colorParts[0])
-	if err != nil || r < 0 || r > 255 {
-		return color.RGBA{}, errors.New("Invalid rgb color pattern")
-	}
-	g, err = strconv.Atoi(colorParts[1])
-	if err != nil || g < 0 || g > 255 {
-		return color.RGBA{}, errors.New("Invalid rgb color pattern")
-	}
-	b, err = strconv.Atoi(colorParts[2])
-	if err != nil || b < 0 || b > 255 {
-		return color.RGBA{}, errors.New("Invalid rgb color pattern")
-	}
-	if len(colorParts) > 3 {
-		a, err = strconv.Atoi(colorParts[3])
-		if err != nil || a < 0 || a > 255 {
-			return color.RGBA{}, errors.New("Invalid rgb color pattern")
-		}
+// Format of text: hsv(h, s, v), hsva(h, s, v, a) or hsv(h s v / a), where h is
+// a hue angle and s and v are percentages or fractions in the range 0-1.
+func ParseHSVColor(txt string) (color.RGBA, error) {
+	args, alphaText, _, err := getColorFunctionArgs(txt, "hsv", "hsva")
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	h, err := parseHueComponent(args[0], "hsv")
+	if err != nil {
+		return color.RGBA{}, err
 	}
-	return color.RGBA{uint8(r), uint8(g), uint8(b), uint8(a)}, nil
+	s, err := parseColorComponent(args[1], "saturation", "hsv", 1, 1)
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	v, err := parseColorComponent(args[2], "value", "hsv", 1, 1)
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	a, err := parseAlphaComponent(alphaText, "hsv")
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	r, g, b := hsvToRGB(h, s, v)
+	return unitRGBToColor(r, g, b, a), nil
+}
+
+// Parses an hwb color value.
+//
+// Format of text: hwb(h w b) or hwb(h w b / a), where h is a hue angle and w
+// and b are the whiteness and blackness as percentages or fractions in the
+// range 0-1.
+func ParseHWBColor(txt string) (color.RGBA, error) {
+	args, alphaText, legacy, err := getColorFunctionArgs(txt, "hwb")
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	if legacy {
+		return color.RGBA{}, errors.New("Invalid hwb color pattern: the components are separated by spaces")
+	}
+	h, err := parseHueComponent(args[0], "hwb")
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	w, err := parseColorComponent(args[1], "whiteness", "hwb", 1, 1)
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	bl, err := parseColorComponent(args[2], "blackness", "hwb", 1, 1)
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	a, err := parseAlphaComponent(alphaText, "hwb")
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	if w+bl >= 1 {
+		gray := w / (w + bl)
+		return unitRGBToColor(gray, gray, gray, a), nil
+	}
+	r, g, b := hslToRGB(h, 1, 0.5)
+	scale := 1 - w - bl
+	return unitRGBToColor(r*scale+w, g*scale+w, b*scale+w, a), nil
+}
+
+// Parses an oklch color value.
+//
+// Format of text: oklch(l c h) or oklch(l c h / a), where l is the perceptual
+// lightness as a percentage or a fraction in the range 0-1, c is the chroma
+// (100% = 0.4) and h is a hue angle. Colors outside the sRGB gamut are
+// clipped.
+func ParseOKLCHColor(txt string) (color.RGBA, error) {
+	args, alphaText, _, err := getColorFunctionArgs(txt, "oklch")
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	l, err := parseColorComponent(args[0], "lightness", "oklch", 1, 1)
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	c, err := parseColorComponent(args[1], "chroma", "oklch", 0.4, math.Inf(1))
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	h, err := parseHueComponent(args[2], "oklch")
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	a, err := parseAlphaComponent(alphaText, "oklch")
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	r, g, b := oklchToRGB(l, c, h)
+	return unitRGBToColor(r, g, b, a), nil
 }
 
 // Returns the color value of a predetermined color that
-// matches the given name.
+// matches the given name. Names are matched case-insensitively.
 func ParseNameColor(txt string) (color.RGBA, error) {
 	file, err := os.ReadFile("src/data/colors.yaml")
 	if err != nil {
@@ -155,10 +268,190 @@ func ParseNameColor(txt string) (color.RGBA, error) {
 	}
 	colors := make(map[string]string, 5)
 	err = yaml.Unmarshal(file, colors)
+	if err != nil {
+		return color.RGBA{}, err
+	}
+	colorName := strings.Trim(txt, WHITESPACE_CUTSET)
 	for name, value := range colors {
-		if name == txt {
+		if strings.EqualFold(name, colorName) {
 			return ParseColor(value)
 		}
 	}
-	return color.RGBA{}, errors.New("Invalid color pattern")
+	return color.RGBA{}, fmt.Errorf("Invalid color pattern: %s", txt)
+}
+
+// Splits the arguments of a functional color notation such as rgb(...) into
+// its three color components and an optional alpha component.
+//
+// Both the comma-separated form, e.g. hsla(120, 50%, 50%, 0.5), and the
+// space-separated form, e.g. hsl(120 50% 50% / 0.5), are accepted. legacy
+// reports whether the comma-separated form was used.
+func getColorFunctionArgs(txt string, names ...string) (args []string, alpha string, legacy bool, err error) {
+	model := names[0]
+	name, body, found := strings.Cut(txt, "(")
+	name = strings.Trim(name, WHITESPACE_CUTSET)
+	validName := false
+	for _, n := range names {
+		if name == n {
+			validName = true
+			break
+		}
+	}
+	if !found || !validName || !strings.HasSuffix(body, ")") {
+		return nil, "", false, fmt.Errorf("Invalid %s color pattern", model)
+	}
+	body = strings.Trim(strings.TrimSuffix(body, ")"), WHITESPACE_CUTSET)
+	if strings.ContainsRune(body, ',') {
+		legacy = true
+		args = strings.Split(body, ",")
+		for i := range args {
+			args[i] = strings.Trim(args[i], WHITESPACE_CUTSET)
+		}
+		if len(args) == 4 {
+			alpha = args[3]
+			args = args[:3]
+		}
+	} else {
+		components, alphaText, hasAlpha := strings.Cut(body, "/")
+		args = strings.Fields(components)
+		if hasAlpha {
+			alpha = strings.Trim(alphaText, WHITESPACE_CUTSET)
+			if len(alpha) == 0 {
+				return nil, "", false, fmt.Errorf("Missing alpha component in %s color", model)
+			}
+		}
+	}
+	if len(args) != 3 {
+		return nil, "", false, fmt.Errorf("Invalid %s color pattern: expected 3 components and an optional alpha, got %d", model, len(args))
+	}
+	return args, alpha, legacy, nil
+}
+
+// Parses a color component that is either a number or a percentage of scale.
+// The value must lie in the range 0 to max.
+func parseColorComponent(txt, component, model string, scale, max float64) (float64, error) {
+	isPercentage := strings.HasSuffix(txt, "%")
+	value, err := strconv.ParseFloat(strings.TrimSuffix(txt, "%"), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("Invalid %s component in %s color: %q", component, model, txt)
+	}
+	if isPercentage {
+		value = value / 100 * scale
+	}
+	if value < 0 || value > max {
+		return 0, fmt.Errorf("The %s component of the %s color is out of range: %q", component, model, txt)
+	}
+	return value, nil
+}
+
+// Parses an alpha component that is either a fraction in the range 0-1 or a
+// percentage. An empty component is fully opaque.
+func parseAlphaComponent(txt, model string) (uint8, error) {
+	if len(txt) == 0 {
+		return 255, nil
+	}
+	value, err := parseColorComponent(txt, "alpha", model, 1, 1)
+	if err != nil {
+		return 0, err
+	}
+	return uint8(math.Round(value * 255)), nil
+}
+
+// Parses a hue angle and returns its value in degrees within the range 0-360.
+//
+// The angle can be a plain number of degrees or have one of the deg, rad,
+// grad or turn units.
+func parseHueComponent(txt, model string) (float64, error) {
+	units := []struct {
+		suffix  string
+		degrees float64
+	}{
+		{"grad", 360.0 / 400.0},
+		{"deg", 1},
+		{"rad", 180 / math.Pi},
+		{"turn", 360},
+	}
+	numberText, factor := txt, 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(txt, unit.suffix) {
+			numberText = strings.TrimSuffix(txt, unit.suffix)
+			factor = unit.degrees
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(numberText, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("Invalid hue component in %s color: %q", model, txt)
+	}
+	value = math.Mod(value*factor, 360)
+	if value < 0 {
+		value += 360
+	}
+	return value, nil
+}
+
+// Checks if the given text is an unsigned integer.
+func isInteger(txt string) bool {
+	if len(txt) == 0 {
+		return false
+	}
+	for _, c := range txt {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Converts hue (degrees), saturation and lightness to rgb values in the range 0-1.
+func hslToRGB(h, s, l float64) (r, g, b float64) {
+	a := s * math.Min(l, 1-l)
+	f := func(n float64) float64 {
+		k := math.Mod(n+h/30, 12)
+		return l - a*math.Max(-1, math.Min(math.Min(k-3, 9-k), 1))
+	}
+	return f(0), f(8), f(4)
+}
+
+// Converts hue (degrees), saturation and value to rgb values in the range 0-1.
+func hsvToRGB(h, s, v float64) (r, g, b float64) {
+	f := func(n float64) float64 {
+		k := math.Mod(n+h/60, 6)
+		return v - v*s*math.Max(0, math.Min(math.Min(k, 4-k), 1))
+	}
+	return f(5), f(3), f(1)
+}
+
+// Converts OKLCH lightness, chroma and hue (degrees) to sRGB values in the range 0-1.
+func oklchToRGB(l, c, h float64) (r, g, b float64) {
+	hRad := h * math.Pi / 180
+	labA, labB := c*math.Cos(hRad), c*math.Sin(hRad)
+	lms := [3]float64{
+		l + 0.3963377774*labA + 0.2158037573*labB,
+		l - 0.1055613458*labA - 0.0638541728*labB,
+		l - 0.0894841775*labA - 1.2914855480*labB,
+	}
+	for i := range lms {
+		lms[i] = lms[i] * lms[i] * lms[i]
+	}
+	r = 4.0767416621*lms[0] - 3.3077115913*lms[1] + 0.2309699292*lms[2]
+	g = -1.2684380046*lms[0] + 2.6097574011*lms[1] - 0.3413193965*lms[2]
+	b = -0.0041960863*lms[0] - 0.7034186147*lms[1] + 1.7076147010*lms[2]
+	return gammaEncode(r), gammaEncode(g), gammaEncode(b)
+}
+
+// Applies the sRGB transfer function to a linear channel value.
+func gammaEncode(value float64) float64 {
+	if value <= 0.0031308 {
+		return 12.92 * value
+	}
+	return 1.055*math.Pow(value, 1/2.4) - 0.055
+}
+
+// Converts rgb values in the range 0-1 to a color, clipping values outside the range.
+func unitRGBToColor(r, g, b float64, a uint8) color.RGBA {
+	channel := func(value float64) uint8 {
+		return uint8(math.Round(255 * math.Max(0, math.Min(1, value))))
+	}
+	return color.RGBA{channel(r), channel(g), channel(b), a}
 }
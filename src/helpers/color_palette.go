@@ -8,7 +8,6 @@ import (
 	"io"
 	"math"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/llgcode/draw2d/draw2dimg"
@@ -132,28 +131,31 @@ func ParseColorPalette(txt string) (ColorPalette, error) {
 		Name:        "",
 		Transitions: nil,
 	}
-	values, err := GetCSV(text)
-	if len(values)%2 != 0 {
+	tokens, err := TokenizeParameters(text)
+	if err != nil {
+		return nilPalette, err
+	}
+	if len(tokens) == 0 || len(tokens)%2 != 0 {
 		return nilPalette, errors.New("Invalid color palette")
 	}
-	transitions := make([]Transition, len(values)/2)
-	for i, j := 0, 0; i < len(values); i += 2 {
-		_, err := ParseColor(values[i])
+	transitions := make([]Transition, len(tokens)/2)
+	for i, j := 0, 0; i < len(tokens); i += 2 {
+		_, err := ParseColor(tokens[i].Value)
 		if err != nil {
-			return nilPalette, err
+			return nilPalette, tokens[i].Errorf("%s", err.Error())
 		}
-		position, err := strconv.ParseFloat(values[i+1], 32)
+		position, err := tokens[i+1].Float()
 		if err != nil {
 			return nilPalette, err
 		}
 		if j == 0 && position != 0.0 {
-			return nilPalette, errors.New("The first position must be 0")
+			return nilPalette, tokens[i+1].Errorf("The first position must be 0")
 		}
-		if j == len(values)/2-1 && position != 1.0 {
-			return nilPalette, errors.New("The last position must be 1")
+		if j == len(tokens)/2-1 && position != 1.0 {
+			return nilPalette, tokens[i+1].Errorf("The last position must be 1")
 		}
 		transitions[j] = Transition{
-			Color:    values[i],
+			Color:    tokens[i].Value,
 			Position: float32(position),
 		}
 		j++
@@ -1,8 +1,8 @@
 package helpers
 
 import (
-	"errors"
-	"strconv"
+	"fmt"
+	"math/big"
 )
 
 var (
@@ -11,47 +11,75 @@ var (
 
 // Converts a CSV of floats to a Rect type.
 func ParseRect(txt string) (Rect, error) {
-	values, err := GetCSV(txt)
+	tokens, err := TokenizeParameters(txt)
 	if err != nil {
 		return EMPTY_REGION, err
 	}
-	var region Rect
-	if len(values) == 2 {
-		width, err := strconv.ParseFloat(values[0], 64)
-		if err != nil {
-			return EMPTY_REGION, err
-		}
-		height, err := strconv.ParseFloat(values[1], 64)
+	if len(tokens) != 2 && len(tokens) != 4 {
+		return EMPTY_REGION, fmt.Errorf("Invalid rect: expected 2 or 4 values, got %d", len(tokens))
+	}
+	values := make([]float64, len(tokens))
+	for i := range tokens {
+		values[i], err = tokens[i].Float()
 		if err != nil {
 			return EMPTY_REGION, err
 		}
+	}
+	var region Rect
+	if len(values) == 2 {
 		region.X = 0
 		region.Y = 0
-		region.Width = width
-		region.Height = height
+		region.Width = values[0]
+		region.Height = values[1]
 		return region, nil
-	} else if len(values) == 4 {
-		x, err := strconv.ParseFloat(values[0], 64)
-		if err != nil {
-			return EMPTY_REGION, err
-		}
-		y, err := strconv.ParseFloat(values[1], 64)
-		if err != nil {
-			return EMPTY_REGION, err
-		}
-		width, err := strconv.ParseFloat(values[2], 64)
-		if err != nil {
-			return EMPTY_REGION, err
-		}
-		height, err := strconv.ParseFloat(values[3], 64)
+	}
+	region.X = values[0]
+	region.Y = values[1]
+	region.Width = values[2]
+	region.Height = values[3]
+	return region, nil
+}
+
+// Converts a CSV of decimal numbers to a BigRect type without losing any of
+// their digits.
+func ParseBigRect(txt string) (BigRect, error) {
+	tokens, err := TokenizeParameters(txt)
+	if err != nil {
+		return BigRect{}, err
+	}
+	if len(tokens) != 2 && len(tokens) != 4 {
+		return BigRect{}, fmt.Errorf("Invalid rect: expected 2 or 4 values, got %d", len(tokens))
+	}
+	values := make([]*big.Float, len(tokens))
+	for i := range tokens {
+		values[i], err = tokens[i].BigFloat()
 		if err != nil {
-			return EMPTY_REGION, err
+			return BigRect{}, err
 		}
-		region.X = x
-		region.Y = y
-		region.Width = width
-		region.Height = height
-		return region, nil
 	}
-	return EMPTY_REGION, errors.New("Invalid rect")
+	if len(values) == 2 {
+		return BigRect{X: new(big.Float), Y: new(big.Float), Width: values[0], Height: values[1]}, nil
+	}
+	return BigRect{X: values[0], Y: values[1], Width: values[2], Height: values[3]}, nil
+}
+
+// Converts a CSV of two decimal numbers to a BigPoint type without losing any
+// of their digits.
+func ParseBigPoint(txt string) (BigPoint, error) {
+	tokens, err := TokenizeParameters(txt)
+	if err != nil {
+		return BigPoint{}, err
+	}
+	if len(tokens) != 2 {
+		return BigPoint{}, fmt.Errorf("Invalid point: expected 2 values, got %d", len(tokens))
+	}
+	x, err := tokens[0].BigFloat()
+	if err != nil {
+		return BigPoint{}, err
+	}
+	y, err := tokens[1].BigFloat()
+	if err != nil {
+		return BigPoint{}, err
+	}
+	return BigPoint{X: x, Y: y}, nil
 }
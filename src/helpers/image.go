@@ -1,8 +1,17 @@
 package helpers
 
 import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/big"
+	"strings"
 
 	"github.com/llgcode/draw2d"
 	"github.com/llgcode/draw2d/draw2dimg"
@@ -10,6 +19,9 @@ import (
 
 const (
 	LINE_WIDTH = 0.2
+	// The largest width and height of an image of a data URI, which keeps
+	// small compressed images from decoding to huge ones.
+	DATA_URI_IMAGE_MAX_SIZE = 4096
 )
 
 // Represents a rectangular region.
@@ -25,6 +37,46 @@ type Point struct {
 	Y float64 `json:"y"`
 }
 
+// Represents a rectangular region whose values keep all of their digits.
+type BigRect struct {
+	X      *big.Float
+	Y      *big.Float
+	Width  *big.Float
+	Height *big.Float
+}
+
+// Rounds the values of the region to float64.
+func (rect BigRect) Rect() Rect {
+	x, _ := rect.X.Float64()
+	y, _ := rect.Y.Float64()
+	width, _ := rect.Width.Float64()
+	height, _ := rect.Height.Float64()
+	return Rect{X: x, Y: y, Width: width, Height: height}
+}
+
+// Returns the exact center of the region.
+func (rect BigRect) Center() BigPoint {
+	halfWidth := new(big.Float).Quo(rect.Width, big.NewFloat(2))
+	halfHeight := new(big.Float).Quo(rect.Height, big.NewFloat(2))
+	return BigPoint{X: exactSum(rect.X, halfWidth), Y: exactSum(rect.Y, halfHeight)}
+}
+
+// Returns a + b with enough precision to keep all of their digits.
+func exactSum(a, b *big.Float) *big.Float {
+	gap := a.MantExp(nil) - b.MantExp(nil)
+	if gap < 0 {
+		gap = -gap
+	}
+	prec := a.Prec() + b.Prec() + uint(gap)
+	return new(big.Float).SetPrec(prec).Add(a, b)
+}
+
+// Represents a point whose coordinates keep all of their digits.
+type BigPoint struct {
+	X *big.Float
+	Y *big.Float
+}
+
 // Fills an image with color.
 //  *image*: The image to fill.
 //  *color*: The color to fill the image with.
@@ -146,3 +198,34 @@ func PutPixel(gc *draw2dimg.GraphicContext, x, y float64, color color.RGBA) {
 	gc.Close()
 	gc.FillStroke()
 }
+
+// Decodes a PNG, JPEG or GIF image from a base64 data URI.
+//
+// Format of text: data:image/<type>;base64,<data>
+func ParseDataURIImage(txt string) (image.Image, error) {
+	header, data, found := strings.Cut(strings.Trim(txt, WHITESPACE_CUTSET), ",")
+	if !found || !strings.HasPrefix(header, "data:image/") || !strings.HasSuffix(header, ";base64") {
+		return nil, errors.New("Invalid image data URI")
+	}
+	// a '+' in a query string is decoded as a space
+	data = strings.ReplaceAll(data, " ", "+")
+	imageData, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		imageData, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+		if err != nil {
+			return nil, errors.New("Invalid base64 data in image data URI")
+		}
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width > DATA_URI_IMAGE_MAX_SIZE || config.Height > DATA_URI_IMAGE_MAX_SIZE {
+		return nil, fmt.Errorf("The image of the data URI is too large. Max: %dx%d", DATA_URI_IMAGE_MAX_SIZE, DATA_URI_IMAGE_MAX_SIZE)
+	}
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
@@ -0,0 +1,259 @@
+package math
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	op_ADD = iota
+	op_SUB
+	op_MUL
+	op_DIV
+	op_NEG
+	op_POW
+	op_CALL
+	op_CALL2
+
+	// Integer powers up to this magnitude are compiled to multiplications
+	// instead of cmplx.Pow.
+	MAX_MULTIPLIED_POWER = 64
+)
+
+// An instruction of a compiled expression, which stores the result of an
+// operation on registers a and b in register dst.
+type instruction struct {
+	op        uint8
+	dst       int
+	a         int
+	b         int
+	function  func(complex128) complex128
+	function2 func(complex128, complex128) complex128
+}
+
+// Computes the result of an instruction for the given operands.
+func (in *instruction) apply(a, b complex128) complex128 {
+	switch in.op {
+	case op_ADD:
+		return a + b
+	case op_SUB:
+		return a - b
+	case op_MUL:
+		return a * b
+	case op_DIV:
+		return a / b
+	case op_NEG:
+		return -a
+	case op_POW:
+		return cmplx.Pow(a, b)
+	case op_CALL:
+		return in.function(a)
+	}
+	return in.function2(a, b)
+}
+
+// An expression compiled to instructions on registers. The first registers
+// hold the variables, and the registers of constants keep their values
+// between runs. Programs aren't safe for concurrent use.
+type complexProgram struct {
+	instructions []instruction
+	registers    []complex128
+	result       int
+}
+
+// Runs the program for the given values of the variables and returns the
+// value of the expression.
+func (program *complexProgram) Run(values []complex128) complex128 {
+	registers := program.registers
+	copy(registers, values)
+	for i := range program.instructions {
+		in := &program.instructions[i]
+		switch in.op {
+		case op_ADD:
+			registers[in.dst] = registers[in.a] + registers[in.b]
+		case op_SUB:
+			registers[in.dst] = registers[in.a] - registers[in.b]
+		case op_MUL:
+			registers[in.dst] = registers[in.a] * registers[in.b]
+		case op_DIV:
+			registers[in.dst] = registers[in.a] / registers[in.b]
+		case op_NEG:
+			registers[in.dst] = -registers[in.a]
+		case op_POW:
+			registers[in.dst] = cmplx.Pow(registers[in.a], registers[in.b])
+		case op_CALL:
+			registers[in.dst] = in.function(registers[in.a])
+		case op_CALL2:
+			registers[in.dst] = in.function2(registers[in.a], registers[in.b])
+		}
+	}
+	return registers[program.result]
+}
+
+// Compiles syntax trees to programs. Operations on constants are folded into
+// constants, and operations that were already compiled reuse their register.
+// Every register is written at most once per run, so assignments bind
+// variables to the registers of their new values instead of overwriting them.
+type expressionCompiler struct {
+	program *complexProgram
+	// The registers that hold the current values of the variables.
+	bindings []int
+	// Specifies which registers hold constants.
+	constant  []bool
+	constants map[complex128]int
+	// The registers of the compiled operations.
+	operations map[string]int
+	// The registers of the compiled nodes, which derivatives share between
+	// many subtrees. They're only valid for the current bindings.
+	nodes map[expressionNode]int
+}
+
+func newExpressionCompiler(variables int) *expressionCompiler {
+	bindings := make([]int, variables)
+	for i := range bindings {
+		bindings[i] = i
+	}
+	return &expressionCompiler{
+		program:    &complexProgram{registers: make([]complex128, variables)},
+		bindings:   bindings,
+		constant:   make([]bool, variables),
+		constants:  map[complex128]int{},
+		operations: map[string]int{},
+		nodes:      map[expressionNode]int{},
+	}
+}
+
+// Binds a variable to the register of its new value.
+func (compiler *expressionCompiler) bind(variable, register int) {
+	compiler.bindings[variable] = register
+	compiler.nodes = map[expressionNode]int{}
+}
+
+func (compiler *expressionCompiler) newRegister(value complex128, constant bool) int {
+	compiler.program.registers = append(compiler.program.registers, value)
+	compiler.constant = append(compiler.constant, constant)
+	return len(compiler.program.registers) - 1
+}
+
+// Returns the register of a constant.
+func (compiler *expressionCompiler) constantRegister(value complex128) int {
+	if register, found := compiler.constants[value]; found {
+		return register
+	}
+	register := compiler.newRegister(value, true)
+	compiler.constants[value] = register
+	return register
+}
+
+// Returns the register of an operation on registers a and b, which is b = -1
+// for operations of one operand. name identifies the function of calls.
+func (compiler *expressionCompiler) emit(in instruction, name string) int {
+	if (in.op == op_ADD || in.op == op_MUL) && in.a > in.b {
+		in.a, in.b = in.b, in.a
+	}
+	key := fmt.Sprintf("%d %s %d %d", in.op, name, in.a, in.b)
+	if register, found := compiler.operations[key]; found {
+		return register
+	}
+	registers := compiler.program.registers
+	var register int
+	if compiler.constant[in.a] && (in.b < 0 || compiler.constant[in.b]) {
+		var b complex128
+		if in.b >= 0 {
+			b = registers[in.b]
+		}
+		register = compiler.constantRegister(in.apply(registers[in.a], b))
+	} else {
+		register = compiler.newRegister(0, false)
+		in.dst = register
+		compiler.program.instructions = append(compiler.program.instructions, in)
+	}
+	compiler.operations[key] = register
+	return register
+}
+
+// Compiles a node and returns the register of its value.
+func (compiler *expressionCompiler) compile(node expressionNode) int {
+	if register, found := compiler.nodes[node]; found {
+		return register
+	}
+	register := compiler.compileNode(node)
+	compiler.nodes[node] = register
+	return register
+}
+
+func (compiler *expressionCompiler) compileNode(node expressionNode) int {
+	switch node := node.(type) {
+	case *numberNode:
+		return compiler.constantRegister(node.value)
+	case *variableNode:
+		return compiler.bindings[node.index]
+	case *negationNode:
+		return compiler.emit(instruction{op: op_NEG, a: compiler.compile(node.operand), b: -1}, "")
+	case *binaryNode:
+		a, b := compiler.compile(node.left), compiler.compile(node.right)
+		switch node.operator {
+		case '+':
+			return compiler.emit(instruction{op: op_ADD, a: a, b: b}, "")
+		case '-':
+			return compiler.emit(instruction{op: op_SUB, a: a, b: b}, "")
+		case '*':
+			return compiler.emit(instruction{op: op_MUL, a: a, b: b}, "")
+		case '/':
+			return compiler.emit(instruction{op: op_DIV, a: a, b: b}, "")
+		}
+		if compiler.constant[b] {
+			exponent := compiler.program.registers[b]
+			k := real(exponent)
+			if imag(exponent) == 0 && k == math.Trunc(k) && math.Abs(k) <= MAX_MULTIPLIED_POWER {
+				return compiler.compileIntegerPower(a, int(k))
+			}
+		}
+		return compiler.emit(instruction{op: op_POW, a: a, b: b}, "")
+	case *callNode:
+		a := compiler.compile(node.argument)
+		if node.name == "sqr" {
+			return compiler.emit(instruction{op: op_MUL, a: a, b: a}, "")
+		}
+		return compiler.emit(instruction{op: op_CALL, a: a, b: -1, function: node.function}, node.name)
+	case *binaryCallNode:
+		a, b := compiler.compile(node.left), compiler.compile(node.right)
+		return compiler.emit(instruction{op: op_CALL2, a: a, b: b, function2: node.function}, node.name)
+	}
+	panic(fmt.Sprintf("unknown expression node %T", node))
+}
+
+// Compiles the kth power of a register to multiplications by squaring.
+func (compiler *expressionCompiler) compileIntegerPower(base, k int) int {
+	if k == 0 {
+		return compiler.constantRegister(1)
+	}
+	if k < 0 {
+		power := compiler.compileIntegerPower(base, -k)
+		return compiler.emit(instruction{op: op_DIV, a: compiler.constantRegister(1), b: power}, "")
+	}
+	result := -1
+	square := base
+	for k > 0 {
+		if k&1 == 1 {
+			if result < 0 {
+				result = square
+			} else {
+				result = compiler.emit(instruction{op: op_MUL, a: result, b: square}, "")
+			}
+		}
+		k >>= 1
+		if k > 0 {
+			square = compiler.emit(instruction{op: op_MUL, a: square, b: square}, "")
+		}
+	}
+	return result
+}
+
+// Compiles the syntax tree of an expression of the given number of variables.
+func compileExpression(root expressionNode, variables int) *complexProgram {
+	compiler := newExpressionCompiler(variables)
+	compiler.program.result = compiler.compile(root)
+	return compiler.program
+}
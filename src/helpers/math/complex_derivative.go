@@ -0,0 +1,268 @@
+package math
+
+import (
+	"fmt"
+)
+
+var (
+	// The derivatives of the holomorphic EXPRESSION_FUNCTIONS in terms of
+	// their argument z.
+	expressionFunctionDerivatives = map[string]func(z expressionNode) expressionNode{
+		"sin": func(z expressionNode) expressionNode { return callOf("cos", z) },
+		"cos": func(z expressionNode) expressionNode { return negated(callOf("sin", z)) },
+		"tan": func(z expressionNode) expressionNode {
+			return sumOf(numberOf(1), callOf("sqr", callOf("tan", z)))
+		},
+		"cot": func(z expressionNode) expressionNode {
+			return negated(sumOf(numberOf(1), callOf("sqr", callOf("cot", z))))
+		},
+		"sinh": func(z expressionNode) expressionNode { return callOf("cosh", z) },
+		"cosh": func(z expressionNode) expressionNode { return callOf("sinh", z) },
+		"tanh": func(z expressionNode) expressionNode {
+			return differenceOf(numberOf(1), callOf("sqr", callOf("tanh", z)))
+		},
+		"asin": func(z expressionNode) expressionNode {
+			return quotientOf(numberOf(1), callOf("sqrt", differenceOf(numberOf(1), callOf("sqr", z))))
+		},
+		"acos": func(z expressionNode) expressionNode {
+			return negated(quotientOf(numberOf(1), callOf("sqrt", differenceOf(numberOf(1), callOf("sqr", z)))))
+		},
+		"atan": func(z expressionNode) expressionNode {
+			return quotientOf(numberOf(1), sumOf(numberOf(1), callOf("sqr", z)))
+		},
+		"asinh": func(z expressionNode) expressionNode {
+			return quotientOf(numberOf(1), callOf("sqrt", sumOf(callOf("sqr", z), numberOf(1))))
+		},
+		"acosh": func(z expressionNode) expressionNode {
+			root := productOf(callOf("sqrt", differenceOf(z, numberOf(1))), callOf("sqrt", sumOf(z, numberOf(1))))
+			return quotientOf(numberOf(1), root)
+		},
+		"atanh": func(z expressionNode) expressionNode {
+			return quotientOf(numberOf(1), differenceOf(numberOf(1), callOf("sqr", z)))
+		},
+		"exp":  func(z expressionNode) expressionNode { return callOf("exp", z) },
+		"log":  func(z expressionNode) expressionNode { return quotientOf(numberOf(1), z) },
+		"sqrt": func(z expressionNode) expressionNode { return quotientOf(numberOf(0.5), callOf("sqrt", z)) },
+		"sqr":  func(z expressionNode) expressionNode { return productOf(numberOf(2), z) },
+	}
+)
+
+// Computes the derivative of the expression with respect to one of its
+// variables by symbolic differentiation, so it's exact and compiles like any
+// other expression. Functions that aren't holomorphic, such as conj and abs,
+// have no complex derivative.
+func (expression *ComplexExpression) Derivative(variable string) (*ComplexExpression, error) {
+	index := -1
+	for i, name := range expression.Variables {
+		if name == variable {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("Unknown variable %q", variable)
+	}
+	root, err := newDifferentiator(index).differentiate(expression.root)
+	if err != nil {
+		return nil, err
+	}
+	variables := len(expression.Variables)
+	return &ComplexExpression{Variables: expression.Variables, program: compileExpression(root, variables), root: root}, nil
+}
+
+// Differentiates syntax trees with respect to the variable at an index.
+// Derivatives share the subtrees of their expressions, so the trees of higher
+// derivatives are graphs whose nodes are reached by many paths, and the
+// results are kept for each node to visit every node once.
+type differentiator struct {
+	index       int
+	derivatives map[expressionNode]expressionNode
+	dependent   map[expressionNode]bool
+}
+
+func newDifferentiator(index int) *differentiator {
+	return &differentiator{
+		index:       index,
+		derivatives: map[expressionNode]expressionNode{},
+		dependent:   map[expressionNode]bool{},
+	}
+}
+
+// Builds the syntax tree of the derivative of a node.
+func (d *differentiator) differentiate(node expressionNode) (expressionNode, error) {
+	if derivative, found := d.derivatives[node]; found {
+		return derivative, nil
+	}
+	derivative, err := d.differentiateNode(node)
+	if err != nil {
+		return nil, err
+	}
+	d.derivatives[node] = derivative
+	return derivative, nil
+}
+
+func (d *differentiator) differentiateNode(node expressionNode) (expressionNode, error) {
+	if !d.dependsOn(node) {
+		return numberOf(0), nil
+	}
+	switch node := node.(type) {
+	case *variableNode:
+		return numberOf(1), nil
+	case *negationNode:
+		operand, err := d.differentiate(node.operand)
+		if err != nil {
+			return nil, err
+		}
+		return negated(operand), nil
+	case *binaryNode:
+		if node.operator == '^' {
+			return d.differentiatePower(node.left, node.right)
+		}
+		left, err := d.differentiate(node.left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := d.differentiate(node.right)
+		if err != nil {
+			return nil, err
+		}
+		switch node.operator {
+		case '+':
+			return sumOf(left, right), nil
+		case '-':
+			return differenceOf(left, right), nil
+		case '*':
+			return sumOf(productOf(left, node.right), productOf(node.left, right)), nil
+		}
+		// (f/g)' = (f'g - fg')/g^2
+		numerator := differenceOf(productOf(left, node.right), productOf(node.left, right))
+		return quotientOf(numerator, callOf("sqr", node.right)), nil
+	case *callNode:
+		derivative, found := expressionFunctionDerivatives[node.name]
+		if !found {
+			return nil, fmt.Errorf("%s isn't differentiable", node.name)
+		}
+		argument, err := d.differentiate(node.argument)
+		if err != nil {
+			return nil, err
+		}
+		return productOf(derivative(node.argument), argument), nil
+	case *binaryCallNode:
+		if node.name == "pow" {
+			return d.differentiatePower(node.left, node.right)
+		}
+		return nil, fmt.Errorf("%s isn't differentiable", node.name)
+	}
+	return nil, fmt.Errorf("Unknown expression node %T", node)
+}
+
+// Builds the derivative of base^exponent, which is k * base^(k - 1) * base'
+// for exponents k that don't depend on the variable, and
+// base^exponent * (exponent' * log(base) + exponent * base'/base) otherwise.
+func (d *differentiator) differentiatePower(base, exponent expressionNode) (expressionNode, error) {
+	baseDerivative, err := d.differentiate(base)
+	if err != nil {
+		return nil, err
+	}
+	if !d.dependsOn(exponent) {
+		power := &binaryNode{operator: '^', left: base, right: differenceOf(exponent, numberOf(1))}
+		return productOf(productOf(exponent, power), baseDerivative), nil
+	}
+	exponentDerivative, err := d.differentiate(exponent)
+	if err != nil {
+		return nil, err
+	}
+	power := &binaryNode{operator: '^', left: base, right: exponent}
+	rate := sumOf(productOf(exponentDerivative, callOf("log", base)), quotientOf(productOf(exponent, baseDerivative), base))
+	return productOf(power, rate), nil
+}
+
+// Checks if the value of a node depends on the variable.
+func (d *differentiator) dependsOn(node expressionNode) bool {
+	if dependent, found := d.dependent[node]; found {
+		return dependent
+	}
+	dependent := false
+	switch node := node.(type) {
+	case *variableNode:
+		dependent = node.index == d.index
+	case *negationNode:
+		dependent = d.dependsOn(node.operand)
+	case *binaryNode:
+		dependent = d.dependsOn(node.left) || d.dependsOn(node.right)
+	case *callNode:
+		dependent = d.dependsOn(node.argument)
+	case *binaryCallNode:
+		dependent = d.dependsOn(node.left) || d.dependsOn(node.right)
+	}
+	d.dependent[node] = dependent
+	return dependent
+}
+
+// Checks if a node is the given number.
+func isNumber(node expressionNode, value complex128) bool {
+	number, ok := node.(*numberNode)
+	return ok && number.value == value
+}
+
+// The constructors of the nodes of derivatives drop the terms and factors
+// that products with 0 and 1 make redundant, which keeps derivatives small.
+func numberOf(value complex128) expressionNode {
+	return &numberNode{value: value}
+}
+
+func negated(node expressionNode) expressionNode {
+	if isNumber(node, 0) {
+		return node
+	}
+	if negation, ok := node.(*negationNode); ok {
+		return negation.operand
+	}
+	return &negationNode{operand: node}
+}
+
+func sumOf(a, b expressionNode) expressionNode {
+	if isNumber(a, 0) {
+		return b
+	}
+	if isNumber(b, 0) {
+		return a
+	}
+	return &binaryNode{operator: '+', left: a, right: b}
+}
+
+func differenceOf(a, b expressionNode) expressionNode {
+	if isNumber(b, 0) {
+		return a
+	}
+	if isNumber(a, 0) {
+		return negated(b)
+	}
+	return &binaryNode{operator: '-', left: a, right: b}
+}
+
+func productOf(a, b expressionNode) expressionNode {
+	if isNumber(a, 0) || isNumber(b, 0) {
+		return numberOf(0)
+	}
+	if isNumber(a, 1) {
+		return b
+	}
+	if isNumber(b, 1) {
+		return a
+	}
+	return &binaryNode{operator: '*', left: a, right: b}
+}
+
+func quotientOf(a, b expressionNode) expressionNode {
+	if isNumber(a, 0) {
+		return a
+	}
+	if isNumber(b, 1) {
+		return a
+	}
+	return &binaryNode{operator: '/', left: a, right: b}
+}
+
+func callOf(name string, argument expressionNode) expressionNode {
+	return &callNode{name: name, function: EXPRESSION_FUNCTIONS[name], argument: argument}
+}
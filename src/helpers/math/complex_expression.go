@@ -0,0 +1,569 @@
+package math
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strconv"
+	"unicode"
+)
+
+const (
+	token_NUMBER     = 0
+	token_IMAGINARY  = 1
+	token_IDENTIFIER = 2
+	token_OPERATOR   = 3
+	token_END        = 4
+)
+
+var (
+	// The constants that can be used in expressions.
+	EXPRESSION_CONSTANTS = map[string]complex128{
+		"i":  1i,
+		"pi": math.Pi,
+		"e":  math.E,
+	}
+	// The functions of one argument that can be used in expressions. abs
+	// takes the absolute values of the parts of its argument, while cabs is
+	// the modulus.
+	EXPRESSION_FUNCTIONS = map[string]func(complex128) complex128{
+		"sin":   cmplx.Sin,
+		"cos":   cmplx.Cos,
+		"tan":   cmplx.Tan,
+		"cot":   cmplx.Cot,
+		"sinh":  cmplx.Sinh,
+		"cosh":  cmplx.Cosh,
+		"tanh":  cmplx.Tanh,
+		"asin":  cmplx.Asin,
+		"acos":  cmplx.Acos,
+		"atan":  cmplx.Atan,
+		"asinh": cmplx.Asinh,
+		"acosh": cmplx.Acosh,
+		"atanh": cmplx.Atanh,
+		"exp":   cmplx.Exp,
+		"log":   cmplx.Log,
+		"sqrt":  cmplx.Sqrt,
+		"conj":  cmplx.Conj,
+		"sqr":   func(z complex128) complex128 { return z * z },
+		"abs":   func(z complex128) complex128 { return complex(math.Abs(real(z)), math.Abs(imag(z))) },
+		"cabs":  func(z complex128) complex128 { return complex(cmplx.Abs(z), 0) },
+		"real":  func(z complex128) complex128 { return complex(real(z), 0) },
+		"imag":  func(z complex128) complex128 { return complex(imag(z), 0) },
+		"arg":   func(z complex128) complex128 { return complex(cmplx.Phase(z), 0) },
+		"flip":  func(z complex128) complex128 { return complex(imag(z), real(z)) },
+	}
+	// The functions of two arguments that can be used in expressions.
+	EXPRESSION_BINARY_FUNCTIONS = map[string]func(complex128, complex128) complex128{
+		"pow": cmplx.Pow,
+	}
+	// The syntax of the expressions of ParseComplexExpression.
+	DEFAULT_EXPRESSION_SYNTAX = ExpressionSyntax{
+		Constants:       EXPRESSION_CONSTANTS,
+		Functions:       EXPRESSION_FUNCTIONS,
+		BinaryFunctions: EXPRESSION_BINARY_FUNCTIONS,
+	}
+	// The comparisons and logical operators of expressions with conditions.
+	// Comparisons other than == and != compare the real parts of their
+	// operands.
+	conditionOperators = map[string]func(complex128, complex128) complex128{
+		"<":  func(a, b complex128) complex128 { return truth(real(a) < real(b)) },
+		"<=": func(a, b complex128) complex128 { return truth(real(a) <= real(b)) },
+		">":  func(a, b complex128) complex128 { return truth(real(a) > real(b)) },
+		">=": func(a, b complex128) complex128 { return truth(real(a) >= real(b)) },
+		"==": func(a, b complex128) complex128 { return truth(a == b) },
+		"!=": func(a, b complex128) complex128 { return truth(a != b) },
+		"&&": func(a, b complex128) complex128 { return truth(a != 0 && b != 0) },
+		"||": func(a, b complex128) complex128 { return truth(a != 0 || b != 0) },
+	}
+)
+
+// The names and notations that expressions can use.
+type ExpressionSyntax struct {
+	Constants       map[string]complex128
+	Functions       map[string]func(complex128) complex128
+	BinaryFunctions map[string]func(complex128, complex128) complex128
+	// Allows the comparisons <, <=, >, >=, == and !=, and the logical
+	// operators && and ||, whose values are 1 when they hold and 0 otherwise.
+	Conditions bool
+	// Allows the notations of Fractint formulas: |x| for the squared modulus
+	// of x, and (x, y) for x + yi.
+	FractintNotation bool
+}
+
+// Converts a condition to the value of expressions.
+func truth(condition bool) complex128 {
+	if condition {
+		return 1
+	}
+	return 0
+}
+
+// Represents an error found at a position of an expression.
+type ExpressionError struct {
+	// The 1-based character position of the error in the expression.
+	Position int
+	Message  string
+}
+
+func (err *ExpressionError) Error() string {
+	return fmt.Sprintf("%s at position %d", err.Message, err.Position)
+}
+
+// Represents a complex-valued expression of some variables, such as
+// z^2 + c*sin(z), which is compiled to instructions on registers.
+// Expressions aren't safe for concurrent use.
+type ComplexExpression struct {
+	// The names of the variables, whose values are given to Evaluate in the
+	// same order.
+	Variables []string
+	program   *complexProgram
+	// The syntax tree, which derivatives are computed from.
+	root expressionNode
+}
+
+// Evaluates the expression for the given values of its variables.
+func (expression *ComplexExpression) Evaluate(values []complex128) complex128 {
+	return expression.program.Run(values)
+}
+
+// A node of the syntax tree of an expression.
+type expressionNode interface {
+	expressionNode()
+}
+
+type numberNode struct {
+	value complex128
+}
+
+// Refers to the variable at an index of the values.
+type variableNode struct {
+	index int
+}
+
+type negationNode struct {
+	operand expressionNode
+}
+
+type binaryNode struct {
+	operator rune
+	left     expressionNode
+	right    expressionNode
+}
+
+type callNode struct {
+	name     string
+	function func(complex128) complex128
+	argument expressionNode
+}
+
+type binaryCallNode struct {
+	name     string
+	function func(complex128, complex128) complex128
+	left     expressionNode
+	right    expressionNode
+}
+
+func (node *numberNode) expressionNode()     {}
+func (node *variableNode) expressionNode()   {}
+func (node *negationNode) expressionNode()   {}
+func (node *binaryNode) expressionNode()     {}
+func (node *callNode) expressionNode()       {}
+func (node *binaryCallNode) expressionNode() {}
+
+// A lexical token of an expression.
+type expressionToken struct {
+	kind  int
+	text  string
+	value float64
+	// The 1-based character position of the token.
+	position int
+}
+
+// Splits an expression of the given syntax into tokens.
+func tokenizeExpression(txt string, syntax ExpressionSyntax) ([]expressionToken, error) {
+	chars := []rune(txt)
+	var tokens []expressionToken
+	i := 0
+	for i < len(chars) {
+		start := i
+		switch {
+		case unicode.IsSpace(chars[i]):
+			i++
+			continue
+		case unicode.IsDigit(chars[i]) || chars[i] == '.':
+			for i < len(chars) && (unicode.IsDigit(chars[i]) || chars[i] == '.') {
+				i++
+			}
+			// an exponent such as e-3, which isn't followed by letters
+			if i < len(chars) && (chars[i] == 'e' || chars[i] == 'E') {
+				j := i + 1
+				if j < len(chars) && (chars[j] == '+' || chars[j] == '-') {
+					j++
+				}
+				if j < len(chars) && unicode.IsDigit(chars[j]) {
+					for j < len(chars) && unicode.IsDigit(chars[j]) {
+						j++
+					}
+					i = j
+				}
+			}
+			value, err := strconv.ParseFloat(string(chars[start:i]), 64)
+			if err != nil {
+				return nil, &ExpressionError{Position: start + 1, Message: fmt.Sprintf("Invalid number %q", string(chars[start:i]))}
+			}
+			kind := token_NUMBER
+			if i < len(chars) && chars[i] == 'i' && (i+1 == len(chars) || !isIdentifierRune(chars[i+1])) {
+				kind = token_IMAGINARY
+				i++
+			}
+			tokens = append(tokens, expressionToken{kind: kind, text: string(chars[start:i]), value: value, position: start + 1})
+		case unicode.IsLetter(chars[i]) || chars[i] == '_':
+			for i < len(chars) && isIdentifierRune(chars[i]) {
+				i++
+			}
+			tokens = append(tokens, expressionToken{kind: token_IDENTIFIER, text: string(chars[start:i]), position: start + 1})
+		case chars[i] == '+' || chars[i] == '-' || chars[i] == '*' || chars[i] == '/' || chars[i] == '^' || chars[i] == '(' || chars[i] == ')' || chars[i] == ',':
+			i++
+			tokens = append(tokens, expressionToken{kind: token_OPERATOR, text: string(chars[start]), position: start + 1})
+		case syntax.Conditions && i+1 < len(chars) && conditionOperators[string(chars[i:i+2])] != nil:
+			i += 2
+			tokens = append(tokens, expressionToken{kind: token_OPERATOR, text: string(chars[start:i]), position: start + 1})
+		case syntax.Conditions && (chars[i] == '<' || chars[i] == '>'):
+			i++
+			tokens = append(tokens, expressionToken{kind: token_OPERATOR, text: string(chars[start]), position: start + 1})
+		case syntax.FractintNotation && chars[i] == '|':
+			i++
+			tokens = append(tokens, expressionToken{kind: token_OPERATOR, text: "|", position: start + 1})
+		default:
+			return nil, &ExpressionError{Position: start + 1, Message: fmt.Sprintf("Unexpected character %q", chars[i])}
+		}
+	}
+	tokens = append(tokens, expressionToken{kind: token_END, position: len(chars) + 1})
+	return tokens, nil
+}
+
+func isIdentifierRune(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_'
+}
+
+// A recursive descent parser of expressions.
+type expressionParser struct {
+	tokens    []expressionToken
+	pos       int
+	variables map[string]int
+	syntax    ExpressionSyntax
+}
+
+func (parser *expressionParser) peek() expressionToken {
+	return parser.tokens[parser.pos]
+}
+
+func (parser *expressionParser) next() expressionToken {
+	token := parser.tokens[parser.pos]
+	if token.kind != token_END {
+		parser.pos++
+	}
+	return token
+}
+
+// Checks if the next token is the given operator and consumes it if it is.
+func (parser *expressionParser) accept(operator string) bool {
+	token := parser.peek()
+	if token.kind == token_OPERATOR && token.text == operator {
+		parser.pos++
+		return true
+	}
+	return false
+}
+
+func (parser *expressionParser) expect(operator string) error {
+	if !parser.accept(operator) {
+		return unexpectedToken(parser.peek(), fmt.Sprintf("Expected '%s'", operator))
+	}
+	return nil
+}
+
+// Creates an error for a token that can't appear where it is.
+func unexpectedToken(token expressionToken, message string) error {
+	if token.kind == token_END {
+		return &ExpressionError{Position: token.position, Message: message + " before the end of the expression"}
+	}
+	return &ExpressionError{Position: token.position, Message: fmt.Sprintf("%s, got %q", message, token.text)}
+}
+
+// disjunction := conjunction ('||' conjunction)*
+func (parser *expressionParser) parseDisjunction() (expressionNode, error) {
+	return parser.parseConditions([]string{"||"}, parser.parseConjunction)
+}
+
+// conjunction := comparison ('&&' comparison)*
+func (parser *expressionParser) parseConjunction() (expressionNode, error) {
+	return parser.parseConditions([]string{"&&"}, parser.parseComparison)
+}
+
+// comparison := sum (('<' | '<=' | '>' | '>=' | '==' | '!=') sum)*
+func (parser *expressionParser) parseComparison() (expressionNode, error) {
+	return parser.parseConditions([]string{"<", "<=", ">", ">=", "==", "!="}, parser.parseSum)
+}
+
+// Parses operands joined by the given left associative condition operators.
+func (parser *expressionParser) parseConditions(operators []string, parseOperand func() (expressionNode, error)) (expressionNode, error) {
+	left, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator := ""
+		for _, candidate := range operators {
+			if parser.accept(candidate) {
+				operator = candidate
+				break
+			}
+		}
+		if operator == "" {
+			return left, nil
+		}
+		right, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryCallNode{name: operator, function: conditionOperators[operator], left: left, right: right}
+	}
+}
+
+// sum := product (('+' | '-') product)*
+func (parser *expressionParser) parseSum() (expressionNode, error) {
+	left, err := parser.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var operator rune
+		switch {
+		case parser.accept("+"):
+			operator = '+'
+		case parser.accept("-"):
+			operator = '-'
+		default:
+			return left, nil
+		}
+		right, err := parser.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: operator, left: left, right: right}
+	}
+}
+
+// product := unary (('*' | '/')? unary)*, where a missing operator is a
+// multiplication, as in 2z or 3(z + 1).
+func (parser *expressionParser) parseProduct() (expressionNode, error) {
+	left, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator := '*'
+		token := parser.peek()
+		switch {
+		case parser.accept("*"):
+		case parser.accept("/"):
+			operator = '/'
+		case token.kind == token_NUMBER || token.kind == token_IMAGINARY || token.kind == token_IDENTIFIER || (token.kind == token_OPERATOR && token.text == "("):
+		default:
+			return left, nil
+		}
+		right, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{operator: operator, left: left, right: right}
+	}
+}
+
+// unary := ('-' | '+') unary | power
+func (parser *expressionParser) parseUnary() (expressionNode, error) {
+	if parser.accept("-") {
+		operand, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negationNode{operand: operand}, nil
+	}
+	if parser.accept("+") {
+		return parser.parseUnary()
+	}
+	return parser.parsePower()
+}
+
+// power := primary ('^' unary)?, so powers are right associative and z^-2 is
+// z^(-2).
+func (parser *expressionParser) parsePower() (expressionNode, error) {
+	base, err := parser.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if !parser.accept("^") {
+		return base, nil
+	}
+	exponent, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryNode{operator: '^', left: base, right: exponent}, nil
+}
+
+// primary := number | identifier | function '(' disjunction (',' disjunction)? ')' |
+// '(' disjunction (',' disjunction)? ')' | '|' disjunction '|'
+func (parser *expressionParser) parsePrimary() (expressionNode, error) {
+	token := parser.next()
+	switch token.kind {
+	case token_NUMBER:
+		return &numberNode{value: complex(token.value, 0)}, nil
+	case token_IMAGINARY:
+		return &numberNode{value: complex(0, token.value)}, nil
+	case token_IDENTIFIER:
+		if index, found := parser.variables[token.text]; found {
+			return &variableNode{index: index}, nil
+		}
+		if value, found := parser.syntax.Constants[token.text]; found {
+			return &numberNode{value: value}, nil
+		}
+		if function, found := parser.syntax.Functions[token.text]; found {
+			arguments, err := parser.parseArguments(token, 1)
+			if err != nil {
+				return nil, err
+			}
+			return &callNode{name: token.text, function: function, argument: arguments[0]}, nil
+		}
+		if function, found := parser.syntax.BinaryFunctions[token.text]; found {
+			arguments, err := parser.parseArguments(token, 2)
+			if err != nil {
+				return nil, err
+			}
+			return &binaryCallNode{name: token.text, function: function, left: arguments[0], right: arguments[1]}, nil
+		}
+		return nil, &ExpressionError{Position: token.position, Message: fmt.Sprintf("Unknown variable %q", token.text)}
+	case token_OPERATOR:
+		if token.text == "(" {
+			node, err := parser.parseDisjunction()
+			if err != nil {
+				return nil, err
+			}
+			if parser.syntax.FractintNotation && parser.accept(",") {
+				// a complex number (x, y)
+				imaginary, err := parser.parseDisjunction()
+				if err != nil {
+					return nil, err
+				}
+				node = &binaryNode{
+					operator: '+',
+					left:     node,
+					right:    &binaryNode{operator: '*', left: imaginary, right: &numberNode{value: 1i}},
+				}
+			}
+			err = parser.expect(")")
+			if err != nil {
+				return nil, err
+			}
+			return node, nil
+		}
+		if token.text == "|" {
+			node, err := parser.parseDisjunction()
+			if err != nil {
+				return nil, err
+			}
+			err = parser.expect("|")
+			if err != nil {
+				return nil, err
+			}
+			return &callNode{name: "|", function: squaredModulus, argument: node}, nil
+		}
+	}
+	return nil, unexpectedToken(token, "Expected a value")
+}
+
+// Parses the parenthesized arguments of a call to a function.
+func (parser *expressionParser) parseArguments(function expressionToken, count int) ([]expressionNode, error) {
+	err := parser.expect("(")
+	if err != nil {
+		return nil, err
+	}
+	arguments := make([]expressionNode, count)
+	for i := range arguments {
+		if i > 0 {
+			err = parser.expect(",")
+			if err != nil {
+				return nil, err
+			}
+		}
+		arguments[i], err = parser.parseDisjunction()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !parser.accept(")") {
+		return nil, &ExpressionError{
+			Position: parser.peek().position,
+			Message:  fmt.Sprintf("%s takes %d argument(s)", function.text, count),
+		}
+	}
+	return arguments, nil
+}
+
+// Checks if a name is a constant or function of expressions.
+func IsReservedExpressionName(name string) bool {
+	_, isConstant := EXPRESSION_CONSTANTS[name]
+	_, isFunction := EXPRESSION_FUNCTIONS[name]
+	_, isBinaryFunction := EXPRESSION_BINARY_FUNCTIONS[name]
+	return isConstant || isFunction || isBinaryFunction
+}
+
+// Computes |z|^2 for the |z| of Fractint formulas.
+func squaredModulus(z complex128) complex128 {
+	return complex(real(z)*real(z)+imag(z)*imag(z), 0)
+}
+
+// Creates a parser of an expression of the given variables and syntax.
+func newExpressionParser(txt string, variables []string, syntax ExpressionSyntax) (*expressionParser, error) {
+	tokens, err := tokenizeExpression(txt, syntax)
+	if err != nil {
+		return nil, err
+	}
+	parser := expressionParser{tokens: tokens, variables: make(map[string]int, len(variables)), syntax: syntax}
+	for i, name := range variables {
+		parser.variables[name] = i
+	}
+	if parser.peek().kind == token_END {
+		return nil, &ExpressionError{Position: 1, Message: "Empty expression"}
+	}
+	return &parser, nil
+}
+
+// Parses the whole expression and returns its syntax tree.
+func (parser *expressionParser) parse() (expressionNode, error) {
+	root, err := parser.parseDisjunction()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != token_END {
+		return nil, unexpectedToken(token, "Expected an operator")
+	}
+	return root, nil
+}
+
+// Constructs a ComplexExpression from a mathematical expression of the given
+// variables and compiles it. Expressions support the operators +, -, *, /
+// and ^, implicit multiplication, imaginary numbers such as 2.5i, and the
+// EXPRESSION_CONSTANTS and EXPRESSION_FUNCTIONS.
+func ParseComplexExpression(txt string, variables []string) (*ComplexExpression, error) {
+	parser, err := newExpressionParser(txt, variables, DEFAULT_EXPRESSION_SYNTAX)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parser.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &ComplexExpression{Variables: variables, program: compileExpression(root, len(variables)), root: root}, nil
+}
@@ -2,219 +2,438 @@ package math
 
 import (
 	"errors"
-	"math/cmplx"
+	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
-	"unicode"
+	"unicode/utf8"
 )
 
 const (
-	state_GET_COEFFICIENT  = 0
-	state_GET_POWER        = 1
-	state_READ_COEFFICIENT = 2
-	state_READ_VARIABLE    = 3
-	state_READ_POWER       = 4
-
-	term_num_sign      = 0
-	term_pos_num_start = 1
-	term_pos_num_end   = 2
-	term_pos_variable  = 3
-	term_pow_sign      = 4
-	term_pos_pow_start = 5
-	term_pos_pow_end   = 6
+	// The largest power of the terms of polynomials, which keeps expansions
+	// such as (z + 1)^n small.
+	MAX_POLYNOMIAL_DEGREE = 1024
+	// The variable of polynomials that don't have one.
+	DEFAULT_POLYNOMIAL_VARIABLE = 'z'
 )
 
 var (
 	NIL_CMPLX_POLYNOMIAL = CmplxPolynomial{}
+	// The syntax of polynomials, in which i is the imaginary unit.
+	POLYNOMIAL_SYNTAX = ExpressionSyntax{
+		Constants: map[string]complex128{"i": 1i},
+	}
 )
 
 // Represents a term of a complex polynomial.
 type PolynomialTerm struct {
-	Coefficient float64
+	Coefficient complex128
 	Power       int
 }
 
-// Represents a complex polynomial
+// Represents a complex polynomial, whose terms may have negative powers.
+// The polynomials created by this package have at most one term of each
+// power, no zero coefficients, and terms sorted by decreasing power.
+// Polynomials aren't safe for concurrent use.
 type CmplxPolynomial struct {
 	Terms    []PolynomialTerm
 	Variable rune
+	// The compiled terms, which Evaluate creates on its first call. Copies of
+	// the polynomial share them.
+	compiled *polynomialProgram
 }
 
-// Computes the first derivative of a complex polynomial.
-func (polynomial *CmplxPolynomial) FirstDerivative() CmplxPolynomial {
-	n := len(polynomial.Terms)
+// Holds the program of a polynomial once it's compiled.
+type polynomialProgram struct {
+	program *complexProgram
+}
+
+// Creates a polynomial from its terms, which are added together and sorted
+// by decreasing power.
+func NewCmplxPolynomial(terms []PolynomialTerm, variable rune) CmplxPolynomial {
+	coefficients := map[int]complex128{}
+	for _, term := range terms {
+		coefficients[term.Power] += term.Coefficient
+	}
+	return newCmplxPolynomialFromCoefficients(coefficients, variable)
+}
+
+// Creates the monic polynomial (z - r1)(z - r2)...(z - rn) of the given
+// roots.
+func NewCmplxPolynomialFromRoots(roots []complex128, variable rune) CmplxPolynomial {
+	polynomial := NewCmplxPolynomial([]PolynomialTerm{{Coefficient: 1, Power: 0}}, variable)
+	for _, root := range roots {
+		factor := NewCmplxPolynomial([]PolynomialTerm{{Coefficient: 1, Power: 1}, {Coefficient: -root, Power: 0}}, variable)
+		polynomial = polynomial.Multiply(factor)
+	}
+	return polynomial
+}
+
+// Sorts the powers of a map of coefficients and drops the zero ones.
+func newCmplxPolynomialFromCoefficients(coefficients map[int]complex128, variable rune) CmplxPolynomial {
+	terms := make([]PolynomialTerm, 0, len(coefficients))
+	for power, coefficient := range coefficients {
+		if coefficient != 0 {
+			terms = append(terms, PolynomialTerm{Coefficient: coefficient, Power: power})
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool { return terms[i].Power > terms[j].Power })
+	return CmplxPolynomial{Terms: terms, Variable: variable, compiled: &polynomialProgram{}}
+}
+
+// Returns the variable of the result of an operation on two polynomials,
+// which is the variable of the first one unless it doesn't have one.
+func (polynomial CmplxPolynomial) resultVariable(other CmplxPolynomial) rune {
+	if polynomial.Variable == ' ' || polynomial.Variable == 0 {
+		return other.Variable
+	}
+	return polynomial.Variable
+}
+
+// Returns the largest power of the terms of the polynomial, which is 0 for
+// the zero polynomial.
+func (polynomial CmplxPolynomial) Degree() int {
+	degree := 0
+	for i, term := range polynomial.Terms {
+		if i == 0 || term.Power > degree {
+			degree = term.Power
+		}
+	}
+	return degree
+}
+
+// Returns the coefficient of the term of a given power.
+func (polynomial CmplxPolynomial) Coefficient(power int) complex128 {
+	var coefficient complex128
+	for _, term := range polynomial.Terms {
+		if term.Power == power {
+			coefficient += term.Coefficient
+		}
+	}
+	return coefficient
+}
+
+// Checks if the polynomial has a term with a negative power.
+func (polynomial CmplxPolynomial) HasNegativePowers() bool {
+	for _, term := range polynomial.Terms {
+		if term.Power < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Computes the sum of two polynomials.
+func (polynomial CmplxPolynomial) Add(other CmplxPolynomial) CmplxPolynomial {
+	terms := append(append([]PolynomialTerm(nil), polynomial.Terms...), other.Terms...)
+	return NewCmplxPolynomial(terms, polynomial.resultVariable(other))
+}
+
+// Computes the difference of two polynomials.
+func (polynomial CmplxPolynomial) Subtract(other CmplxPolynomial) CmplxPolynomial {
+	return polynomial.Add(other.Scale(-1))
+}
+
+// Multiplies the coefficients of the polynomial by a number.
+func (polynomial CmplxPolynomial) Scale(factor complex128) CmplxPolynomial {
+	terms := make([]PolynomialTerm, len(polynomial.Terms))
+	for i, term := range polynomial.Terms {
+		terms[i] = PolynomialTerm{Coefficient: term.Coefficient * factor, Power: term.Power}
+	}
+	return NewCmplxPolynomial(terms, polynomial.Variable)
+}
+
+// Computes the product of two polynomials.
+func (polynomial CmplxPolynomial) Multiply(other CmplxPolynomial) CmplxPolynomial {
+	coefficients := map[int]complex128{}
+	for _, a := range polynomial.Terms {
+		for _, b := range other.Terms {
+			coefficients[a.Power+b.Power] += a.Coefficient * b.Coefficient
+		}
+	}
+	return newCmplxPolynomialFromCoefficients(coefficients, polynomial.resultVariable(other))
+}
+
+// Raises the polynomial to an integer power. Negative powers are only
+// supported by polynomials of a single term.
+func (polynomial CmplxPolynomial) Power(n int) (CmplxPolynomial, error) {
+	if n < 0 {
+		if len(polynomial.Terms) != 1 {
+			return NIL_CMPLX_POLYNOMIAL, errors.New("Negative powers are only supported by single terms")
+		}
+		term := polynomial.Terms[0]
+		return polynomial.singleTermPower(term.Coefficient, term.Power, n)
+	}
+	if len(polynomial.Terms) == 1 {
+		term := polynomial.Terms[0]
+		return polynomial.singleTermPower(term.Coefficient, term.Power, n)
+	}
 	for _, term := range polynomial.Terms {
-		if term.Power == 0 {
-			n--
+		if n*term.Power > MAX_POLYNOMIAL_DEGREE || -n*term.Power > MAX_POLYNOMIAL_DEGREE {
+			return NIL_CMPLX_POLYNOMIAL, fmt.Errorf("Polynomials can't have powers greater than %d", MAX_POLYNOMIAL_DEGREE)
+		}
+	}
+	// square-and-multiply
+	result := NewCmplxPolynomial([]PolynomialTerm{{Coefficient: 1, Power: 0}}, polynomial.Variable)
+	base := polynomial
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			result = result.Multiply(base)
 		}
+		if n > 1 {
+			base = base.Multiply(base)
+		}
+	}
+	return result, nil
+}
+
+// Raises a single term to an integer power.
+func (polynomial CmplxPolynomial) singleTermPower(coefficient complex128, power, n int) (CmplxPolynomial, error) {
+	if power*n > MAX_POLYNOMIAL_DEGREE || -power*n > MAX_POLYNOMIAL_DEGREE {
+		return NIL_CMPLX_POLYNOMIAL, fmt.Errorf("Polynomials can't have powers greater than %d", MAX_POLYNOMIAL_DEGREE)
 	}
-	derivTerms := make([]PolynomialTerm, n)
-	i := 0
+	term := PolynomialTerm{Coefficient: powInt(coefficient, n), Power: power * n}
+	return NewCmplxPolynomial([]PolynomialTerm{term}, polynomial.Variable), nil
+}
+
+// Computes the composition p(q(z)) of the polynomial p with a polynomial q.
+// Negative powers of p are only supported when q has a single term.
+func (polynomial CmplxPolynomial) Compose(inner CmplxPolynomial) (CmplxPolynomial, error) {
+	result := NewCmplxPolynomial(nil, inner.Variable)
+	for _, term := range polynomial.Terms {
+		power, err := inner.Power(term.Power)
+		if err != nil {
+			return NIL_CMPLX_POLYNOMIAL, err
+		}
+		result = result.Add(power.Scale(term.Coefficient))
+	}
+	return result, nil
+}
+
+// Computes the first derivative of a complex polynomial.
+func (polynomial CmplxPolynomial) FirstDerivative() CmplxPolynomial {
+	derivTerms := make([]PolynomialTerm, 0, len(polynomial.Terms))
 	for _, term := range polynomial.Terms {
 		if term.Power != 0 {
-			derivTerms[i] = PolynomialTerm{
-				Coefficient: term.Coefficient * float64(term.Power),
+			derivTerms = append(derivTerms, PolynomialTerm{
+				Coefficient: term.Coefficient * complex(float64(term.Power), 0),
 				Power:       term.Power - 1,
-			}
-			i++
+			})
 		}
 	}
-	return CmplxPolynomial{Terms: derivTerms, Variable: polynomial.Variable}
+	return NewCmplxPolynomial(derivTerms, polynomial.Variable)
 }
 
 // Evaluates the value of a complex polynomial for a given z.
-func (polynomial *CmplxPolynomial) Evaluate(z complex128) complex128 {
-	value := 0.0 + 0i
-	for i := 0; i < len(polynomial.Terms); i++ {
-		a := complex(polynomial.Terms[i].Coefficient, 0)
-		if polynomial.Terms[i].Power == 0 {
-			value += a
-		} else {
-			m := complex(float64(polynomial.Terms[i].Power), 0)
-			value += a * cmplx.Pow(z, m)
+func (polynomial CmplxPolynomial) Evaluate(z complex128) complex128 {
+	compiled := polynomial.compiled
+	if compiled == nil {
+		// polynomials that weren't created by this package can't keep their
+		// program
+		compiled = &polynomialProgram{}
+	}
+	if compiled.program == nil {
+		compiled.program = polynomial.compile()
+	}
+	return compiled.program.Run([]complex128{z})
+}
+
+// Compiles the terms of the polynomial with Horner's scheme, which raises z
+// to the gaps between the powers of the terms by squaring, however large they
+// are.
+func (polynomial CmplxPolynomial) compile() *complexProgram {
+	compiler := newExpressionCompiler(1)
+	if len(polynomial.Terms) == 0 {
+		compiler.program.result = compiler.constantRegister(0)
+		return compiler.program
+	}
+	// the register of z is 0
+	multiplyByPower := func(value, k int) int {
+		if k == 0 {
+			return value
+		}
+		return compiler.emit(instruction{op: op_MUL, a: value, b: compiler.compileIntegerPower(0, k)}, "")
+	}
+	value := compiler.constantRegister(polynomial.Terms[0].Coefficient)
+	previous := polynomial.Terms[0].Power
+	for _, term := range polynomial.Terms[1:] {
+		value = multiplyByPower(value, previous-term.Power)
+		value = compiler.emit(instruction{op: op_ADD, a: value, b: compiler.constantRegister(term.Coefficient)}, "")
+		previous = term.Power
+	}
+	compiler.program.result = multiplyByPower(value, previous)
+	return compiler.program
+}
+
+// Raises z to an integer power by squaring.
+func powInt(z complex128, n int) complex128 {
+	switch n {
+	case 0:
+		return 1
+	case 1:
+		return z
+	case 2:
+		return z * z
+	}
+	if n < 0 {
+		return 1 / powInt(z, -n)
+	}
+	result := complex128(1)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			result *= z
 		}
+		z *= z
 	}
-	return value
+	return result
 }
 
-// Converts a CmplxPolynomial type to its string representation.
-func (polynomial *CmplxPolynomial) ToString() string {
+// Converts a CmplxPolynomial type to its string representation, which
+// ParseCmplxPolynomial parses back to the same polynomial.
+func (polynomial CmplxPolynomial) ToString() string {
+	if len(polynomial.Terms) == 0 {
+		return "0"
+	}
+	variable := polynomial.Variable
+	if variable == ' ' || variable == 0 {
+		variable = DEFAULT_POLYNOMIAL_VARIABLE
+	}
 	var sb strings.Builder
 	for i, term := range polynomial.Terms {
-		if i > 0 && term.Coefficient > 0 {
+		coefficient := term.Coefficient
+		// the sign is written before the coefficient, whose parts are then
+		// made positive where possible
+		if real(coefficient) < 0 || (real(coefficient) == 0 && imag(coefficient) < 0) {
+			sb.WriteRune('-')
+			coefficient = -coefficient
+		} else if i > 0 {
 			sb.WriteRune('+')
 		}
-		sb.WriteString(strconv.FormatFloat(term.Coefficient, byte('f'), 4, 64))
+		switch {
+		case imag(coefficient) == 0:
+			if real(coefficient) != 1 || term.Power == 0 {
+				sb.WriteString(strconv.FormatFloat(real(coefficient), 'g', -1, 64))
+				if term.Power != 0 && (variable == 'e' || variable == 'E') {
+					// 2e+3 would be read as a number
+					sb.WriteRune('*')
+				}
+			}
+		case real(coefficient) == 0:
+			if imag(coefficient) != 1 {
+				sb.WriteString(strconv.FormatFloat(imag(coefficient), 'g', -1, 64))
+			}
+			sb.WriteRune('i')
+			if term.Power != 0 {
+				sb.WriteRune('*')
+			}
+		default:
+			sb.WriteString(strconv.FormatComplex(coefficient, 'g', -1, 128))
+		}
 		if term.Power != 0 {
-			sb.WriteRune(polynomial.Variable)
+			sb.WriteRune(variable)
 			if term.Power != 1 {
 				sb.WriteRune('^')
-				sb.WriteString(strconv.FormatInt(int64(term.Power), 32))
+				sb.WriteString(strconv.Itoa(term.Power))
 			}
 		}
 	}
 	return sb.String()
 }
 
-// Adds a term of a polynomial to the slice of polynomial terms.
-func add_term(terms *[]PolynomialTerm, txt *[]rune, termInfo *[]int) error {
-	var err error = nil
-	coefficient := 1.0
-	power := 0
-
-	if (*termInfo)[term_pos_num_start] < 0 {
-		coefficient = 1
-	} else {
-		fltTxt := string((*txt)[(*termInfo)[term_pos_num_start]:(*termInfo)[term_pos_num_end]])
-		coefficient, err = strconv.ParseFloat(fltTxt, 32)
+// Converts a syntax tree of a polynomial to a CmplxPolynomial.
+func polynomialFromNode(node expressionNode, variable rune) (CmplxPolynomial, error) {
+	constant := func(value complex128) CmplxPolynomial {
+		return NewCmplxPolynomial([]PolynomialTerm{{Coefficient: value, Power: 0}}, variable)
+	}
+	switch node := node.(type) {
+	case *numberNode:
+		return constant(node.value), nil
+	case *variableNode:
+		return NewCmplxPolynomial([]PolynomialTerm{{Coefficient: 1, Power: 1}}, variable), nil
+	case *negationNode:
+		operand, err := polynomialFromNode(node.operand, variable)
 		if err != nil {
-			return err
+			return NIL_CMPLX_POLYNOMIAL, err
 		}
-		coefficient *= float64((*termInfo)[term_num_sign])
-	}
-	if (*termInfo)[term_pos_variable] < 0 {
-		power = 0
-	} else if (*termInfo)[term_pos_pow_start] < 0 {
-		power = 1
-	} else if (*termInfo)[term_pos_pow_start] > 0 {
-		intTxt := string((*txt)[(*termInfo)[term_pos_pow_start]:(*termInfo)[term_pos_pow_end]])
-		power, err = strconv.Atoi(intTxt)
+		return operand.Scale(-1), nil
+	case *binaryNode:
+		left, err := polynomialFromNode(node.left, variable)
 		if err != nil {
-			return err
+			return NIL_CMPLX_POLYNOMIAL, err
+		}
+		right, err := polynomialFromNode(node.right, variable)
+		if err != nil {
+			return NIL_CMPLX_POLYNOMIAL, err
+		}
+		switch node.operator {
+		case '+':
+			return left.Add(right), nil
+		case '-':
+			return left.Subtract(right), nil
+		case '*':
+			return left.Multiply(right), nil
+		case '/':
+			if len(right.Terms) != 1 {
+				return NIL_CMPLX_POLYNOMIAL, errors.New("Polynomials can only be divided by a single term")
+			}
+			reciprocal, err := right.Power(-1)
+			if err != nil {
+				return NIL_CMPLX_POLYNOMIAL, err
+			}
+			return left.Multiply(reciprocal), nil
+		case '^':
+			exponent := right.Coefficient(0)
+			if len(right.Terms) > 1 || right.Degree() != 0 || imag(exponent) != 0 || real(exponent) != math.Trunc(real(exponent)) {
+				return NIL_CMPLX_POLYNOMIAL, errors.New("Powers of polynomials must be integers")
+			}
+			if math.Abs(real(exponent)) > MAX_POLYNOMIAL_DEGREE {
+				return NIL_CMPLX_POLYNOMIAL, fmt.Errorf("Polynomials can't have powers greater than %d", MAX_POLYNOMIAL_DEGREE)
+			}
+			return left.Power(int(real(exponent)))
 		}
-		power *= (*termInfo)[term_pow_sign]
-	}
-	if (*termInfo)[term_pos_num_start] > -1 || (*termInfo)[term_pos_variable] > -1 {
-		*terms = append(*terms, PolynomialTerm{Coefficient: coefficient, Power: power})
 	}
-	// reset positions
-	(*termInfo)[term_num_sign] = 1
-	(*termInfo)[term_pos_num_start] = -1
-	(*termInfo)[term_pos_num_end] = -1
-	(*termInfo)[term_pos_variable] = -1
-	(*termInfo)[term_pow_sign] = 1
-	(*termInfo)[term_pos_pow_start] = -1
-	(*termInfo)[term_pos_pow_end] = -1
-	return err
+	return NIL_CMPLX_POLYNOMIAL, errors.New("Invalid polynomial")
 }
 
-// Constructs a CmplxPolynomial type from a mathematical expression.
+// Constructs a CmplxPolynomial type from a mathematical expression of a
+// single-letter variable, such as 3 + 2.3x - x^5, z^3 - (1+2i) or
+// (z-1)(z+i)^2. Polynomials support the operators +, -, *, ^ and implicit
+// multiplication, division by a single term, and imaginary numbers such as
+// 2.5i, so i can't be the variable.
 func ParseCmplxPolynomial(txt string) (CmplxPolynomial, error) {
-	var err error = nil
-	var terms []PolynomialTerm
+	tokens, err := tokenizeExpression(txt, POLYNOMIAL_SYNTAX)
+	if err != nil {
+		return NIL_CMPLX_POLYNOMIAL, err
+	}
 	var variable rune = ' '
-	chars := []rune(txt)
-	state := state_GET_COEFFICIENT
-	// termItemPositions -> num_sign-num_start-num_end-variable_pos-pow_sign-pow_start-pow_end
-	termItemPositions := []int{1, -1, -1, -1, 1, -1, -1}
-	i := 0
-	for {
-		if i >= len(chars) {
-			if state >= state_READ_COEFFICIENT {
-				err = add_term(&terms, &chars, &termItemPositions)
-				if err != nil {
-					return NIL_CMPLX_POLYNOMIAL, err
-				}
-				break
-			} else {
-				return NIL_CMPLX_POLYNOMIAL, errors.New("Invalid polynomial")
-			}
+	for _, token := range tokens {
+		if token.kind != token_IDENTIFIER {
+			continue
 		}
-		if unicode.IsLetter(chars[i]) {
-			if variable != ' ' && chars[i] != variable {
-				return NIL_CMPLX_POLYNOMIAL, errors.New("Multiple variables in polynomial")
-			}
-			if state == state_READ_VARIABLE {
-				return NIL_CMPLX_POLYNOMIAL, errors.New("Variables must be a single character")
-			}
-			variable = chars[i]
-			state = state_READ_VARIABLE
-			termItemPositions[term_pos_variable] = i
-		} else if unicode.IsDigit(chars[i]) {
-			a := i
-			for i < len(chars) {
-				if unicode.IsDigit(chars[i]) || chars[i] == '.' {
-					i++
-				} else {
-					break
-				}
-			}
-			if state == state_GET_POWER {
-				termItemPositions[term_pos_pow_start] = a
-				termItemPositions[term_pos_pow_end] = i
-				state = state_READ_POWER
-			} else if state == state_GET_COEFFICIENT {
-				termItemPositions[term_pos_num_start] = a
-				termItemPositions[term_pos_num_end] = i
-				state = state_READ_COEFFICIENT
-			}
+		if _, found := POLYNOMIAL_SYNTAX.Constants[token.text]; found {
 			continue
-		} else if chars[i] == '^' {
-			if state != state_READ_VARIABLE {
-				return NIL_CMPLX_POLYNOMIAL, errors.New("Invalid polynomial")
-			}
-			state = state_GET_POWER
-		} else if chars[i] == '+' || chars[i] == '-' {
-			var sign int = 1
-			if chars[i] == '-' {
-				sign = -1
-			}
-			if state == state_GET_COEFFICIENT {
-				termItemPositions[term_num_sign] *= sign
-			} else if state == state_GET_POWER {
-				termItemPositions[term_pow_sign] *= sign
-			} else if state >= state_READ_COEFFICIENT {
-				err = add_term(&terms, &chars, &termItemPositions)
-				if err != nil {
-					return NIL_CMPLX_POLYNOMIAL, err
-				}
-				termItemPositions[term_num_sign] *= sign
-				state = state_GET_COEFFICIENT
-			}
-		} else if chars[i] != ' ' {
-			return NIL_CMPLX_POLYNOMIAL, errors.New("Invalid polynomial")
 		}
-		i++
+		if utf8.RuneCountInString(token.text) != 1 {
+			return NIL_CMPLX_POLYNOMIAL, &ExpressionError{Position: token.position, Message: "Variables must be a single character"}
+		}
+		name, _ := utf8.DecodeRuneInString(token.text)
+		if variable != ' ' && name != variable {
+			return NIL_CMPLX_POLYNOMIAL, &ExpressionError{Position: token.position, Message: "Multiple variables in polynomial"}
+		}
+		variable = name
+	}
+	variables := []string{}
+	if variable != ' ' {
+		variables = append(variables, string(variable))
+	}
+	parser, err := newExpressionParser(txt, variables, POLYNOMIAL_SYNTAX)
+	if err != nil {
+		return NIL_CMPLX_POLYNOMIAL, err
+	}
+	root, err := parser.parse()
+	if err != nil {
+		return NIL_CMPLX_POLYNOMIAL, err
 	}
-	return CmplxPolynomial{Terms: terms, Variable: variable}, nil
+	return polynomialFromNode(root, variable)
 }
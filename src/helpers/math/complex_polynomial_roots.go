@@ -0,0 +1,127 @@
+package math
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	// The maximum number of iterations of the Aberth method.
+	ROOT_FINDING_MAX_ITERATIONS = 1000
+	// The relative size of the corrections below which roots are converged.
+	ROOT_FINDING_TOLERANCE = 1e-14
+	// The largest backward error of the roots that didn't converge, relative to
+	// the sum of the absolute values of the terms. Multiple roots converge
+	// slowly but still reach it.
+	ROOT_FINDING_MAX_RESIDUAL = 1e-12
+	// The angle in radians by which the initial guesses of the roots are
+	// rotated, which keeps them off the symmetry axes of real polynomials.
+	ROOT_FINDING_INITIAL_ANGLE = 0.4
+)
+
+// Finds the roots of the polynomial with the Aberth method, a refinement of
+// the Durand-Kerner method that updates all of the roots at once. Roots are
+// repeated by their multiplicity, and terms with negative powers are
+// multiplied out, so the roots of z - 1/z are those of z^2 - 1.
+func (polynomial CmplxPolynomial) Roots() ([]complex128, error) {
+	if len(polynomial.Terms) == 0 {
+		return nil, errors.New("The zero polynomial has infinitely many roots")
+	}
+	// the roots of z^k p(z) are 0 and the roots of p(z)
+	lowest := polynomial.Terms[0].Power
+	for _, term := range polynomial.Terms {
+		if term.Power < lowest {
+			lowest = term.Power
+		}
+	}
+	degree := polynomial.Degree() - lowest
+	coefficients := make([]complex128, degree+1)
+	for _, term := range polynomial.Terms {
+		coefficients[term.Power-lowest] += term.Coefficient
+	}
+	var roots []complex128
+	for i := 0; i < lowest; i++ {
+		roots = append(roots, 0)
+	}
+	if degree == 0 {
+		return roots, nil
+	}
+	found, err := aberthRoots(coefficients)
+	if err != nil {
+		return nil, err
+	}
+	return append(roots, found...), nil
+}
+
+// Finds the roots of the polynomial whose coefficients are given by
+// increasing power, and whose first and last coefficients aren't 0.
+func aberthRoots(coefficients []complex128) ([]complex128, error) {
+	degree := len(coefficients) - 1
+	evaluate := func(z complex128) (value, derivative complex128) {
+		for k := degree; k >= 0; k-- {
+			derivative = derivative*z + value
+			value = value*z + coefficients[k]
+		}
+		return
+	}
+	// the initial guesses lie on a circle around the centroid of the roots,
+	// with a radius that estimates the size of the roots: by Fujiwara's bound,
+	// no root is more than twice as far from the origin
+	leading := coefficients[degree]
+	center := -coefficients[degree-1] / (complex(float64(degree), 0) * leading)
+	radius := 0.0
+	for k := 0; k < degree; k++ {
+		bound := math.Pow(cmplx.Abs(coefficients[k]/leading), 1/float64(degree-k))
+		radius = math.Max(radius, bound)
+	}
+	radius = math.Max(radius, math.SmallestNonzeroFloat64)
+	roots := make([]complex128, degree)
+	for k := range roots {
+		angle := 2*math.Pi*float64(k)/float64(degree) + ROOT_FINDING_INITIAL_ANGLE
+		roots[k] = center + cmplx.Rect(radius, angle)
+	}
+	converged := false
+	for iteration := 0; iteration < ROOT_FINDING_MAX_ITERATIONS && !converged; iteration++ {
+		converged = true
+		for k, root := range roots {
+			value, derivative := evaluate(root)
+			if value == 0 {
+				continue
+			}
+			var repulsion complex128
+			for j, other := range roots {
+				if j != k && other != root {
+					repulsion += 1 / (root - other)
+				}
+			}
+			// the Newton ratio p/p' divided by 1 - (p/p') * repulsion, which
+			// stays finite where p' is 0
+			correction := value / (derivative - value*repulsion)
+			if cmplx.IsNaN(correction) || cmplx.IsInf(correction) {
+				return nil, errors.New("Root finding diverged")
+			}
+			roots[k] = root - correction
+			if cmplx.Abs(correction) > ROOT_FINDING_TOLERANCE*math.Max(1, cmplx.Abs(roots[k])) {
+				converged = false
+			}
+		}
+	}
+	if converged {
+		return roots, nil
+	}
+	// a root of multiplicity m is only accurate to about the mth root of the
+	// machine epsilon, so its corrections may stay large and the roots are
+	// accepted by their residual instead
+	for _, root := range roots {
+		value, _ := evaluate(root)
+		scale := 0.0
+		for k := degree; k >= 0; k-- {
+			scale = scale*cmplx.Abs(root) + cmplx.Abs(coefficients[k])
+		}
+		if cmplx.Abs(value) > ROOT_FINDING_MAX_RESIDUAL*scale {
+			return nil, errors.New("Root finding didn't converge")
+		}
+	}
+	return roots, nil
+}
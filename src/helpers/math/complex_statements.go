@@ -0,0 +1,97 @@
+package math
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	// Matches the assignment at the start of a statement, such as "z = ".
+	assignmentPattern = regexp.MustCompile(`^\s*([\pL_][\pL\pN_]*)\s*=[^=]`)
+)
+
+// Represents an error found in one of a sequence of statements.
+type StatementError struct {
+	// The 0-based index of the statement.
+	Statement int
+	Err       error
+}
+
+func (err *StatementError) Error() string {
+	return fmt.Sprintf("statement %d: %s", err.Statement+1, err.Err.Error())
+}
+
+func (err *StatementError) Unwrap() error {
+	return err.Err
+}
+
+// Represents statements that run one after the other, each of which is an
+// expression or the assignment of an expression to a variable, such as
+// z = z*z + c. Statements aren't safe for concurrent use.
+type ComplexStatements struct {
+	// The names of the variables, whose values are given to Run in the same
+	// order.
+	Variables []string
+	program   *complexProgram
+	// The registers that hold the values of the variables after the
+	// statements.
+	results []int
+}
+
+// Runs the statements, which update the given values of the variables, and
+// returns the value of the last statement.
+func (statements *ComplexStatements) Run(values []complex128) complex128 {
+	value := statements.program.Run(values)
+	for i, register := range statements.results {
+		values[i] = statements.program.registers[register]
+	}
+	return value
+}
+
+// Constructs ComplexStatements from statements of the given variables and
+// syntax and compiles them. The value of no statements is 0.
+func ParseComplexStatements(statements []string, variables []string, syntax ExpressionSyntax) (*ComplexStatements, error) {
+	indices := make(map[string]int, len(variables))
+	for i, name := range variables {
+		indices[name] = i
+	}
+	compiler := newExpressionCompiler(len(variables))
+	result := compiler.constantRegister(0)
+	for i, statement := range statements {
+		target := -1
+		offset := 0
+		if match := assignmentPattern.FindStringSubmatchIndex(statement); match != nil {
+			name := statement[match[2]:match[3]]
+			index, found := indices[name]
+			if !found {
+				return nil, &StatementError{
+					Statement: i,
+					Err:       &ExpressionError{Position: len([]rune(statement[:match[2]])) + 1, Message: fmt.Sprintf("Unknown variable %q", name)},
+				}
+			}
+			target = index
+			// the character after '=' belongs to the expression
+			offset = match[1] - 1
+		}
+		parser, err := newExpressionParser(statement[offset:], variables, syntax)
+		if err == nil {
+			var root expressionNode
+			root, err = parser.parse()
+			if err == nil {
+				result = compiler.compile(root)
+			}
+		}
+		if err != nil {
+			if expressionError, ok := err.(*ExpressionError); ok {
+				position := expressionError.Position + len([]rune(statement[:offset]))
+				err = &ExpressionError{Position: position, Message: expressionError.Message}
+			}
+			return nil, &StatementError{Statement: i, Err: err}
+		}
+		if target >= 0 {
+			compiler.bind(target, result)
+		}
+	}
+	compiler.program.result = result
+	return &ComplexStatements{Variables: variables, program: compiler.program, results: compiler.bindings}, nil
+}
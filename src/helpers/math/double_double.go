@@ -0,0 +1,130 @@
+package math
+
+import (
+	"math"
+	"math/big"
+)
+
+// Represents an unevaluated sum of two float64s, which gives about 106 bits
+// of precision. |Lo| is at most half a unit in the last place of Hi.
+type DoubleDouble struct {
+	Hi float64
+	Lo float64
+}
+
+// Represents a complex number whose parts are double-doubles.
+type ComplexDoubleDouble struct {
+	Real DoubleDouble
+	Imag DoubleDouble
+}
+
+// Returns a + b and the rounding error of the sum.
+func twoSum(a, b float64) (float64, float64) {
+	s := a + b
+	bb := s - a
+	return s, (a - (s - bb)) + (b - bb)
+}
+
+// Returns a + b and the rounding error of the sum for |a| >= |b|.
+func quickTwoSum(a, b float64) (float64, float64) {
+	s := a + b
+	return s, b - (s - a)
+}
+
+// Returns a * b and the rounding error of the product.
+func twoProd(a, b float64) (float64, float64) {
+	p := a * b
+	return p, math.FMA(a, b, -p)
+}
+
+// Converts a float64 to a double-double.
+func NewDoubleDouble(x float64) DoubleDouble {
+	return DoubleDouble{Hi: x}
+}
+
+// Rounds an arbitrary-precision float to a double-double.
+func BigToDoubleDouble(x *big.Float) DoubleDouble {
+	hi, _ := x.Float64()
+	if math.IsInf(hi, 0) {
+		return DoubleDouble{Hi: hi}
+	}
+	remainder := new(big.Float).SetPrec(x.Prec()).Sub(x, big.NewFloat(hi))
+	lo, _ := remainder.Float64()
+	return DoubleDouble{Hi: hi, Lo: lo}
+}
+
+// Returns the float64 nearest to the double-double.
+func (a DoubleDouble) Float64() float64 {
+	return a.Hi + a.Lo
+}
+
+func (a DoubleDouble) Neg() DoubleDouble {
+	return DoubleDouble{Hi: -a.Hi, Lo: -a.Lo}
+}
+
+func (a DoubleDouble) Add(b DoubleDouble) DoubleDouble {
+	s, e := twoSum(a.Hi, b.Hi)
+	t, f := twoSum(a.Lo, b.Lo)
+	e += t
+	s, e = quickTwoSum(s, e)
+	e += f
+	s, e = quickTwoSum(s, e)
+	return DoubleDouble{Hi: s, Lo: e}
+}
+
+func (a DoubleDouble) Sub(b DoubleDouble) DoubleDouble {
+	return a.Add(b.Neg())
+}
+
+func (a DoubleDouble) Mul(b DoubleDouble) DoubleDouble {
+	p, e := twoProd(a.Hi, b.Hi)
+	e += a.Hi*b.Lo + a.Lo*b.Hi
+	p, e = quickTwoSum(p, e)
+	return DoubleDouble{Hi: p, Lo: e}
+}
+
+// Multiplies the double-double by a float64.
+func (a DoubleDouble) MulFloat(b float64) DoubleDouble {
+	p, e := twoProd(a.Hi, b)
+	e += a.Lo * b
+	p, e = quickTwoSum(p, e)
+	return DoubleDouble{Hi: p, Lo: e}
+}
+
+// Converts a complex128 to a complex double-double.
+func NewComplexDoubleDouble(z complex128) ComplexDoubleDouble {
+	return ComplexDoubleDouble{Real: NewDoubleDouble(real(z)), Imag: NewDoubleDouble(imag(z))}
+}
+
+// Returns the complex128 nearest to the complex double-double.
+func (z ComplexDoubleDouble) Complex128() complex128 {
+	return complex(z.Real.Float64(), z.Imag.Float64())
+}
+
+func (z ComplexDoubleDouble) Add(w ComplexDoubleDouble) ComplexDoubleDouble {
+	return ComplexDoubleDouble{Real: z.Real.Add(w.Real), Imag: z.Imag.Add(w.Imag)}
+}
+
+func (z ComplexDoubleDouble) Mul(w ComplexDoubleDouble) ComplexDoubleDouble {
+	return ComplexDoubleDouble{
+		Real: z.Real.Mul(w.Real).Sub(z.Imag.Mul(w.Imag)),
+		Imag: z.Real.Mul(w.Imag).Add(z.Imag.Mul(w.Real)),
+	}
+}
+
+// Returns z^2 with fewer multiplications than z.Mul(z).
+func (z ComplexDoubleDouble) Sqr() ComplexDoubleDouble {
+	return ComplexDoubleDouble{
+		Real: z.Real.Mul(z.Real).Sub(z.Imag.Mul(z.Imag)),
+		Imag: z.Real.Mul(z.Imag).MulFloat(2),
+	}
+}
+
+// Raises z to a positive integer power.
+func (z ComplexDoubleDouble) Pow(k int) ComplexDoubleDouble {
+	result := z
+	for i := 1; i < k; i++ {
+		result = result.Mul(z)
+	}
+	return result
+}
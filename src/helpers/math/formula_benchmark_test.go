@@ -0,0 +1,87 @@
+package math
+
+import (
+	"math/cmplx"
+	"testing"
+)
+
+const (
+	benchmarkFormula = "z^3 + c*sin(z) + k*zprev"
+)
+
+var (
+	benchmarkVariables = []string{"z", "c", "zprev", "k"}
+)
+
+// Evaluates a syntax tree by walking it, with cmplx.Pow for every power,
+// which is how expressions were evaluated before they were compiled.
+func evaluateTree(node expressionNode, values []complex128) complex128 {
+	switch node := node.(type) {
+	case *numberNode:
+		return node.value
+	case *variableNode:
+		return values[node.index]
+	case *negationNode:
+		return -evaluateTree(node.operand, values)
+	case *binaryNode:
+		a, b := evaluateTree(node.left, values), evaluateTree(node.right, values)
+		switch node.operator {
+		case '+':
+			return a + b
+		case '-':
+			return a - b
+		case '*':
+			return a * b
+		case '/':
+			return a / b
+		}
+		return cmplx.Pow(a, b)
+	case *callNode:
+		return node.function(evaluateTree(node.argument, values))
+	case *binaryCallNode:
+		return node.function(evaluateTree(node.left, values), evaluateTree(node.right, values))
+	}
+	panic("unknown expression node")
+}
+
+// Iterates a formula from a fixed point, restarting whenever the orbit
+// escapes so that it stays finite.
+func iterateFormula(b *testing.B, evaluate func(values []complex128) complex128) complex128 {
+	start := 0.1 + 0.1i
+	values := []complex128{start, -0.8 + 0.156i, start, 0.2}
+	for i := 0; i < b.N; i++ {
+		z := evaluate(values)
+		values[0], values[2] = z, values[0]
+		if cmplx.IsNaN(z) || real(z)*real(z)+imag(z)*imag(z) > 4 {
+			values[0], values[2] = start, start
+		}
+	}
+	return values[0]
+}
+
+func parseBenchmarkFormula(b *testing.B) *ComplexExpression {
+	expression, err := ParseComplexExpression(benchmarkFormula, benchmarkVariables)
+	if err != nil {
+		b.Fatal(err)
+	}
+	values := []complex128{0.3 - 0.2i, -0.8 + 0.156i, 0.1 + 0.1i, 0.2}
+	compiled, walked := expression.Evaluate(values), evaluateTree(expression.root, values)
+	if cmplx.Abs(compiled-walked) > 1e-12 {
+		b.Fatalf("the compiled formula gives %v instead of %v", compiled, walked)
+	}
+	return expression
+}
+
+func BenchmarkFormulaBytecode(b *testing.B) {
+	expression := parseBenchmarkFormula(b)
+	b.ResetTimer()
+	iterateFormula(b, expression.Evaluate)
+}
+
+func BenchmarkFormulaTreeWalk(b *testing.B) {
+	expression := parseBenchmarkFormula(b)
+	b.ResetTimer()
+	iterateFormula(b, func(values []complex128) complex128 {
+		return evaluateTree(expression.root, values)
+	})
+}
@@ -1,7 +1,11 @@
 package helpers
 
 import (
-	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"unicode"
 )
 
 const (
@@ -27,75 +31,158 @@ func SubString(text string, start, end int) string {
 	return string(textRunes[startPos:endPos])
 }
 
-// Retrieves a comma-separated list of values from a string
-func GetCSV(text string) ([]string, error) {
-	textRunes := []rune(text)
-	inQuotes := false
-	n := 0
-	for i := 0; i < len(textRunes); i++ {
-		c := textRunes[i]
-		if c == '"' {
-			if !inQuotes {
-				inQuotes = true
-			} else if inQuotes {
-				if textRunes[i-1] == '\\' {
-					continue
-				}
-				inQuotes = false
-				if i == len(textRunes)-1 {
-					n++
-				}
-			}
-		} else if !inQuotes && (c == ',' || i == len(textRunes)-1) {
-			n++
-		}
+// Represents a single value of a comma-separated parameter list.
+type ParameterToken struct {
+	Value string
+	// The 1-based character position of the value in the parameter list.
+	Position int
+	// Specifies if any part of the value was enclosed in double quotes.
+	Quoted bool
+}
+
+// Represents an error found at a position of a parameter list.
+type ParameterError struct {
+	Position int
+	Message  string
+}
+
+func (err *ParameterError) Error() string {
+	return fmt.Sprintf("%s at position %d", err.Message, err.Position)
+}
+
+// Creates an error that refers to the position of this token.
+func (token *ParameterToken) Errorf(format string, args ...any) error {
+	return &ParameterError{Position: token.Position, Message: fmt.Sprintf(format, args...)}
+}
+
+// Parses the value of this token as a float.
+func (token *ParameterToken) Float() (float64, error) {
+	value, err := strconv.ParseFloat(token.Value, 64)
+	if err != nil {
+		return 0, token.Errorf("Invalid number %q", token.Value)
 	}
-	if inQuotes {
-		return nil, errors.New("Inconsistent double quotes in text")
+	return value, nil
+}
+
+// Parses the value of this token as an arbitrary-precision float with enough
+// precision to keep every digit of the value.
+func (token *ParameterToken) BigFloat() (*big.Float, error) {
+	prec := uint(math.Ceil(float64(len(token.Value))*math.Log2(10))) + 64
+	value, _, err := big.ParseFloat(token.Value, 10, prec, big.ToNearestEven)
+	if err != nil || value.IsInf() {
+		return nil, token.Errorf("Invalid number %q", token.Value)
 	}
-	values := make([]string, n)
-	n = 0
-	a, b := -1, -1
-	inQuotes = false
-	skip := false
-	for i := 0; i < len(textRunes); i++ {
-		c := textRunes[i]
-		if skip {
-			skip = false
+	return value, nil
+}
+
+// Splits a comma-separated list of parameters into tokens.
+//
+// Commas inside parentheses or double quotes don't separate values, so values
+// such as rgb(255, 0, 0) can be used without quoting them. The double quotes
+// are removed from the values, a backslash escapes the character after it,
+// and whitespace around unquoted values is ignored.
+func TokenizeParameters(txt string) ([]ParameterToken, error) {
+	return tokenizeParameters(txt, true, true)
+}
+
+// Splits a comma-separated list of parameters into tokens, like
+// TokenizeParameters, except that parentheses and backslashes have no special
+// meaning, so only double quotes change the text of the values.
+func TokenizeFlatParameters(txt string) ([]ParameterToken, error) {
+	return tokenizeParameters(txt, false, false)
+}
+
+// Helper function for tokenizing a parameter list.
+func tokenizeParameters(txt string, nestParentheses, escapes bool) ([]ParameterToken, error) {
+	chars := []rune(txt)
+	var tokens []ParameterToken
+	var value []rune
+	var openParentheses []int
+	// valueEnd marks the end of the value without trailing unquoted whitespace.
+	valueEnd := 0
+	token := ParameterToken{Position: -1}
+	quoteStart, lastSeparator := -1, -1
+	addToken := func() {
+		token.Value = string(value[:valueEnd])
+		tokens = append(tokens, token)
+		token = ParameterToken{Position: -1}
+		value = value[:0]
+		valueEnd = 0
+	}
+	for i := 0; i < len(chars); i++ {
+		c := chars[i]
+		if token.Position < 0 && quoteStart < 0 && unicode.IsSpace(c) {
 			continue
 		}
-		if c != ' ' {
-			if a < 0 {
-				a = i
-			}
-			b = i
+		if token.Position < 0 && c != ',' {
+			token.Position = i + 1
 		}
-		if c == '"' {
-			if !inQuotes {
-				inQuotes = true
-				a = i + 1
-			} else if inQuotes {
-				if textRunes[i-1] == '\\' {
-					continue
-				}
-				inQuotes = false
-				values[n] = string(textRunes[a:b])
-				n++
-				a, b = -1, -1
-				if i == len(textRunes)-1 {
-					values[n] = string(textRunes[a:b])
-					n++
-				}
-				skip = true
+		switch {
+		case c == '\\' && escapes:
+			if i+1 >= len(chars) {
+				return nil, &ParameterError{Position: i + 1, Message: "Dangling escape character"}
+			}
+			i++
+			value = append(value, chars[i])
+			valueEnd = len(value)
+		case c == '"':
+			if quoteStart < 0 {
+				quoteStart = i
+			} else {
+				quoteStart = -1
+			}
+			token.Quoted = true
+			valueEnd = len(value)
+		case quoteStart >= 0:
+			value = append(value, c)
+			valueEnd = len(value)
+		case c == '(' && nestParentheses:
+			openParentheses = append(openParentheses, i)
+			value = append(value, c)
+			valueEnd = len(value)
+		case c == ')' && nestParentheses:
+			if len(openParentheses) == 0 {
+				return nil, &ParameterError{Position: i + 1, Message: "Unmatched ')'"}
+			}
+			openParentheses = openParentheses[:len(openParentheses)-1]
+			value = append(value, c)
+			valueEnd = len(value)
+		case c == ',' && len(openParentheses) == 0:
+			if token.Position < 0 {
+				return nil, &ParameterError{Position: i + 1, Message: "Expected a value before ','"}
 			}
-		} else if !inQuotes && a >= 0 && (c == ',' || i == len(textRunes)-1) {
-			if i == len(textRunes)-1 && c != ',' {
-				b++
+			addToken()
+			lastSeparator = i
+		default:
+			value = append(value, c)
+			if !unicode.IsSpace(c) {
+				valueEnd = len(value)
 			}
-			values[n] = string(textRunes[a:b])
-			n++
-			a, b = -1, -1
 		}
 	}
+	if quoteStart >= 0 {
+		return nil, &ParameterError{Position: quoteStart + 1, Message: "Unterminated double quotes"}
+	}
+	if len(openParentheses) > 0 {
+		return nil, &ParameterError{Position: openParentheses[len(openParentheses)-1] + 1, Message: "Unclosed '('"}
+	}
+	if token.Position >= 0 {
+		addToken()
+	} else if lastSeparator >= 0 {
+		return nil, &ParameterError{Position: lastSeparator + 1, Message: "Expected a value after ','"}
+	}
+	return tokens, nil
+}
+
+// Retrieves the values of a comma-separated list of parameters.
+func GetParameterValues(txt string) ([]string, error) {
+	tokens, err := TokenizeParameters(txt)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(tokens))
+	for i, token := range tokens {
+		values[i] = token.Value
+	}
 	return values, nil
 }